@@ -6,6 +6,16 @@ const int RAYCAST_HIT = 0;
 const int RAYCAST_MISS = 1;
 const int RAYCAST_OUT_OF_BOUNDS = 2;
 const int RAYCAST_MAX_STEPS = 3;
+const int RAYCAST_STARTED_INSIDE = 4;
+
+// faces of a voxel, a ray going +x goes in through FACE_NEG_X
+const int FACE_NONE = 0;
+const int FACE_NEG_X = 1;
+const int FACE_POS_X = 2;
+const int FACE_NEG_Y = 3;
+const int FACE_POS_Y = 4;
+const int FACE_NEG_Z = 5;
+const int FACE_POS_Z = 6;
 
 const vec4 SKY_BLUE = vec4(102./255., 191./255., 255./255., 1);
 const vec4 BROWN = vec4(127./255., 106./255., 79./255., 1);
@@ -28,6 +38,16 @@ uniform vec3 cameraRight;
 uniform vec3 numVoxels;
 uniform vec3 sunPos;
 
+// mirrors voxel.RaycastHit
+struct RaycastHit {
+    int status;
+    int face;
+    vec3 normal;
+    float t;
+    vec3 hitPos;
+    ivec3 mapPos;
+};
+
 // SSBO
 layout (std430, binding=13) buffer voxelData {
     uint voxels[];
@@ -62,8 +82,10 @@ bool getVoxel(int x, int y, int z) {
         return false;
     }
 
-    // Get the voxel index (which is a byte offset)
-    int vi = (x/2) + (z/2)*int(numVoxels.x)/2 + (y/2)*int(numVoxels.x)/2*int(numVoxels.z)/2;
+    // Get the voxel index (which is a byte offset), odd sizes round up to whole bricks
+    int bx = (int(numVoxels.x) + 1) / 2;
+    int bz = (int(numVoxels.z) + 1) / 2;
+    int vi = (x/2) + (z/2)*bx + (y/2)*bx*bz;
 
     // Get the corresponding int containing our voxel
     uint vd = voxels[vi/4];
@@ -102,26 +124,39 @@ vec3 getRayDir(int x, int y) {
     return normalize(rayPos - cameraPos);
 }
 
-int raycast(vec3 rayPos, vec3 rayDir, out vec3 hitPos, out ivec3 mapPos) {
-    mapPos = ivec3(floor(rayPos + 0.));
+int stepFace(int axis, int rayStep) {
+    return (rayStep > 0 ? FACE_NEG_X : FACE_POS_X) + axis * 2;
+}
+
+vec3 faceNormal(int face) {
+    if (face == FACE_NONE) {
+        return vec3(0, 0, 0);
+    }
+    vec3 normal = vec3(0, 0, 0);
+    normal[(face - 1) / 2] = face % 2 == 1 ? -1 : 1;
+    return normal;
+}
+
+RaycastHit raycast(vec3 rayPos, vec3 rayDir) {
+    ivec3 mapPos = ivec3(floor(rayPos + 0.));
     ivec3 rayStep = ivec3(sign(rayDir));
     vec3 deltaDist = abs(vec3(length(rayDir)) / rayDir);
     vec3 sideDist = (sign(rayDir) * (vec3(mapPos) - rayPos) + (sign(rayDir) * 0.5) + 0.5) * deltaDist; 
 
-    int hit = 0;
-    int side = 4;
+    RaycastHit hit;
+    int face = FACE_NONE;
     float dist = 0;
 
-    while (hit == 0) {
+    while (true) {
         int result = checkHit(mapPos.x, mapPos.y, mapPos.z, rayDir);
 
 		if (result == RAYCAST_OUT_OF_BOUNDS) {
-			hit = 0;
+			hit.status = RAYCAST_OUT_OF_BOUNDS;
             break;
 		}
 
 		if (result == RAYCAST_HIT) {
-			hit = side;
+			hit.status = face == FACE_NONE ? RAYCAST_STARTED_INSIDE : RAYCAST_HIT;
             break;
 		}
 
@@ -130,13 +165,13 @@ int raycast(vec3 rayPos, vec3 rayDir, out vec3 hitPos, out ivec3 mapPos) {
                 dist = sideDist.x;
                 sideDist.x += deltaDist.x;
                 mapPos.x += rayStep.x;
-                side = 1 * rayStep.x;
+                face = stepFace(0, rayStep.x);
             }
             else {
                 dist = sideDist.z;
                 sideDist.z += deltaDist.z;
                 mapPos.z += rayStep.z;
-                side = 3 * rayStep.z;
+                face = stepFace(2, rayStep.z);
             }
         }
         else {
@@ -144,42 +179,28 @@ int raycast(vec3 rayPos, vec3 rayDir, out vec3 hitPos, out ivec3 mapPos) {
                 dist = sideDist.y;
                 sideDist.y += deltaDist.y;
                 mapPos.y += rayStep.y;
-                side = 2 * rayStep.y;
+                face = stepFace(1, rayStep.y);
             }
             else {
                 dist = sideDist.z;
                 sideDist.z += deltaDist.z;
                 mapPos.z += rayStep.z;
-                side = 3 * rayStep.z;
+                face = stepFace(2, rayStep.z);
             }
         }
     }
 
-    hitPos = rayPos + (rayDir * dist);
+    hit.face = face;
+    hit.normal = faceNormal(face);
+    hit.t = dist;
+    hit.hitPos = rayPos + (rayDir * dist);
+    hit.mapPos = mapPos;
 
 	return hit;
 }
 
-vec3 hitNormal(int hit) {
-	if (hit == -1) {
-		return vec3(1, 0, 0);
-	} else if (hit == 1) {
-		return vec3(-1, 0, 0);
-	} else if (hit == -2) {
-		return vec3(0, 1, 0);
-	} else if (hit == 2) {
-		return vec3(0, -1, 0);
-	} else if (hit == -3) {
-        return vec3(0, 0, 1);
-	} else if (hit == 3) {
-        return vec3(0, 0, -1);
-	} else {
-        return vec3(0, 0, 0);
-    }
-}
-
-float diffuseLight(int hit, vec3 dir) {
-	float diffuseLight = dot(hitNormal(hit), dir);
+float diffuseLight(int face, vec3 dir) {
+	float diffuseLight = dot(faceNormal(face), dir);
 	if (diffuseLight < 0.2) {
 		diffuseLight = 0.2;
 	}
@@ -190,26 +211,22 @@ void main() {
     vec2 fragCoord = fragTexCoord * resolution.xy;
     vec3 rayDir = getRayDir(int(fragCoord.x), int(fragCoord.y));
     vec3 rayPos = cameraPos;
-    vec3 hitPos;
-    ivec3 mapPos;
 
-    int hit = raycast(rayPos, rayDir, hitPos, mapPos);
+    RaycastHit hit = raycast(rayPos, rayDir);
 
     finalColor = SKY_BLUE;
-    if (hit == 1 || hit == -1) {
-        finalColor = DARK_BROWN;
-    } else if (hit == 2 || hit == -2) {
-        finalColor = GREEN;
-    } else if (hit == 3 || hit == -3) {
-        finalColor = BROWN;
-    }
+    if (hit.status == RAYCAST_HIT) {
+        if (hit.face == FACE_NEG_X || hit.face == FACE_POS_X) {
+            finalColor = DARK_BROWN;
+        } else if (hit.face == FACE_NEG_Y || hit.face == FACE_POS_Y) {
+            finalColor = GREEN;
+        } else {
+            finalColor = BROWN;
+        }
 
-    if (hit != 0 && hit != 4) {
-        vec3 sunHitPos;
-        ivec3 sunMapPos;
-        int sunHit = raycast(sunPos, normalize(hitPos - sunPos), sunHitPos, sunMapPos);
-        if (sunHit == hit && sunMapPos == mapPos) {
-            finalColor = finalColor * diffuseLight(sunHit, normalize(sunPos -sunHitPos));
+        RaycastHit sunHit = raycast(sunPos, normalize(hit.hitPos - sunPos));
+        if (sunHit.face == hit.face && sunHit.mapPos == hit.mapPos) {
+            finalColor = finalColor * diffuseLight(sunHit.face, normalize(sunPos - sunHit.hitPos));
         } else {
             finalColor = finalColor * 0.2;
         }
@@ -2,12 +2,10 @@ module github.com/mmcilroy/voxel_raycaster
 
 go 1.22.3
 
+require github.com/gen2brain/raylib-go/raylib v0.0.0-20240916050633-6bc3d79c96ad
+
 require (
 	github.com/ebitengine/purego v0.7.1 // indirect
-	github.com/gen2brain/raylib-go/raygui v0.0.0-20240807111636-8861ee437da9 // indirect
-	github.com/gen2brain/raylib-go/raylib v0.0.0-20240916050633-6bc3d79c96ad // indirect
-	github.com/mattkimber/gandalf v1.4.0 // indirect
-	github.com/mattkimber/gorender v1.4.0 // indirect
 	golang.org/x/exp v0.0.0-20240909161429-701f63a606c0 // indirect
 	golang.org/x/sys v0.25.0 // indirect
 )
@@ -0,0 +1,235 @@
+// Package render traces and shades voxel scenes in software into images, it
+// doesn't need a window so it can run anywhere
+package render
+
+import (
+	"image"
+	"image/color"
+	"sync"
+
+	"github.com/mmcilroy/voxel_raycaster/voxel"
+)
+
+const NUM_THREADS_X = 4
+const NUM_THREADS_Y = 4
+
+// would this be better named VoxelColorFn?
+// voxels are fixed color but pixel color is affected by lighting
+type PixelColorFn func(hit voxel.RaycastHit, material voxel.Material) color.RGBA
+
+// Scene is what gets rendered, either the Voxels grid or a streaming World.
+// call Compress once Voxels is set up to build the rest of the mip chain.
+//
+// a World has no edges for the sun to sit outside of so SunPos is taken as a
+// direction, and anything that isn't loaded yet is drawn in FogColor if the
+// world has Fog set
+type Scene struct {
+	UncompressedVoxels     *voxel.VoxelGrid
+	Voxels                 *voxel.VoxelGrid
+	World                  *voxel.StreamingWorld
+	FogColor               color.RGBA
+	SunPos                 voxel.Vector3f
+	EnableRecursiveDDA     bool
+	EnableLighting         bool
+	EnablePerPixelLighting bool
+}
+
+// Compress moves Voxels down to the lowest res level, reusing any levels
+// that were already built or loaded, and keeps the full res level in
+// UncompressedVoxels
+func (scene *Scene) Compress() {
+	if scene.Voxels == nil {
+		return
+	}
+
+	for scene.Voxels.NumVoxelsY > 2 {
+		if scene.Voxels.Child != nil {
+			scene.Voxels = scene.Voxels.Child
+		} else {
+			scene.Voxels = scene.Voxels.Compress()
+		}
+	}
+
+	scene.UncompressedVoxels = scene.Voxels
+	for scene.UncompressedVoxels.Parent != nil {
+		scene.UncompressedVoxels = scene.UncompressedVoxels.Parent
+	}
+}
+
+// Render draws the scene as seen by camera into a new image the size of the
+// camera's resolution
+func Render(scene *Scene, camera *voxel.Camera, pixelColorFn PixelColorFn) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, int(camera.Resolution.X), int(camera.Resolution.Y)))
+	RenderInto(img, scene, camera, pixelColorFn)
+	return img
+}
+
+// RenderInto is Render into an image that already exists so one can be
+// reused every frame. the rows and columns are split between threads
+func RenderInto(img *image.RGBA, scene *Scene, camera *voxel.Camera, pixelColorFn PixelColorFn) {
+	var frameWait sync.WaitGroup
+
+	frameWait.Add(NUM_THREADS_X * NUM_THREADS_Y)
+	for ty := 0; ty < NUM_THREADS_Y; ty++ {
+		for tx := 0; tx < NUM_THREADS_X; tx++ {
+			go func(tx, ty int) {
+				defer frameWait.Done()
+				raycastQuad(
+					img,
+					scene,
+					camera,
+					int32(int(camera.Resolution.X)*tx/NUM_THREADS_X),
+					int32(int(camera.Resolution.X)*(tx+1)/NUM_THREADS_X),
+					int32(int(camera.Resolution.Y)*ty/NUM_THREADS_Y),
+					int32(int(camera.Resolution.Y)*(ty+1)/NUM_THREADS_Y),
+					pixelColorFn)
+			}(tx, ty)
+		}
+	}
+	frameWait.Wait()
+}
+
+// Pixel traces the ray for a single pixel, it gives the same color as that
+// pixel in Render
+func Pixel(scene *Scene, camera *voxel.Camera, x, y int32, pixelColorFn PixelColorFn) color.RGBA {
+	// get the ray direction
+	plane := camera.Plane()
+	_, rayDir := camera.RayDir(&plane, int32(x), int32(y))
+
+	if scene.World != nil {
+		return worldPixel(scene, camera, rayDir, pixelColorFn)
+	}
+
+	// fire a ray into the scene and check what we hit
+	voxels := raycastVoxels(scene)
+	hit := voxels.RaycastRecursive(camera.Body.Position, rayDir)
+
+	return shadePixel(scene, voxels, hit, pixelColorFn)
+}
+
+func raycastQuad(img *image.RGBA, scene *Scene, camera *voxel.Camera, xa, xb, ya, yb int32, pixelColorFn PixelColorFn) {
+	if scene.World != nil {
+		for y := ya; y < yb; y++ {
+			for x := xa; x < xb; x++ {
+				img.SetRGBA(int(x), int(y), Pixel(scene, camera, x, y, pixelColorFn))
+			}
+		}
+		return
+	}
+
+	// trace the quad in packets of neighbouring rays
+	plane := camera.Plane()
+	voxels := raycastVoxels(scene)
+	var packet voxel.RayPacket
+
+	for y := ya; y < yb; y += voxel.PACKET_SIZE {
+		for x := xa; x < xb; x += voxel.PACKET_SIZE {
+			camera.Packet(&plane, x, y, xb, yb, &packet)
+			voxels.RaycastPacket(&packet)
+
+			for i := 0; i < packet.Len(); i++ {
+				px, py := x+int32(i)%packet.Width, y+int32(i)/packet.Width
+				img.SetRGBA(int(px), int(py), shadePixel(scene, voxels, packet.Hits[i], pixelColorFn))
+			}
+		}
+	}
+}
+
+// raycastVoxels decides what version of the voxel grid to use
+func raycastVoxels(scene *Scene) *voxel.VoxelGrid {
+	if !scene.EnableRecursiveDDA {
+		return scene.UncompressedVoxels
+	}
+	return scene.Voxels
+}
+
+// shadePixel colors and lights what a ray from the camera hit
+func shadePixel(scene *Scene, voxels *voxel.VoxelGrid, hit voxel.RaycastHit, pixelColorFn PixelColorFn) color.RGBA {
+	hitPos := hit.HitPos
+
+	// get the material of the voxel we hit
+	material := voxel.Material(0)
+	if hit.Hit() {
+		material = scene.UncompressedVoxels.GetMaterial(hit.MapPos.X, hit.MapPos.Y, hit.MapPos.Z)
+	}
+
+	// get the pixel color for the voxel and face
+	c := pixelColorFn(hit, material)
+
+	// if lightning is enabled and something was hit apply shadows
+	lightScale := float32(1)
+
+	// check if the hit point is visible to the sun
+	if scene.EnableLighting && hit.Status == voxel.RAYCAST_HIT {
+
+		// if we are not lighting per pixel do it per voxel face
+		if !scene.EnablePerPixelLighting {
+			hitPos = hit.FaceCenter(scene.UncompressedVoxels.VoxelSize)
+		}
+		sunHit := voxels.RaycastRecursive(scene.SunPos, voxel.Direction(hitPos, scene.SunPos))
+
+		// if sun ray hits the same block and face as our initial ray calc lighting
+		if sunHit.Face == hit.Face && voxel.Distance(hitPos, sunHit.HitPos) < 0.5 /*sunMapPos.Equals(mapPos)*/ {
+			lightScale = voxel.DiffuseLight(sunHit.Face, voxel.Direction(scene.SunPos, sunHit.HitPos))
+		} else {
+			lightScale = 0.5 // shadow
+		}
+	}
+
+	return color.RGBA{
+		R: uint8(float32(c.R) * lightScale),
+		G: uint8(float32(c.G) * lightScale),
+		B: uint8(float32(c.B) * lightScale),
+		A: 255,
+	}
+}
+
+// worldPixel is Pixel for a streaming world, shadows are found by tracing
+// from the hit towards the sun
+func worldPixel(scene *Scene, camera *voxel.Camera, rayDir voxel.Vector3f, pixelColorFn PixelColorFn) color.RGBA {
+	world := scene.World
+	hit := world.Raycast(camera.Body.Position, rayDir)
+	if hit.Status == voxel.RAYCAST_UNLOADED {
+		return scene.FogColor
+	}
+
+	material := voxel.Material(0)
+	if hit.Hit() {
+		material = world.GetMaterial(hit.MapPos.X, hit.MapPos.Y, hit.MapPos.Z)
+	}
+
+	c := pixelColorFn(hit, material)
+	if hit.Status != voxel.RAYCAST_HIT {
+		return c
+	}
+
+	hitPos := hit.HitPos
+	lightScale := float32(1)
+	if scene.EnableLighting {
+		if !scene.EnablePerPixelLighting {
+			hitPos = hit.FaceCenter(world.VoxelSize)
+		}
+
+		// start just off the face so the ray doesn't hit the voxel it left
+		sunDir := scene.SunPos.Normalize()
+		start := hitPos.Plus(hit.Normal.MulScalar(world.VoxelSize * 0.01))
+		if sunHit := world.Raycast(start, sunDir); !sunHit.Hit() {
+			lightScale = voxel.DiffuseLight(hit.Face, sunDir)
+		} else {
+			lightScale = 0.5 // shadow
+		}
+	}
+
+	// fade into the fog towards the edge of what is loaded
+	fog := float32(0)
+	if world.Fog {
+		far := float32(world.Radius*world.ChunkSize) * world.VoxelSize
+		fog = min(1, voxel.Distance(camera.Body.Position, hitPos)/far)
+		fog *= fog
+	}
+
+	shade := func(c, f uint8) uint8 {
+		return uint8(float32(c)*lightScale*(1-fog) + float32(f)*fog)
+	}
+	return color.RGBA{R: shade(c.R, scene.FogColor.R), G: shade(c.G, scene.FogColor.G), B: shade(c.B, scene.FogColor.B), A: 255}
+}
@@ -0,0 +1,94 @@
+package render
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/mmcilroy/voxel_raycaster/voxel"
+)
+
+func faceColor(hit voxel.RaycastHit, material voxel.Material) color.RGBA {
+	if !hit.Hit() {
+		return color.RGBA{R: 102, G: 191, B: 255, A: 255}
+	}
+	return color.RGBA{R: uint8(40 * hit.Face), G: 200, B: uint8(material), A: 255}
+}
+
+// checkPixels makes sure every pixel of a full render is what tracing that
+// pixel on its own gives
+func checkPixels(t *testing.T, scene *Scene, camera *voxel.Camera) {
+	img := Render(scene, camera, faceColor)
+	if img.Bounds().Dx() != int(camera.Resolution.X) || img.Bounds().Dy() != int(camera.Resolution.Y) {
+		t.Fatalf("Incorrect size: %v\n", img.Bounds())
+	}
+
+	colors := map[color.RGBA]bool{}
+	for y := int32(0); y < camera.Resolution.Y; y++ {
+		for x := int32(0); x < camera.Resolution.X; x++ {
+			expected := Pixel(scene, camera, x, y, faceColor)
+			if c := img.RGBAAt(int(x), int(y)); c != expected {
+				t.Fatalf("Incorrect pixel %d, %d: %v, expected %v\n", x, y, c, expected)
+			}
+			colors[expected] = true
+		}
+	}
+
+	// make sure there is something in view
+	if len(colors) < 4 {
+		t.Fatalf("Too few colors: %d\n", len(colors))
+	}
+}
+
+func TestRender(t *testing.T) {
+	grid := voxel.NewVoxelGrid(64, 32, 64, 1)
+	grid.Fill(voxel.Box{Max: voxel.Vector3f{X: 64, Y: 1, Z: 64}}, voxel.FILL_UNION, 1)
+	grid.Fill(voxel.Sphere{Center: voxel.Vector3f{X: 32, Y: 8, Z: 32}, Radius: 6}, voxel.FILL_UNION, 2)
+
+	scene := Scene{
+		Voxels:             grid,
+		SunPos:             voxel.Vector3f{X: 64, Y: 64, Z: 0},
+		EnableRecursiveDDA: true,
+		EnableLighting:     true,
+	}
+	scene.Compress()
+	if scene.UncompressedVoxels != grid || scene.Voxels.NumVoxelsY > 2 {
+		t.Fatalf("Incorrect compression: %+v\n", scene.Voxels.Count())
+	}
+
+	// an odd size so the threads and packets don't divide it evenly
+	camera := voxel.NewCamera(83, 45, 0.66)
+	camera.Body.Position = voxel.Vector3f{X: 4, Y: 12, Z: 4}
+	camera.Body.Rotate(-0.8, -0.3)
+
+	checkPixels(t, &scene, &camera)
+
+	scene.EnablePerPixelLighting = true
+	checkPixels(t, &scene, &camera)
+
+	scene.EnableRecursiveDDA = false
+	checkPixels(t, &scene, &camera)
+}
+
+func TestRenderWorld(t *testing.T) {
+	world := voxel.NewStreamingWorld(16, 16, 1, 2, func(chunk *voxel.VoxelGrid, origin voxel.Vector3i) {
+		chunk.Fill(voxel.Box{Max: voxel.Vector3f{X: 16, Y: float32(4 + (origin.X+origin.Z)/16%3), Z: 16}}, voxel.FILL_UNION, 1)
+	})
+	defer world.Close()
+	world.Fog = true
+
+	camera := voxel.NewCamera(64, 36, 0.66)
+	camera.Body.Position = voxel.Vector3f{X: 8, Y: 10, Z: 8}
+	camera.Body.Rotate(-0.8, -0.3)
+
+	// load everything around the camera
+	for world.Update(camera.Body.Position); world.Loading() > 0; world.Update(camera.Body.Position) {
+	}
+
+	scene := Scene{
+		World:          world,
+		FogColor:       color.RGBA{R: 200, G: 200, B: 200, A: 255},
+		SunPos:         voxel.Vector3f{X: 1, Y: 2, Z: -1},
+		EnableLighting: true,
+	}
+	checkPixels(t, &scene, &camera)
+}
@@ -6,6 +6,7 @@ import (
 	"unsafe"
 
 	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/mmcilroy/voxel_raycaster/terrain"
 	"github.com/mmcilroy/voxel_raycaster/voxel"
 )
 
@@ -15,18 +16,11 @@ const WORLD_SIZE = 256
 
 func initWorld() *voxel.VoxelGrid {
 	voxels := voxel.NewVoxelGrid(WORLD_SIZE, WORLD_SIZE, WORLD_SIZE, 1.0)
-	perlinNoise := rl.GenImagePerlinNoise(WORLD_SIZE, WORLD_SIZE, 0, 0, 0.5)
-	colors := rl.LoadImageColors(perlinNoise)
-
-	for z := int32(0); z < WORLD_SIZE; z++ {
-		for x := int32(0); x < WORLD_SIZE; x++ {
-			color := colors[x+z*WORLD_SIZE]
-			height := float32(color.R) / 255.0 * float32(WORLD_SIZE)
-			for y := int32(0); y < int32(height)+1; y++ {
-				voxels.SetVoxel(x, y, z, true)
-			}
-		}
-	}
+
+	// the shader only sees which voxels are set so leave out the water
+	t := terrain.NewTerrain(1, WORLD_SIZE)
+	t.Water = 0
+	t.Generate(voxels)
 
 	return voxels
 }
@@ -59,7 +53,8 @@ func main() {
 	rl.SetShaderValue(shader, resolutionLoc, []float32{RESOLUTION_X, RESOLUTION_Y}, rl.ShaderUniformVec2)
 	rl.SetShaderValue(shader, numVoxelsLoc, []float32{float32(v.NumVoxelsX), float32(v.NumVoxelsY), float32(v.NumVoxelsZ)}, rl.ShaderUniformVec3)
 
-	ssbo := rl.LoadShaderBuffer(uint32(len(v.Voxels)), unsafe.Pointer(unsafe.SliceData(v.Voxels)), rl.DynamicCopy)
+	bricks := v.Bricks()
+	ssbo := rl.LoadShaderBuffer(uint32(len(bricks)), unsafe.Pointer(unsafe.SliceData(bricks)), rl.DynamicCopy)
 	rl.BindShaderBuffer(ssbo, 13)
 
 	for !rl.WindowShouldClose() {
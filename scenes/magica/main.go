@@ -1,85 +1,78 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
 	rl "github.com/gen2brain/raylib-go/raylib"
-	"github.com/mattkimber/gandalf/magica"
 	scene "github.com/mmcilroy/voxel_raycaster/scenes"
 	"github.com/mmcilroy/voxel_raycaster/voxel"
 )
 
 const WORLD_WIDTH, WORLD_HEIGHT = 1024, 1024
 
-const NUM_RAYS_X, NUM_RAYS_Y = 320, 180
-
-var world *voxel.VoxelGrid
+const VOXEL_SIZE = 0.25
 
-var palette = make([]rl.Color, 256)
-
-//var voxelColors = map[voxel.Vector3i]byte{}
+const NUM_RAYS_X, NUM_RAYS_Y = 320, 180
 
-var voxelColors = make([]byte, WORLD_WIDTH*WORLD_WIDTH*WORLD_HEIGHT)
+// the world is mostly empty so it is kept in chunks, the model is only kept
+// as a grid for its colors
+var world voxel.Voxels
 
-func voxelColorIndex(x, y, z int32) int32 {
-	return x + z*WORLD_WIDTH + y*WORLD_WIDTH*WORLD_WIDTH
-}
+var model *voxel.VoxelGrid
 
-func initWorld() {
-	world = voxel.NewVoxelGrid(WORLD_WIDTH, WORLD_HEIGHT, WORLD_WIDTH, 0.25)
+var modelOffset = voxel.Vector3i{X: 10, Y: 0, Z: 10}
 
-	object, _ := magica.FromFile("..\\..\\assets\\models\\settlement.vox")
+func initWorld(path string) {
+	world = voxel.NewChunkedVoxels(WORLD_WIDTH, WORLD_HEIGHT, WORLD_WIDTH, VOXEL_SIZE)
+	model = voxel.NewVoxelGrid(1, 1, 1, VOXEL_SIZE)
 
-	for i := 0; i < len(object.PaletteData); i += 4 {
-		palette[i/4] = rl.NewColor(object.PaletteData[i], object.PaletteData[i+1], object.PaletteData[i+2], 255)
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Printf("Failed to open %s: %v\n", path, err)
+		return
 	}
+	defer f.Close()
 
-	for z := int32(0); z < int32(object.Size.Z); z++ {
-		for y := int32(0); y < int32(object.Size.Y); y++ {
-			for x := int32(0); x < int32(object.Size.X); x++ {
-				v := object.Voxels[x][y][z]
-				if v != 0 {
-					world.SetVoxel(int32(x+10), int32(z), int32(y+10), true)
-					voxelColors[voxelColorIndex(x+10, z, y+10)] = v
-					//voxelColors[voxel.Vector3i{X: int32(x + 10), Y: int32(z), Z: int32(y + 10)}] = v
-				}
-			}
-		}
+	vox, err := voxel.ReadVox(f)
+	if err != nil {
+		fmt.Printf("Failed to load %s: %v\n", path, err)
+		return
 	}
 
-	for world.NumVoxelsY > 2 {
-		world = world.Compress()
-	}
+	model = voxel.NewVoxelGridFromVox(vox, VOXEL_SIZE)
+	model.ForEachVoxel(voxel.Vector3i{}, model.Count(), func(x, y, z int32) bool {
+		world.Set(x+modelOffset.X, y+modelOffset.Y, z+modelOffset.Z, true)
+		return true
+	})
 }
 
-func pixelColorFn(hit int32, mapPos voxel.Vector3i) rl.Color {
+func pixelColorFn(hit voxel.RaycastHit) rl.Color {
 	color := rl.SkyBlue
 
-	if hit != 0 {
-		paletteIndex := int(voxelColors[voxelColorIndex(mapPos.X, mapPos.Y, mapPos.Z)])
-		//paletteIndex := int(voxelColors[voxel.Vector3i{X: mapPos.X, Y: mapPos.Y, Z: mapPos.Z}])
-
-		if paletteIndex > 0 {
-			paletteIndex -= 1
+	if hit.Hit() {
+		material := model.GetMaterial(hit.MapPos.X-modelOffset.X, hit.MapPos.Y-modelOffset.Y, hit.MapPos.Z-modelOffset.Z)
+		if int(material) < len(model.Palette) {
+			color = model.Palette[material]
 		}
-		color = palette[paletteIndex]
 	}
 
 	return color
 }
 
 func main() {
-	initWorld()
-
-	raycastingScene := scene.RaycastingScene{
-		Voxels:                 world,
-		Camera:                 voxel.NewCamera(NUM_RAYS_X, NUM_RAYS_Y, 0.66),
-		SunPos:                 voxel.Vector3f{X: WORLD_WIDTH - 1, Y: WORLD_HEIGHT - 1, Z: 0},
-		EnableRecursiveDDA:     true,
-		EnableLighting:         true,
-		EnablePerPixelLighting: true,
-	}
-	raycastingScene.Camera.Body.Position.X = 1
-	raycastingScene.Camera.Body.Position.Y = 5
-	raycastingScene.Camera.Body.Position.Z = 1
+	modelPath := flag.String("model", filepath.Join("..", "..", "assets", "models", "casa.vox"), "the MagicaVoxel file to show")
+	flag.Parse()
+
+	initWorld(*modelPath)
+
+	camera := voxel.NewCamera(NUM_RAYS_X, NUM_RAYS_Y, 0.66)
+	camera.Body.Position.X = 1
+	camera.Body.Position.Y = 5
+	camera.Body.Position.Z = 1
 
-	scene.RenderRaycastingScene(&raycastingScene, pixelColorFn, func() {}, func() {})
+	// missing chunks are skipped in one step so there's no need for a mip chain
+	scene.RenderTracerScene(voxel.NewTracerImpl(&world), camera, pixelColorFn)
 }
@@ -1,8 +1,17 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/png"
+	"os"
+
 	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/mmcilroy/voxel_raycaster/render"
 	scene "github.com/mmcilroy/voxel_raycaster/scenes"
+	"github.com/mmcilroy/voxel_raycaster/terrain"
 	"github.com/mmcilroy/voxel_raycaster/voxel"
 )
 
@@ -12,55 +21,121 @@ const NUM_RAYS_X, NUM_RAYS_Y = 320, 180
 
 func initPerlinWorld(w, h int32) *voxel.VoxelGrid {
 	world := voxel.NewVoxelGrid(w, h, w, 1.0)
+	terrain.NewTerrain(1, h).Generate(world)
+	return world
+}
+
+// pixelColorFn colors voxels from the world's palette
+func pixelColorFn(world *voxel.VoxelGrid) scene.PixelColorFn {
+	return func(hit voxel.RaycastHit, material voxel.Material) rl.Color {
+		if !hit.Hit() {
+			return rl.SkyBlue
+		}
+		if int(material) < len(world.Palette) && material != 0 {
+			return world.Palette[material]
+		}
+		return rl.Brown
+	}
+}
+
+// loadWorld loads a prebuilt world if there is one, otherwise it generates
+// the world and saves it along with its compressed levels for next time
+func loadWorld(path string) *voxel.VoxelGrid {
+	if path == "" {
+		return initPerlinWorld(WORLD_WIDTH, WORLD_HEIGHT)
+	}
 
-	perlinNoise := rl.GenImagePerlinNoise(int(world.NumVoxelsX), int(world.NumVoxelsZ), 0, 0, 0.5)
-	colors := rl.LoadImageColors(perlinNoise)
-	maxHeight := float32(0.0)
-	gap := int32(0)
-
-	for z := gap; z < world.NumVoxelsZ-gap; z++ {
-		for x := gap; x < world.NumVoxelsX-gap; x++ {
-			color := colors[x+z*world.NumVoxelsX]
-			height := float32(color.R) / 255.0 * float32(world.NumVoxelsY)
-			if height > float32(maxHeight) {
-				maxHeight = height
-			}
-			for y := int32(0); y < int32(height)+1; y++ {
-				world.SetVoxel(x, y, z, true)
-			}
+	if f, err := os.Open(path); err == nil {
+		defer f.Close()
+		world, err := voxel.Load(f)
+		if err == nil {
+			return world
 		}
+		fmt.Printf("Failed to load %s: %v\n", path, err)
+	}
+
+	world := initPerlinWorld(WORLD_WIDTH, WORLD_HEIGHT)
+	for lowest := world; lowest.NumVoxelsY > 2; {
+		lowest = lowest.Compress()
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		fmt.Printf("Failed to save %s: %v\n", path, err)
+		return world
+	}
+	defer f.Close()
+
+	if err := world.Save(f); err != nil {
+		fmt.Printf("Failed to save %s: %v\n", path, err)
 	}
 
 	return world
 }
 
-func pixelColorFn(hit int32, mapPos voxel.Vector3i) rl.Color {
-	color := rl.Black
-	if hit == 1 || hit == -1 {
-		color = rl.Brown
-	} else if hit == 2 || hit == -2 {
-		color = rl.Green
-	} else if hit == 3 || hit == -3 {
-		color = rl.Brown
-	} else if hit == 0 {
-		color = rl.SkyBlue
+// loadHeightmap builds the world from a heightmap image and an optional
+// image of the same size to color it
+func loadHeightmap(heightmapPath, colorsPath string, options terrain.HeightmapOptions) (*voxel.VoxelGrid, error) {
+	decode := func(path string) (image.Image, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		img, _, err := image.Decode(f)
+		return img, err
+	}
+
+	heights, err := decode(heightmapPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if colorsPath != "" {
+		if options.Colors, err = decode(colorsPath); err != nil {
+			return nil, err
+		}
 	}
-	return color
+
+	return terrain.NewGridFromHeightmap(heights, 1.0, options)
 }
 
 func main() {
-	world := initPerlinWorld(WORLD_WIDTH, WORLD_HEIGHT)
+	worldPath := flag.String("world", "", "load the world from this file, it is generated and saved if it doesn't exist")
+	heightmapPath := flag.String("heightmap", "", "build the world from this grayscale PNG or PGM instead")
+	colorsPath := flag.String("colors", "", "color the heightmap from this image")
+	scale := flag.Float64("scale", WORLD_HEIGHT-1, "height in voxels of white in the heightmap")
+	seaLevel := flag.Int("sea", 0, "fill the heightmap with water up to this height")
+	flag.Parse()
+
+	var world *voxel.VoxelGrid
+	if *heightmapPath != "" {
+		var err error
+		world, err = loadHeightmap(*heightmapPath, *colorsPath, terrain.HeightmapOptions{
+			Scale:    *scale,
+			SeaLevel: int32(*seaLevel),
+			Water:    color.RGBA{R: 50, G: 100, B: 200, A: 255},
+		})
+		if err != nil {
+			fmt.Printf("Failed to load %s: %v\n", *heightmapPath, err)
+			os.Exit(1)
+		}
+	} else {
+		world = loadWorld(*worldPath)
+	}
 
 	raycastingScene := scene.RaycastingScene{
-		Voxels:                 world,
-		Camera:                 voxel.NewCamera(NUM_RAYS_X, NUM_RAYS_Y, 0.66),
-		SunPos:                 voxel.Vector3f{X: WORLD_WIDTH - 1, Y: WORLD_HEIGHT - 1, Z: 0},
-		EnableRecursiveDDA:     true,
-		EnableLighting:         true,
-		EnablePerPixelLighting: true,
+		Scene: render.Scene{
+			Voxels:                 world,
+			SunPos:                 voxel.Vector3f{X: WORLD_WIDTH - 1, Y: WORLD_HEIGHT - 1, Z: 0},
+			EnableRecursiveDDA:     true,
+			EnableLighting:         true,
+			EnablePerPixelLighting: true,
+		},
+		Camera: voxel.NewCamera(NUM_RAYS_X, NUM_RAYS_Y, 0.66),
 	}
 
 	raycastingScene.Camera.Body.Position = voxel.Vector3f{X: 16, Y: 96, Z: 16}
 
-	scene.RenderRaycastingScene(&raycastingScene, pixelColorFn, func() {}, func() {})
+	scene.RenderRaycastingScene(&raycastingScene, pixelColorFn(world), func() {}, func() {})
 }
@@ -86,10 +86,10 @@ func main() {
 			}
 		}
 
-		hit, _, _ := v.RaycastRecursiveC(rayOrigin, voxel.Direction(rayEnd, rayOrigin), raycastCallback)
+		hit := v.RaycastRecursiveC(rayOrigin, voxel.Direction(rayEnd, rayOrigin), raycastCallback)
 
 		scene.DrawSphere(rayOrigin, 0.5, rl.Green)
-		if hit != 0 {
+		if hit.Hit() {
 			scene.DrawSphere(rayEnd, 0.5, rl.Red)
 		}
 
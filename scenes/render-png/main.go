@@ -0,0 +1,250 @@
+// render-png draws one of the scenes to a PNG without opening a window
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+
+	"github.com/mmcilroy/voxel_raycaster/render"
+	"github.com/mmcilroy/voxel_raycaster/terrain"
+	"github.com/mmcilroy/voxel_raycaster/voxel"
+)
+
+var (
+	SKY_BLUE = color.RGBA{R: 102, G: 191, B: 255, A: 255}
+	BROWN    = color.RGBA{R: 127, G: 106, B: 79, A: 255}
+	GREEN    = color.RGBA{R: 0, G: 228, B: 48, A: 255}
+	BLACK    = color.RGBA{A: 255}
+)
+
+// options for building a scene, not every scene uses all of them
+type options struct {
+	Seed  int64
+	Model string
+}
+
+// setup is a scene and where the camera starts in it
+type setup struct {
+	Scene        render.Scene
+	PixelColorFn render.PixelColorFn
+	Position     voxel.Vector3f
+	Rotation     voxel.Vector2f
+}
+
+var scenes = map[string]func(options) (setup, error){
+	"pillars": pillars,
+	"voxel":   singleVoxel,
+	"perlin":  perlin,
+	"vox":     vox,
+}
+
+// faceColor is the coloring the pillars scenes use, each face by its axis
+func faceColor(hit voxel.RaycastHit, material voxel.Material) color.RGBA {
+	if !hit.Hit() {
+		return SKY_BLUE
+	}
+	switch hit.Face.Axis() {
+	case 0, 2:
+		return BROWN
+	case 1:
+		return GREEN
+	}
+	return BLACK
+}
+
+// paletteColor colors voxels from the grid's palette
+func paletteColor(grid *voxel.VoxelGrid) render.PixelColorFn {
+	return func(hit voxel.RaycastHit, material voxel.Material) color.RGBA {
+		if !hit.Hit() {
+			return SKY_BLUE
+		}
+		if int(material) < len(grid.Palette) && material != 0 {
+			return grid.Palette[material]
+		}
+		return BROWN
+	}
+}
+
+func pillars(options) (setup, error) {
+	const size = 64
+	grid := voxel.NewVoxelGrid(size, size, size, 1)
+	grid.Fill(voxel.Box{Max: voxel.Vector3f{X: size, Y: 1, Z: size}}, voxel.FILL_UNION, 0)
+	grid.Fill(voxel.Box{Min: voxel.Vector3f{X: size / 2, Z: size / 2}, Max: voxel.Vector3f{X: size/2 + 2, Y: size / 2, Z: size/2 + 2}}, voxel.FILL_UNION, 0)
+
+	return setup{
+		Scene: render.Scene{
+			Voxels:                 grid,
+			SunPos:                 voxel.Vector3f{X: size, Y: size, Z: size},
+			EnableRecursiveDDA:     true,
+			EnableLighting:         true,
+			EnablePerPixelLighting: true,
+		},
+		PixelColorFn: faceColor,
+		Position:     voxel.Vector3f{X: 8, Y: 40, Z: -4},
+		Rotation:     voxel.Vector2f{X: 0.6, Y: -0.5},
+	}, nil
+}
+
+func singleVoxel(options) (setup, error) {
+	grid := voxel.NewVoxelGrid(4, 4, 4, 1)
+	grid.SetVoxel(1, 1, 1, true)
+
+	return setup{
+		Scene: render.Scene{
+			Voxels:                 grid,
+			SunPos:                 voxel.Vector3f{X: 3, Y: 4, Z: -2},
+			EnableRecursiveDDA:     true,
+			EnableLighting:         true,
+			EnablePerPixelLighting: true,
+		},
+		PixelColorFn: faceColor,
+		Position:     voxel.Vector3f{X: -0.5, Y: 3, Z: -0.5},
+		Rotation:     voxel.Vector2f{X: 0.78, Y: -0.6},
+	}, nil
+}
+
+func perlin(options options) (setup, error) {
+	const width, height = 256, 128
+	grid := voxel.NewVoxelGrid(width, height, width, 1)
+	terrain.NewTerrain(options.Seed, height).Generate(grid)
+
+	return setup{
+		Scene: render.Scene{
+			Voxels:                 grid,
+			SunPos:                 voxel.Vector3f{X: width - 1, Y: height - 1, Z: 0},
+			EnableRecursiveDDA:     true,
+			EnableLighting:         true,
+			EnablePerPixelLighting: true,
+		},
+		PixelColorFn: paletteColor(grid),
+		Position:     voxel.Vector3f{X: 16, Y: 96, Z: 16},
+		Rotation:     voxel.Vector2f{X: 0.78, Y: -0.35},
+	}, nil
+}
+
+// vox stands a MagicaVoxel model on a floor with some room around it
+func vox(options options) (setup, error) {
+	f, err := os.Open(options.Model)
+	if err != nil {
+		return setup{}, err
+	}
+	defer f.Close()
+
+	file, err := voxel.ReadVox(f)
+	if err != nil {
+		return setup{}, err
+	}
+
+	const border = 16
+	model := voxel.NewVoxelGridFromVox(file, 1)
+	count := model.Count()
+	grid := voxel.NewVoxelGrid(count.X+border*2, count.Y+border, count.Z+border*2, 1)
+	grid.Palette = model.Palette
+	grid.Fill(voxel.Box{Max: voxel.Vector3f{X: float32(grid.NumVoxelsX), Y: 1, Z: float32(grid.NumVoxelsZ)}}, voxel.FILL_UNION, 0)
+	grid.StampGrid(model, voxel.StampOptions{
+		Offset: voxel.Vector3i{X: border, Y: 1, Z: border},
+	})
+
+	return setup{
+		Scene: render.Scene{
+			Voxels:                 grid,
+			SunPos:                 voxel.Vector3f{X: float32(grid.NumVoxelsX), Y: float32(grid.NumVoxelsY), Z: 0},
+			EnableRecursiveDDA:     true,
+			EnableLighting:         true,
+			EnablePerPixelLighting: true,
+		},
+		PixelColorFn: paletteColor(grid),
+		Position:     voxel.Vector3f{X: -float32(count.X) / 2, Y: float32(count.Y), Z: -float32(count.Z) / 2},
+		Rotation:     voxel.Vector2f{X: 0.78, Y: -0.35},
+	}, nil
+}
+
+// newSetup builds the named scene ready to render
+func newSetup(name string, options options) (setup, error) {
+	build, ok := scenes[name]
+	if !ok {
+		return setup{}, fmt.Errorf("unknown scene %q", name)
+	}
+
+	s, err := build(options)
+	if err != nil {
+		return setup{}, err
+	}
+	s.Scene.Compress()
+
+	return s, nil
+}
+
+// render draws the scene from the setup's camera at the given resolution
+func (s *setup) render(width, height int32) *image.RGBA {
+	camera := voxel.NewCamera(float32(width), float32(height), 0.66)
+	camera.Body.Position = s.Position
+	camera.Body.Rotate(s.Rotation.X, s.Rotation.Y)
+
+	return render.Render(&s.Scene, &camera, s.PixelColorFn)
+}
+
+func main() {
+	name := flag.String("scene", "pillars", "the scene to render: pillars, voxel, perlin or vox")
+	out := flag.String("out", "frame.png", "write the PNG here")
+	width := flag.Int("width", 320, "width in pixels")
+	height := flag.Int("height", 180, "height in pixels")
+	seed := flag.Int64("seed", 1, "terrain seed for the perlin scene")
+	model := flag.String("model", filepath.Join("assets", "models", "casa.vox"), "the MagicaVoxel file for the vox scene, the default is relative to the top of the repo")
+	pos := flag.String("pos", "", "put the camera here instead, as x,y,z")
+	rot := flag.String("rotate", "", "turn the camera this far left and up instead, as x,y in radians")
+	lighting := flag.String("lighting", "pixel", "light per pixel, per face or none")
+	recursive := flag.Bool("recursive", true, "trace down the mip chain instead of only at full res")
+	flag.Parse()
+
+	s, err := newSetup(*name, options{Seed: *seed, Model: *model})
+	if err != nil {
+		fmt.Printf("Failed to build %s: %v\n", *name, err)
+		os.Exit(1)
+	}
+
+	if *pos != "" {
+		if _, err := fmt.Sscanf(*pos, "%f,%f,%f", &s.Position.X, &s.Position.Y, &s.Position.Z); err != nil {
+			fmt.Printf("Invalid -pos %s: %v\n", *pos, err)
+			os.Exit(1)
+		}
+	}
+
+	if *rot != "" {
+		if _, err := fmt.Sscanf(*rot, "%f,%f", &s.Rotation.X, &s.Rotation.Y); err != nil {
+			fmt.Printf("Invalid -rotate %s: %v\n", *rot, err)
+			os.Exit(1)
+		}
+	}
+
+	switch *lighting {
+	case "pixel":
+	case "face":
+		s.Scene.EnablePerPixelLighting = false
+	case "none":
+		s.Scene.EnableLighting = false
+	default:
+		fmt.Printf("Invalid -lighting %s\n", *lighting)
+		os.Exit(1)
+	}
+	s.Scene.EnableRecursiveDDA = *recursive
+
+	img := s.render(int32(*width), int32(*height))
+
+	f, err := os.Create(*out)
+	if err != nil {
+		fmt.Printf("Failed to create %s: %v\n", *out, err)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	if err := png.Encode(f, img); err != nil {
+		fmt.Printf("Failed to write %s: %v\n", *out, err)
+		os.Exit(1)
+	}
+}
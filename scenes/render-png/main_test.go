@@ -0,0 +1,212 @@
+package main
+
+import (
+	"flag"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mmcilroy/voxel_raycaster/render"
+	"github.com/mmcilroy/voxel_raycaster/voxel"
+)
+
+var update = flag.Bool("update", false, "write what is rendered as the new golden images")
+
+const GOLDEN_WIDTH, GOLDEN_HEIGHT = 160, 90
+
+// a pixel only counts as different if a channel is more than TOLERANCE out,
+// and up to MAX_DIFF_PIXELS of them can be. float rounding isn't the same on
+// every platform so a ray can end up in the next voxel over now and then
+const TOLERANCE = 8
+const MAX_DIFF_PIXELS = 0.005
+
+var GOLDEN_DIR = filepath.Join("testdata", "golden")
+var FAILED_DIR = filepath.Join("testdata", "failed")
+
+type golden struct {
+	name     string
+	scene    string
+	options  options
+	position voxel.Vector3f
+	rotation voxel.Vector2f
+	modify   func(scene *render.Scene)
+}
+
+var goldens = []golden{
+	{
+		name:     "pillars",
+		scene:    "pillars",
+		position: voxel.Vector3f{X: 8, Y: 40, Z: -4},
+		rotation: voxel.Vector2f{X: 0.6, Y: -0.5},
+	},
+	{
+		name:     "pillars-face-lighting",
+		scene:    "pillars",
+		position: voxel.Vector3f{X: 8, Y: 40, Z: -4},
+		rotation: voxel.Vector2f{X: 0.6, Y: -0.5},
+		modify:   func(scene *render.Scene) { scene.EnablePerPixelLighting = false },
+	},
+	{
+		name:     "pillars-full-res-dda",
+		scene:    "pillars",
+		position: voxel.Vector3f{X: 8, Y: 40, Z: -4},
+		rotation: voxel.Vector2f{X: 0.6, Y: -0.5},
+		modify:   func(scene *render.Scene) { scene.EnableRecursiveDDA = false },
+	},
+	{
+		name:     "voxel",
+		scene:    "voxel",
+		position: voxel.Vector3f{X: -0.5, Y: 3, Z: -0.5},
+		rotation: voxel.Vector2f{X: 0.78, Y: -0.6},
+	},
+	{
+		name:     "voxel-no-lighting",
+		scene:    "voxel",
+		position: voxel.Vector3f{X: -0.5, Y: 3, Z: -0.5},
+		rotation: voxel.Vector2f{X: 0.78, Y: -0.6},
+		modify:   func(scene *render.Scene) { scene.EnableLighting = false },
+	},
+	{
+		name:     "perlin",
+		scene:    "perlin",
+		options:  options{Seed: 7},
+		position: voxel.Vector3f{X: 16, Y: 96, Z: 16},
+		rotation: voxel.Vector2f{X: 0.78, Y: -0.35},
+	},
+	{
+		name:     "knight",
+		scene:    "vox",
+		options:  options{Model: filepath.Join("..", "..", "assets", "models", "chr_knight.vox")},
+		position: voxel.Vector3f{X: -4, Y: 20, Z: -4},
+		rotation: voxel.Vector2f{X: 0.78, Y: -0.3},
+	},
+}
+
+// compareImages counts the pixels that are too different and draws where
+// they are in red over a faded copy of expected
+func compareImages(got, expected *image.RGBA) (int, *image.RGBA) {
+	diff := image.NewRGBA(expected.Bounds())
+	numDiffs := 0
+
+	channel := func(a, b uint8) int {
+		return max(int(a)-int(b), int(b)-int(a))
+	}
+
+	for y := 0; y < expected.Bounds().Dy(); y++ {
+		for x := 0; x < expected.Bounds().Dx(); x++ {
+			a, b := got.RGBAAt(x, y), expected.RGBAAt(x, y)
+			d := max(channel(a.R, b.R), channel(a.G, b.G), channel(a.B, b.B), channel(a.A, b.A))
+			if d > TOLERANCE {
+				numDiffs++
+				diff.SetRGBA(x, y, color.RGBA{R: uint8(128 + d/2), A: 255})
+			} else {
+				gray := uint8((int(b.R) + int(b.G) + int(b.B)) / 12)
+				diff.SetRGBA(x, y, color.RGBA{R: gray, G: gray, B: gray, A: 255})
+			}
+		}
+	}
+
+	return numDiffs, diff
+}
+
+func readPNG(path string) (*image.RGBA, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+
+	rgba := image.NewRGBA(img.Bounds())
+	for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
+		for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
+			rgba.Set(x-img.Bounds().Min.X, y-img.Bounds().Min.Y, img.At(x, y))
+		}
+	}
+	return rgba, nil
+}
+
+func writePNG(path string, img image.Image) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return png.Encode(f, img)
+}
+
+// TestGolden renders each scene and compares it with its golden image in
+// testdata/golden. when they don't match what was rendered and a diff are
+// written to testdata/failed. run with -update to accept the new images
+func TestGolden(t *testing.T) {
+	for _, g := range goldens {
+		t.Run(g.name, func(t *testing.T) {
+			s, err := newSetup(g.scene, g.options)
+			if err != nil {
+				t.Fatalf("Failed to build %s: %v\n", g.scene, err)
+			}
+			s.Position, s.Rotation = g.position, g.rotation
+			if g.modify != nil {
+				g.modify(&s.Scene)
+			}
+
+			got := s.render(GOLDEN_WIDTH, GOLDEN_HEIGHT)
+			path := filepath.Join(GOLDEN_DIR, g.name+".png")
+
+			if *update {
+				if err := writePNG(path, got); err != nil {
+					t.Fatalf("Failed to update %s: %v\n", path, err)
+				}
+				return
+			}
+
+			expected, err := readPNG(path)
+			if err != nil {
+				t.Fatalf("Failed to read %s, run with -update to create it: %v\n", path, err)
+			}
+			if !expected.Bounds().Eq(got.Bounds()) {
+				t.Fatalf("Incorrect size: %v, expected %v\n", got.Bounds(), expected.Bounds())
+			}
+
+			numDiffs, diff := compareImages(got, expected)
+			if float64(numDiffs) <= MAX_DIFF_PIXELS*float64(GOLDEN_WIDTH*GOLDEN_HEIGHT) {
+				return
+			}
+
+			gotPath, diffPath := filepath.Join(FAILED_DIR, g.name+".png"), filepath.Join(FAILED_DIR, g.name+".diff.png")
+			if err := writePNG(gotPath, got); err != nil {
+				t.Errorf("Failed to write %s: %v\n", gotPath, err)
+			}
+			if err := writePNG(diffPath, diff); err != nil {
+				t.Errorf("Failed to write %s: %v\n", diffPath, err)
+			}
+			t.Fatalf("%d pixels differ from %s, see %s and %s\n", numDiffs, path, gotPath, diffPath)
+		})
+	}
+}
+
+// the harness has to notice a change or it isn't protecting anything
+func TestCompareImages(t *testing.T) {
+	a := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	b := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	a.SetRGBA(1, 1, color.RGBA{R: TOLERANCE, A: 255})
+	b.SetRGBA(1, 1, color.RGBA{A: 255})
+	a.SetRGBA(2, 3, color.RGBA{G: TOLERANCE + 1})
+
+	numDiffs, diff := compareImages(a, b)
+	if numDiffs != 1 || diff.RGBAAt(2, 3).R < 128 || diff.RGBAAt(1, 1).R != diff.RGBAAt(1, 1).G {
+		t.Fatalf("Incorrect diff: %d %v %v\n", numDiffs, diff.RGBAAt(2, 3), diff.RGBAAt(1, 1))
+	}
+}
@@ -2,17 +2,16 @@ package scene
 
 import (
 	"fmt"
+	"image"
 	"sync"
 
 	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/mmcilroy/voxel_raycaster/render"
 	"github.com/mmcilroy/voxel_raycaster/voxel"
 )
 
 const RESOLUTION_X, RESOLUTION_Y = 1600, 900
 
-const NUM_THREADS_X = 4
-const NUM_THREADS_Y = 4
-
 func ToRlVector(v voxel.Vector3f) rl.Vector3 {
 	return rl.NewVector3(v.X, v.Y, v.Z)
 }
@@ -83,115 +82,42 @@ func RenderScene(handleInput func(), render3D func(), render2D func()) {
 func RenderVoxelScene(voxels *voxel.VoxelGrid, handleInput func(), render3D func(), render2D func()) {
 	halfSize := voxels.VoxelSize / 2
 	RenderScene(handleInput, func() {
-		for z := int32(0); z < voxels.NumVoxelsZ-1; z++ {
-			for y := int32(0); y < voxels.NumVoxelsY-1; y++ {
-				for x := int32(0); x < voxels.NumVoxelsX-1; x++ {
-					if voxels.GetVoxel(x, y, z) {
-						rl.DrawCube(rl.NewVector3(
-							voxels.VoxelSize*float32(x)+halfSize, voxels.VoxelSize*float32(y)+halfSize, voxels.VoxelSize*float32(z)+halfSize),
-							voxels.VoxelSize, voxels.VoxelSize, voxels.VoxelSize,
-							rl.NewColor(255, 0, 0, 127))
-					}
-				}
-			}
-		}
+		voxels.ForEachVoxel(voxel.Vector3i{}, voxels.Count(), func(x, y, z int32) bool {
+			rl.DrawCube(rl.NewVector3(
+				voxels.VoxelSize*float32(x)+halfSize, voxels.VoxelSize*float32(y)+halfSize, voxels.VoxelSize*float32(z)+halfSize),
+				voxels.VoxelSize, voxels.VoxelSize, voxels.VoxelSize,
+				rl.NewColor(255, 0, 0, 127))
+			return true
+		})
 		rl.DrawGrid(128, 1)
 		render3D()
 	}, render2D)
 }
 
-// would this be better named VoxelColorFn?
-// voxels are fixed color but pixel color is affected by lighting
-type PixelColorFn func(hit int32, mapPos voxel.Vector3i) rl.Color
-
-func raycastPixel(scene *RaycastingScene, x, y int32, pixelColorFn PixelColorFn) rl.Color {
-	// get the ray direction
-	plane := scene.Camera.Plane()
-	_, rayDir := scene.Camera.RayDir(&plane, int32(x), int32(y))
-
-	// decide what version of the voxel grid to use
-	voxels := scene.Voxels
-	if !scene.EnableRecursiveDDA {
-		voxels = scene.UncompressedVoxels
-	}
-
-	// fire a ray into the scene and check what we hit
-	hit, hitPos, mapPos := voxels.RaycastRecursive(scene.Camera.Body.Position, rayDir)
-
-	// get the pixel color for the voxel and face
-	color := pixelColorFn(hit, mapPos)
-
-	// if lightning is enabled and something was hit apply shadows
-	lightScale := float32(1)
-
-	// check if the hit point is visible to the sun
-	if scene.EnableLighting && hit != 0 && hit != 4 {
-
-		// if we are not lighting per pixel do it per voxel face
-		if !scene.EnablePerPixelLighting {
-			hitPos = voxel.HitFaceCenter(hit, hitPos, mapPos, scene.UncompressedVoxels.VoxelSize)
-		}
-		sunHit, sunHitPos, _ := voxels.RaycastRecursive(scene.SunPos, voxel.Direction(hitPos, scene.SunPos))
-
-		// if sun ray hits the same block and face as our initial ray calc lighting
-		if sunHit == hit && voxel.Distance(hitPos, sunHitPos) < 0.5 /*sunMapPos.Equals(mapPos)*/ {
-			lightScale = voxel.DiffuseLight(sunHit, voxel.Direction(scene.SunPos, sunHitPos))
-		} else {
-			lightScale = 0.5 // shadow
-		}
-	}
-
-	return rl.NewColor(
-		uint8(float32(color.R)*lightScale),
-		uint8(float32(color.G)*lightScale),
-		uint8(float32(color.B)*lightScale),
-		255)
-}
-
-func raycastQuad(scene *RaycastingScene, xa, xb, ya, yb int32, pixelColorFn PixelColorFn, pixels *[]rl.Color, frameWait *sync.WaitGroup) {
-	defer frameWait.Done()
-
-	for y := ya; y < yb; y++ {
-		for x := xa; x < xb; x++ {
-			// get pixel color
-			color := raycastPixel(scene, x, y, pixelColorFn)
-
-			// write into pixel buffer
-			(*pixels)[x+y*int32(scene.Camera.Resolution.X)] = color
-		}
-	}
-}
+// PixelColorFn is the same as render.PixelColorFn, rl.Color is a color.RGBA
+type PixelColorFn = render.PixelColorFn
 
-func renderSoftware(scene *RaycastingScene, frame *rl.RenderTexture2D, pixelColorFn PixelColorFn, pixels *[]rl.Color, frameWait *sync.WaitGroup) {
+func renderSoftware(scene *RaycastingScene, frame *rl.RenderTexture2D, pixelColorFn PixelColorFn, pixels *image.RGBA) {
 	rl.BeginDrawing()
 	rl.ClearBackground(rl.RayWhite)
 
-	// spread rays across threads
-	frameWait.Add(NUM_THREADS_X * NUM_THREADS_Y)
-	for ty := 0; ty < NUM_THREADS_Y; ty++ {
-		for tx := 0; tx < NUM_THREADS_X; tx++ {
-			go raycastQuad(
-				scene,
-				int32(int(scene.Camera.Resolution.X)/NUM_THREADS_X*tx),
-				int32(int(scene.Camera.Resolution.X)/NUM_THREADS_X*(tx+1)),
-				int32(int(scene.Camera.Resolution.Y)/NUM_THREADS_Y*ty),
-				int32(int(scene.Camera.Resolution.Y)/NUM_THREADS_Y*(ty+1)),
-				pixelColorFn,
-				pixels,
-				frameWait)
-		}
-	}
-	frameWait.Wait()
+	// trace the frame in software, this is exactly what render.Render gives
+	render.RenderInto(pixels, &scene.Scene, &scene.Camera, pixelColorFn)
 
 	// center pixel is red for debugging
-	cx, cy := int32(scene.Camera.Resolution.X/2), int32(scene.Camera.Resolution.Y/2)
-	(*pixels)[cx+int32(cy*scene.Camera.Resolution.X)] = rl.Red
+	cx, cy := int(scene.Camera.Resolution.X/2), int(scene.Camera.Resolution.Y/2)
+	pixels.SetRGBA(cx, cy, rl.Red)
+
+	drawFrame(frame, pixels)
+}
 
+// drawFrame copies the pixels into frame and scales it to fill the window
+func drawFrame(frame *rl.RenderTexture2D, pixels *image.RGBA) {
 	// use output color to create frame
 	rl.BeginTextureMode(*frame)
-	for ry := 0; ry < int(scene.Camera.Resolution.Y); ry++ {
-		for rx := 0; rx < int(scene.Camera.Resolution.X); rx++ {
-			rl.DrawPixel(int32(rx), int32(ry), (*pixels)[rx+ry*int(scene.Camera.Resolution.X)])
+	for ry := 0; ry < pixels.Bounds().Dy(); ry++ {
+		for rx := 0; rx < pixels.Bounds().Dx(); rx++ {
+			rl.DrawPixel(int32(rx), int32(ry), pixels.RGBAAt(rx, ry))
 		}
 	}
 	rl.EndTextureMode()
@@ -205,27 +131,48 @@ func renderSoftware(scene *RaycastingScene, frame *rl.RenderTexture2D, pixelColo
 		rl.White)
 }
 
+// frameDiffs reads back the frame that was just drawn in the window and
+// counts the pixels that differ from a headless render of the same scene.
+// the red center pixel is left out, every other pixel should be the same
+func frameDiffs(scene *RaycastingScene, frame *rl.RenderTexture2D, pixelColorFn PixelColorFn) int {
+	drawn := rl.LoadImageFromTexture(frame.Texture)
+	defer rl.UnloadImage(drawn)
+
+	// render textures are upside down
+	rl.ImageFlipVertical(drawn)
+	colors := rl.LoadImageColors(drawn)
+	defer rl.UnloadImageColors(colors)
+
+	expected := render.Render(&scene.Scene, &scene.Camera, pixelColorFn)
+	w, h := int(scene.Camera.Resolution.X), int(scene.Camera.Resolution.Y)
+
+	numDiffs := 0
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if (x != w/2 || y != h/2) && colors[x+y*w] != expected.RGBAAt(x, y) {
+				numDiffs++
+			}
+		}
+	}
+
+	return numDiffs
+}
+
+// RaycastingScene is rendered by several goroutines at once which read the
+// voxels, camera and settings. they are only changed on the main loop between
+// frames, so edits from anywhere else should be pushed to Edits which is
+// applied after preFn and before each frame is rendered.
+//
+// a scene with a World draws that instead of Voxels, loading chunks around the
+// camera between frames. a World can't be edited
 type RaycastingScene struct {
-	UncompressedVoxels     *voxel.VoxelGrid
-	Voxels                 *voxel.VoxelGrid
-	Camera                 voxel.Camera
-	SunPos                 voxel.Vector3f
-	EnableRecursiveDDA     bool
-	EnableLighting         bool
-	EnablePerPixelLighting bool
+	render.Scene
+	Camera voxel.Camera
+	Edits  voxel.EditQueue
 }
 
 func RenderRaycastingScene(scene *RaycastingScene, pixelColorFn PixelColorFn, preFn func(), postFn func()) {
-	// compress voxels
-	for scene.Voxels.NumVoxelsY > 2 {
-		scene.Voxels = scene.Voxels.Compress()
-	}
-
-	// also keep uncompressed handy
-	scene.UncompressedVoxels = scene.Voxels
-	for scene.UncompressedVoxels.Parent != nil {
-		scene.UncompressedVoxels = scene.UncompressedVoxels.Parent
-	}
+	scene.Compress()
 
 	rl.SetConfigFlags(rl.FlagMsaa4xHint)
 	rl.InitWindow(RESOLUTION_X, RESOLUTION_Y, "")
@@ -233,47 +180,14 @@ func RenderRaycastingScene(scene *RaycastingScene, pixelColorFn PixelColorFn, pr
 
 	rl.DisableCursor()
 
-	// indicates when frame is complete
-	var frameWait sync.WaitGroup
-
 	// the color for each pixel (cpu only)
-	pixels := make([]rl.Color, int(scene.Camera.Resolution.X*scene.Camera.Resolution.Y))
+	pixels := image.NewRGBA(image.Rect(0, 0, int(scene.Camera.Resolution.X), int(scene.Camera.Resolution.Y)))
 
 	// the frame that will be displayed (cpu only)
 	texture := rl.LoadRenderTexture(int32(scene.Camera.Resolution.X), int32(scene.Camera.Resolution.Y))
 
 	for !rl.WindowShouldClose() {
-		// character controls
-		var moveForward, moveSide, moveUp float32
-
-		speed := 5 * rl.GetFrameTime() * 1
-		if rl.IsKeyDown(rl.KeyLeftShift) {
-			speed *= 10
-		}
-
-		if rl.IsKeyDown('W') {
-			moveForward += speed
-		}
-
-		if rl.IsKeyDown('S') {
-			moveForward -= speed
-		}
-
-		if rl.IsKeyDown('A') {
-			moveSide -= speed
-		}
-
-		if rl.IsKeyDown('D') {
-			moveSide += speed
-		}
-
-		if rl.IsKeyDown(rl.KeySpace) {
-			moveUp += speed
-		}
-
-		if rl.IsKeyDown(rl.KeyLeftControl) {
-			moveUp -= speed
-		}
+		speed := moveSpeed()
 
 		//  rendering controls
 		if rl.IsKeyPressed('L') {
@@ -307,15 +221,35 @@ func RenderRaycastingScene(scene *RaycastingScene, pixelColorFn PixelColorFn, pr
 		// allows us to debug raycasting for the center pixel
 		if rl.IsKeyPressed('T') {
 			cx, cy := int32(scene.Camera.Resolution.X/2), int32(scene.Camera.Resolution.Y/2)
-			raycastPixel(scene, cx, cy, pixelColorFn)
+			render.Pixel(&scene.Scene, &scene.Camera, cx, cy, pixelColorFn)
 		}
 
-		// move and rotate camera
-		mouseDelta := rl.GetMouseDelta()
-		scene.Camera.Body.Rotate(mouseDelta.X*-0.003, mouseDelta.Y*-0.003)
+		// dig out or build onto the voxel under the center pixel
+		if scene.World == nil && (rl.IsMouseButtonPressed(rl.MouseButtonLeft) || rl.IsMouseButtonPressed(rl.MouseButtonRight)) {
+			plane := scene.Camera.Plane()
+			_, rayDir := scene.Camera.RayDir(&plane, scene.Camera.Resolution.X/2, scene.Camera.Resolution.Y/2)
+			hit := scene.Voxels.RaycastRecursive(scene.Camera.Body.Position, rayDir)
+			mapPos := hit.MapPos
+
+			// made along with any other edits before the next frame
+			if hit.Status == voxel.RAYCAST_HIT {
+				if rl.IsMouseButtonPressed(rl.MouseButtonLeft) {
+					scene.Edits.Push(func(grid *voxel.VoxelGrid) {
+						grid.SetVoxel(mapPos.X, mapPos.Y, mapPos.Z, false)
+					})
+				} else {
+					pos := mapPos.ToVector3f().Plus(hit.Normal).ToVector3i()
+					scene.Edits.Push(func(grid *voxel.VoxelGrid) {
+						if grid.Contains(pos.X, pos.Y, pos.Z) {
+							grid.SetVoxel(pos.X, pos.Y, pos.Z, true)
+						}
+					})
+				}
+			}
+		}
 
 		//prevPos := scene.Camera.Body.Position
-		scene.Camera.Body.Move(moveForward, moveSide, moveUp)
+		moveCamera(&scene.Camera, speed)
 
 		// move to new position as long as there isn't a voxel there
 		//if scene.UncompressedVoxels.RectangleIntersects(scene.Camera.Body.Position, 1, 2) {
@@ -324,7 +258,20 @@ func RenderRaycastingScene(scene *RaycastingScene, pixelColorFn PixelColorFn, pr
 
 		preFn()
 
-		renderSoftware(scene, &texture, pixelColorFn, &pixels, &frameWait)
+		// nothing is reading the voxels until the frame starts
+		if scene.World != nil {
+			scene.World.Update(scene.Camera.Body.Position)
+		} else {
+			scene.Edits.Apply(scene.UncompressedVoxels)
+		}
+
+		renderSoftware(scene, &texture, pixelColorFn, pixels)
+
+		// see whether the window shows the same as a headless render would,
+		// TestFrameMatchesRender checks this automatically
+		if rl.IsKeyPressed('V') {
+			fmt.Printf("Frame check: %d pixels differ from render.Render\n", frameDiffs(scene, &texture, pixelColorFn))
+		}
 
 		rl.DrawFPS(20, 20)
 		rl.DrawText(fmt.Sprintf("%.02f, %.02f, %.02f, %.02f, %.02f", scene.Camera.Body.Position.X, scene.Camera.Body.Position.Y, scene.Camera.Body.Position.Z, scene.Camera.Body.Rotation.X, scene.Camera.Body.Rotation.Y), 20, 40, 20, rl.White)
@@ -335,3 +282,93 @@ func RenderRaycastingScene(scene *RaycastingScene, pixelColorFn PixelColorFn, pr
 		rl.EndDrawing()
 	}
 }
+
+// moveSpeed is how far to move this frame, further with shift held down
+func moveSpeed() float32 {
+	speed := 5 * rl.GetFrameTime() * 1
+	if rl.IsKeyDown(rl.KeyLeftShift) {
+		speed *= 10
+	}
+	return speed
+}
+
+// moveCamera moves the camera with the character controls and rotates it
+// with the mouse
+func moveCamera(camera *voxel.Camera, speed float32) {
+	var moveForward, moveSide, moveUp float32
+
+	if rl.IsKeyDown('W') {
+		moveForward += speed
+	}
+
+	if rl.IsKeyDown('S') {
+		moveForward -= speed
+	}
+
+	if rl.IsKeyDown('A') {
+		moveSide -= speed
+	}
+
+	if rl.IsKeyDown('D') {
+		moveSide += speed
+	}
+
+	if rl.IsKeyDown(rl.KeySpace) {
+		moveUp += speed
+	}
+
+	if rl.IsKeyDown(rl.KeyLeftControl) {
+		moveUp -= speed
+	}
+
+	// move and rotate camera
+	mouseDelta := rl.GetMouseDelta()
+	camera.Body.Rotate(mouseDelta.X*-0.003, mouseDelta.Y*-0.003)
+	camera.Body.Move(moveForward, moveSide, moveUp)
+}
+
+// RenderTracerScene draws what tracer hits from camera in software, for
+// voxels that aren't kept in a VoxelGrid. there is no lighting, colorFn
+// gives the color of each pixel
+func RenderTracerScene(tracer voxel.Tracer, camera voxel.Camera, colorFn func(hit voxel.RaycastHit) rl.Color) {
+	rl.InitWindow(RESOLUTION_X, RESOLUTION_Y, "")
+	defer rl.CloseWindow()
+
+	rl.DisableCursor()
+
+	pixels := image.NewRGBA(image.Rect(0, 0, int(camera.Resolution.X), int(camera.Resolution.Y)))
+	texture := rl.LoadRenderTexture(int32(camera.Resolution.X), int32(camera.Resolution.Y))
+
+	for !rl.WindowShouldClose() {
+		moveCamera(&camera, moveSpeed())
+
+		rl.BeginDrawing()
+		rl.ClearBackground(rl.RayWhite)
+
+		// each thread traces every NUM_THREADS row
+		const NUM_THREADS = render.NUM_THREADS_X * render.NUM_THREADS_Y
+		plane := camera.Plane()
+		var frameWait sync.WaitGroup
+		frameWait.Add(NUM_THREADS)
+		for t := int32(0); t < NUM_THREADS; t++ {
+			go func(t int32) {
+				defer frameWait.Done()
+				for y := t; y < camera.Resolution.Y; y += NUM_THREADS {
+					for x := int32(0); x < camera.Resolution.X; x++ {
+						_, rayDir := camera.RayDir(&plane, x, y)
+						hit := tracer.Trace(voxel.TraceParams{RayStart: camera.Body.Position, RayDir: rayDir})
+						pixels.SetRGBA(int(x), int(y), colorFn(hit))
+					}
+				}
+			}(t)
+		}
+		frameWait.Wait()
+
+		drawFrame(&texture, pixels)
+
+		rl.DrawFPS(20, 20)
+		rl.DrawText(fmt.Sprintf("%.02f, %.02f, %.02f, %.02f, %.02f", camera.Body.Position.X, camera.Body.Position.Y, camera.Body.Position.Z, camera.Body.Rotation.X, camera.Body.Rotation.Y), 20, 40, 20, rl.White)
+
+		rl.EndDrawing()
+	}
+}
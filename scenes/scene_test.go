@@ -0,0 +1,126 @@
+package scene
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"runtime"
+	"testing"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/mmcilroy/voxel_raycaster/render"
+	"github.com/mmcilroy/voxel_raycaster/voxel"
+)
+
+// some platforms only allow windows on the main thread, tests run on other
+// goroutines so they hand raylib calls to TestMain to make
+var mainThread = make(chan func())
+
+func init() {
+	runtime.LockOSThread()
+}
+
+func TestMain(m *testing.M) {
+	done := make(chan int)
+	go func() {
+		done <- m.Run()
+	}()
+
+	for {
+		select {
+		case fn := <-mainThread:
+			fn()
+		case code := <-done:
+			os.Exit(code)
+		}
+	}
+}
+
+// onMainThread runs fn on the main thread and waits for it to finish
+func onMainThread(fn func()) {
+	ran := make(chan struct{})
+	mainThread <- func() {
+		defer close(ran)
+		fn()
+	}
+	<-ran
+}
+
+// hasDisplay is whether a window can be opened at all, on linux and the BSDs
+// there has to be an X or Wayland server
+func hasDisplay() bool {
+	switch runtime.GOOS {
+	case "windows", "darwin":
+		return true
+	}
+	return os.Getenv("DISPLAY") != "" || os.Getenv("WAYLAND_DISPLAY") != ""
+}
+
+// the window draws every frame through a render texture, reading it back has
+// to give exactly what render.Render does for the same scene
+func TestFrameMatchesRender(t *testing.T) {
+	if !hasDisplay() {
+		t.Skip("no display to open a window on")
+	}
+
+	const size = 64
+	grid := voxel.NewVoxelGrid(size, size, size, 1)
+	grid.Fill(voxel.Box{Max: voxel.Vector3f{X: size, Y: 1, Z: size}}, voxel.FILL_UNION, 0)
+	grid.Fill(voxel.Box{Min: voxel.Vector3f{X: size / 2, Z: size / 2}, Max: voxel.Vector3f{X: size/2 + 2, Y: size / 2, Z: size/2 + 2}}, voxel.FILL_UNION, 0)
+
+	scene := RaycastingScene{
+		Scene: render.Scene{
+			Voxels:                 grid,
+			SunPos:                 voxel.Vector3f{X: size, Y: size, Z: size},
+			EnableRecursiveDDA:     true,
+			EnableLighting:         true,
+			EnablePerPixelLighting: true,
+		},
+		Camera: voxel.NewCamera(160, 90, 0.66),
+	}
+	scene.Compress()
+	scene.Camera.Body.Position = voxel.Vector3f{X: 8, Y: 40, Z: -4}
+	scene.Camera.Body.Rotate(0.6, -0.5)
+
+	pixelColorFn := func(hit voxel.RaycastHit, material voxel.Material) color.RGBA {
+		if !hit.Hit() {
+			return rl.SkyBlue
+		}
+		if hit.Face.Axis() == 1 {
+			return rl.Green
+		}
+		return rl.Brown
+	}
+
+	settings := []struct {
+		name   string
+		modify func(scene *render.Scene)
+	}{
+		{"pixel-lighting", func(scene *render.Scene) {}},
+		{"face-lighting", func(scene *render.Scene) { scene.EnablePerPixelLighting = false }},
+		{"full-res-dda", func(scene *render.Scene) { scene.EnableRecursiveDDA = false }},
+	}
+
+	onMainThread(func() {
+		rl.SetConfigFlags(rl.FlagWindowHidden)
+		rl.InitWindow(RESOLUTION_X, RESOLUTION_Y, "")
+		defer rl.CloseWindow()
+
+		pixels := image.NewRGBA(image.Rect(0, 0, int(scene.Camera.Resolution.X), int(scene.Camera.Resolution.Y)))
+		texture := rl.LoadRenderTexture(int32(scene.Camera.Resolution.X), int32(scene.Camera.Resolution.Y))
+		defer rl.UnloadRenderTexture(texture)
+
+		base := scene.Scene
+		for _, s := range settings {
+			scene.Scene = base
+			s.modify(&scene.Scene)
+
+			renderSoftware(&scene, &texture, pixelColorFn, pixels)
+			rl.EndDrawing()
+
+			if numDiffs := frameDiffs(&scene, &texture, pixelColorFn); numDiffs != 0 {
+				t.Errorf("%s: %d pixels differ from render.Render\n", s.name, numDiffs)
+			}
+		}
+	})
+}
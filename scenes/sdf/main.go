@@ -5,6 +5,7 @@ import (
 
 	rl "github.com/gen2brain/raylib-go/raylib"
 	scene "github.com/mmcilroy/voxel_raycaster/scenes"
+	"github.com/mmcilroy/voxel_raycaster/terrain"
 	"github.com/mmcilroy/voxel_raycaster/voxel"
 )
 
@@ -49,59 +50,19 @@ func readInput() {
 func initPerlinWorld(w, h int32) *voxel.VoxelGrid {
 	world := voxel.NewVoxelGrid(w, h, w, 1.0)
 
-	perlinNoise := rl.GenImagePerlinNoise(int(world.NumVoxelsX), int(world.NumVoxelsZ), 0, 0, 0.5)
-	colors := rl.LoadImageColors(perlinNoise)
-	maxHeight := float32(0.0)
-
-	for z := int32(0); z < world.NumVoxelsZ; z++ {
-		for x := int32(0); x < world.NumVoxelsX; x++ {
-			color := colors[x+z*world.NumVoxelsX]
-			height := float32(color.R) / 255.0 * float32(world.NumVoxelsY)
-			if height > float32(maxHeight) {
-				maxHeight = height
-			}
-			for y := int32(0); y < int32(height)+1; y++ {
-				world.SetVoxel(x, y, z, true)
-			}
-		}
-	}
+	// a plain heightmap with hills small enough to fit the world
+	t := terrain.NewTerrain(1, h)
+	t.Wavelength = 16
+	t.Overhang, t.CaveSize, t.Water = 0, 0, 0
+	t.Generate(world)
 
 	return world
 }
 
-func calcDistance(voxels *voxel.VoxelGrid, x, y, z int32) float32 {
-	if voxels.GetVoxel(x, y, z) {
-		return 0
-	}
-
-	v1 := voxel.Vector3f{X: float32(x), Y: float32(y), Z: float32(z)}
-	minDist := float32(999999999.0)
-	for iy := int32(0); iy < voxels.NumVoxelsY-1; iy++ {
-		for iz := int32(0); iz < voxels.NumVoxelsZ-1; iz++ {
-			for ix := int32(0); ix < voxels.NumVoxelsX-1; ix++ {
-				if voxels.GetVoxel(ix, iy, iz) {
-					v2 := voxel.Vector3f{X: float32(ix), Y: float32(iy), Z: float32(iz)}
-					dist := voxel.Distance(v1, v2)
-					if dist < minDist {
-						minDist = dist
-					}
-				}
-			}
-		}
-	}
-
-	return minDist
-}
-
-func getDistance(voxels *voxel.VoxelGrid, sdf *[]float32, rayStart voxel.Vector3f) float32 {
-	i := rayStart.ToVector3i()
-	return (*sdf)[i.X+i.Y*voxels.NumVoxelsX+i.Z*voxels.NumVoxelsX*voxels.NumVoxelsY]
-}
-
-func trace(voxels *voxel.VoxelGrid, sdf *[]float32, rayStart, rayDir voxel.Vector3f) {
+func trace(sdf *voxel.DistanceField, rayStart, rayDir voxel.Vector3f) {
 	for s := 0; s < 16; s++ {
 		scene.DrawSphere(rayStart, 0.25, rl.Black)
-		d := getDistance(voxels, sdf, rayStart)
+		d := sdf.Distance(rayStart)
 		if d <= 0 {
 			break
 		}
@@ -111,47 +72,23 @@ func trace(voxels *voxel.VoxelGrid, sdf *[]float32, rayStart, rayDir voxel.Vecto
 }
 
 func main() {
-	voxels := initPerlinWorld(16, 16)
-
-	sdf := make([]float32, voxels.NumVoxelsX*voxels.NumVoxelsY*voxels.NumVoxelsZ)
-	minDist := float32(999999999.0)
-	maxDist := float32(0.0)
-
-	for y := int32(0); y < voxels.NumVoxelsY-1; y++ {
-		fmt.Println(y)
-		for z := int32(0); z < voxels.NumVoxelsZ-1; z++ {
-			for x := int32(0); x < voxels.NumVoxelsX-1; x++ {
-				dist := calcDistance(voxels, x, y, z)
-				if dist < 0 {
-					dist = 0
-				}
-				if dist < minDist {
-					minDist = dist
-				}
-				if dist > maxDist {
-					maxDist = dist
-				}
-				sdf[x+y*voxels.NumVoxelsX+z*voxels.NumVoxelsX*voxels.NumVoxelsY] = dist
-			}
-		}
-	}
+	voxels := initPerlinWorld(32, 16)
+
+	sdf := voxel.NewDistanceFieldFromGrid(voxels, false)
 
 	scene.RenderScene(readInput, func() {
 
-		for y := int32(0); y < voxels.NumVoxelsY-1; y++ {
-			for z := int32(0); z < voxels.NumVoxelsZ-1; z++ {
-				for x := int32(0); x < voxels.NumVoxelsX-1; x++ {
-					if voxels.GetVoxel(x, y, z) {
-						scene.DrawVoxel(x, y, z, 1, rl.NewColor(0, 255, 0, 255))
-						scene.DrawVoxelOutline(x, y, z, 1, rl.Black)
-					}
-				}
-			}
-		}
+		last := voxels.Count()
+		voxels.ForEachVoxel(voxel.Vector3i{}, voxel.Vector3i{X: last.X - 1, Y: last.Y - 1, Z: last.Z - 1}, func(x, y, z int32) bool {
+			scene.DrawVoxel(x, y, z, 1, rl.NewColor(0, 255, 0, 255))
+			scene.DrawVoxelOutline(x, y, z, 1, rl.Black)
+			return true
+		})
 
-		//trace(voxels, &sdf, rayOrigin, voxel.Direction(rayEnd, rayOrigin))
+		//trace(sdf, rayOrigin, voxel.Direction(rayEnd, rayOrigin))
 
-		d := getDistance(voxels, &sdf, rayOrigin)
+		d := sdf.Distance(rayOrigin)
+		displayDist = d
 		scene.DrawSphere(rayOrigin, 0.25, rl.Black)
 		rl.DrawSphereWires(rl.NewVector3(rayOrigin.X, rayOrigin.Y, rayOrigin.Z), d, 10, 10, rl.Red)
 
@@ -2,6 +2,7 @@ package main
 
 import (
 	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/mmcilroy/voxel_raycaster/render"
 	scene "github.com/mmcilroy/voxel_raycaster/scenes"
 	"github.com/mmcilroy/voxel_raycaster/voxel"
 )
@@ -50,34 +51,29 @@ func preUpdate() {
 	}
 }
 
-func pixelColorFn(hit int32, mapPos voxel.Vector3i) rl.Color {
+func pixelColorFn(hit voxel.RaycastHit, material voxel.Material) rl.Color {
 	color := rl.Black
-	if hit == 1 || hit == -1 {
+	if !hit.Hit() {
+		color = rl.SkyBlue
+	} else if hit.Face.Axis() == 0 {
 		color = rl.Brown
-	} else if hit == 2 || hit == -2 {
+	} else if hit.Face.Axis() == 1 {
 		color = rl.Green
-	} else if hit == 3 || hit == -3 {
+	} else if hit.Face.Axis() == 2 {
 		color = rl.Brown
-	} else if hit == 0 {
-		color = rl.SkyBlue
 	}
 	return color
 }
 
 func column(world *voxel.VoxelGrid, x, y, z int32) {
-	for h := int32(0); h < y; h++ {
-		world.SetVoxel(x, h, z, true)
-	}
+	base := voxel.Vector3i{X: x, Y: 0, Z: z}.ToVector3f()
+	world.Fill(voxel.Box{Min: base, Max: base.Plus(voxel.Vector3f{X: 1, Y: float32(y), Z: 1})}, voxel.FILL_UNION, 0)
 }
 
 func initWorld() *voxel.VoxelGrid {
 	var world = voxel.NewVoxelGrid(WORLD_SIZE, WORLD_SIZE, WORLD_SIZE, VOXEL_SIZE)
 
-	for z := int32(0); z < world.NumVoxelsZ; z++ {
-		for x := int32(0); x < world.NumVoxelsX; x++ {
-			world.SetVoxel(x, 0, z, true)
-		}
-	}
+	world.Fill(voxel.Box{Max: voxel.Vector3f{X: float32(world.NumVoxelsX), Y: 1, Z: float32(world.NumVoxelsZ)}}, voxel.FILL_UNION, 0)
 
 	center := int32(WORLD_SIZE / 2)
 
@@ -100,12 +96,14 @@ func initWorld() *voxel.VoxelGrid {
 
 func main() {
 	raycastingScene = scene.RaycastingScene{
-		Voxels:                 initWorld(),
-		Camera:                 voxel.NewCamera(NUM_RAYS_X, NUM_RAYS_Y, 0.66),
-		SunPos:                 voxel.Vector3f{X: WORLD_SIZE - 1, Y: WORLD_SIZE - 1, Z: 0},
-		EnableRecursiveDDA:     true,
-		EnableLighting:         true,
-		EnablePerPixelLighting: true,
+		Scene: render.Scene{
+			Voxels:                 initWorld(),
+			SunPos:                 voxel.Vector3f{X: WORLD_SIZE - 1, Y: WORLD_SIZE - 1, Z: 0},
+			EnableRecursiveDDA:     true,
+			EnableLighting:         true,
+			EnablePerPixelLighting: true,
+		},
+		Camera: voxel.NewCamera(NUM_RAYS_X, NUM_RAYS_Y, 0.66),
 	}
 
 	raycastingScene.Camera.Body.Position = voxel.Vector3f{X: 1, Y: 2, Z: 1}
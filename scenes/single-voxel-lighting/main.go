@@ -47,24 +47,24 @@ func main() {
 		for _, pos := range positions {
 			// are we hitting the voxel
 			dir := voxel.Direction(lookAt, pos)
-			hit, hitPos, _ := voxels.Raycast(pos, dir)
+			hit := voxels.Raycast(pos, dir)
 
 			// calc the light value for the hit
-			if hit != 0 {
+			if hit.Hit() {
 				// default unlit
 				color := rl.Black
 
 				// is the hit point visible to the sun
-				sunDir := voxel.Direction(hitPos, sunPos)
-				sunHit, sunHitPos, _ := voxels.Raycast(sunPos, sunDir)
+				sunDir := voxel.Direction(hit.HitPos, sunPos)
+				sunHit := voxels.Raycast(sunPos, sunDir)
 
 				// if visible calc diffuse light
-				if sunHit == hit {
-					diffuseLight := voxel.DiffuseLight(sunHit, voxel.Direction(sunPos, sunHitPos))
+				if sunHit.Face == hit.Face {
+					diffuseLight := voxel.DiffuseLight(sunHit.Face, voxel.Direction(sunPos, sunHit.HitPos))
 					color = rl.NewColor(uint8(255*diffuseLight), uint8(255*diffuseLight), uint8(255*diffuseLight), 255)
 				}
 
-				scene.DrawSphere(sunHitPos, 0.5, color)
+				scene.DrawSphere(sunHit.HitPos, 0.5, color)
 				scene.DrawSphere(sunPos, 1.0, rl.Yellow)
 				scene.DrawRay(sunPos, sunDir, rl.SkyBlue)
 			}
@@ -68,8 +68,9 @@ func main() {
 			ro := voxel.Vector3f{X: pos.X, Y: pos.Y, Z: pos.Z}
 			rd := voxel.Vector3f{X: dir.X, Y: dir.Y, Z: dir.Z}
 
-			hit, hitPos, voxelPos := voxels.Raycast(ro, rd)
-			if hit != 0 {
+			hit := voxels.Raycast(ro, rd)
+			hitPos, voxelPos := hit.HitPos, hit.MapPos
+			if hit.Hit() {
 				rl.DrawSphere(rl.NewVector3(hitPos.X, hitPos.Y, hitPos.Z), 0.2, rl.Yellow)
 			} else {
 				fmt.Println("Miss!")
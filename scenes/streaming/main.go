@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/mmcilroy/voxel_raycaster/render"
+	scene "github.com/mmcilroy/voxel_raycaster/scenes"
+	"github.com/mmcilroy/voxel_raycaster/terrain"
+	"github.com/mmcilroy/voxel_raycaster/voxel"
+)
+
+const CHUNK_SIZE, WORLD_HEIGHT = 64, 128
+
+const NUM_RAYS_X, NUM_RAYS_Y = 320, 180
+
+func main() {
+	seed := flag.Int64("seed", 1, "terrain seed")
+	radius := flag.Int("radius", 4, "load chunks this many chunks around the camera")
+	fog := flag.Bool("fog", true, "draw chunks that aren't loaded yet as fog instead of empty space")
+	flag.Parse()
+
+	land := terrain.NewTerrain(*seed, WORLD_HEIGHT)
+	world := voxel.NewStreamingWorld(CHUNK_SIZE, WORLD_HEIGHT, 1.0, int32(*radius), func(chunk *voxel.VoxelGrid, origin voxel.Vector3i) {
+		land.GenerateAt(chunk, origin.X, origin.Z)
+	})
+	defer world.Close()
+	world.Fog = *fog
+
+	raycastingScene := scene.RaycastingScene{
+		Scene: render.Scene{
+			World:                  world,
+			FogColor:               rl.SkyBlue,
+			SunPos:                 voxel.Vector3f{X: 1, Y: 2, Z: -1},
+			EnableLighting:         true,
+			EnablePerPixelLighting: true,
+		},
+		Camera: voxel.NewCamera(NUM_RAYS_X, NUM_RAYS_Y, 0.66),
+	}
+
+	raycastingScene.Camera.Body.Position = voxel.Vector3f{X: 0, Y: 96, Z: 0}
+
+	scene.RenderRaycastingScene(&raycastingScene, func(hit voxel.RaycastHit, material voxel.Material) rl.Color {
+		if !hit.Hit() {
+			return rl.SkyBlue
+		}
+		if int(material) < len(land.Palette) && material != 0 {
+			return land.Palette[material]
+		}
+		return rl.Brown
+	}, func() {}, func() {})
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/mmcilroy/voxel_raycaster/render"
 	scene "github.com/mmcilroy/voxel_raycaster/scenes"
 	"github.com/mmcilroy/voxel_raycaster/voxel"
 )
@@ -24,11 +25,15 @@ func preUpdate() {
 	}
 
 	if rl.IsKeyPressed(rl.KeyEqual) {
-		raycastingScene.UncompressedVoxels.VoxelSize *= 2
+		raycastingScene.Edits.Push(func(grid *voxel.VoxelGrid) {
+			grid.VoxelSize *= 2
+		})
 	}
 
 	if rl.IsKeyPressed(rl.KeyMinus) {
-		raycastingScene.UncompressedVoxels.VoxelSize /= 2
+		raycastingScene.Edits.Push(func(grid *voxel.VoxelGrid) {
+			grid.VoxelSize /= 2
+		})
 	}
 }
 
@@ -36,16 +41,16 @@ func postUpdate() {
 	rl.DrawText(fmt.Sprintf("Size: %.02f", raycastingScene.UncompressedVoxels.VoxelSize), 20, 80, 20, rl.White)
 }
 
-func pixelColorFn(hit int32, mapPos voxel.Vector3i) rl.Color {
+func pixelColorFn(hit voxel.RaycastHit, material voxel.Material) rl.Color {
 	color := rl.Black
-	if hit == 1 || hit == -1 {
+	if !hit.Hit() {
+		color = rl.SkyBlue
+	} else if hit.Face.Axis() == 0 {
 		color = rl.Brown
-	} else if hit == 2 || hit == -2 {
+	} else if hit.Face.Axis() == 1 {
 		color = rl.Green
-	} else if hit == 3 || hit == -3 {
+	} else if hit.Face.Axis() == 2 {
 		color = rl.Brown
-	} else if hit == 0 {
-		color = rl.SkyBlue
 	}
 	return color
 }
@@ -61,12 +66,14 @@ func initWorld() *voxel.VoxelGrid {
 
 func main() {
 	raycastingScene = scene.RaycastingScene{
-		Voxels:                 initWorld(),
-		Camera:                 voxel.NewCamera(NUM_RAYS_X, NUM_RAYS_Y, 0.66),
-		SunPos:                 voxel.Vector3f{X: WORLD_SIZE - 1, Y: WORLD_SIZE - 1, Z: 0},
-		EnableRecursiveDDA:     false,
-		EnableLighting:         false,
-		EnablePerPixelLighting: true,
+		Scene: render.Scene{
+			Voxels:                 initWorld(),
+			SunPos:                 voxel.Vector3f{X: WORLD_SIZE - 1, Y: WORLD_SIZE - 1, Z: 0},
+			EnableRecursiveDDA:     false,
+			EnableLighting:         false,
+			EnablePerPixelLighting: true,
+		},
+		Camera: voxel.NewCamera(NUM_RAYS_X, NUM_RAYS_Y, 0.66),
 	}
 
 	raycastingScene.Camera.Body.Position = voxel.Vector3f{X: -1, Y: 1, Z: -1}
@@ -105,7 +105,7 @@ func main() {
 		scene.DrawVoxel(vx, vy, vz, 1, rl.Black)
 		scene.DrawSphere(rayOrigin, 0.5, rl.Green)
 		scene.DrawSphere(rayEnd, 0.5, rl.Blue)
-		if result.Hit {
+		if result.Hit() {
 			scene.DrawSphere(result.HitPos, 0.5, rl.Red)
 		}
 
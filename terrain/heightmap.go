@@ -0,0 +1,141 @@
+package terrain
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/mmcilroy/voxel_raycaster/voxel"
+)
+
+// HeightmapOptions say how a heightmap image becomes voxels
+type HeightmapOptions struct {
+	// voxels of height for white, 0 makes white the top of a 256 voxel grid
+	Scale float64
+
+	// empty voxels below SeaLevel are filled with water of this color, a
+	// SeaLevel of 0 means no water
+	SeaLevel int32
+	Water    color.RGBA
+
+	// Colors is an optional image the same size as the heightmap, each
+	// column of voxels gets a Material for the color of its pixel
+	Colors image.Image
+}
+
+// the most colors kept exactly, images with more have them rounded to 5
+// bits a channel so they fit in a Material
+const heightmapMaxColors = 65534
+
+// NewGridFromHeightmap turns a grayscale image into a grid one column of
+// voxels per pixel, brighter pixels are higher. 16 bit images keep their
+// precision and color images use their brightness. image x, y becomes grid
+// x, z
+func NewGridFromHeightmap(heights image.Image, voxelSize float32, options HeightmapOptions) (*voxel.VoxelGrid, error) {
+	bounds := heights.Bounds()
+	if options.Colors != nil && options.Colors.Bounds().Size() != bounds.Size() {
+		return nil, fmt.Errorf("heightmap is %v but colors are %v", bounds.Size(), options.Colors.Bounds().Size())
+	}
+
+	scale := options.Scale
+	if scale <= 0 {
+		scale = 255
+	}
+
+	// every column has at least one voxel so the height goes up to scale
+	numVoxelsY := max(int32(math.Floor(scale))+1, options.SeaLevel)
+	grid := voxel.NewVoxelGrid(int32(bounds.Dx()), numVoxelsY, int32(bounds.Dy()), voxelSize)
+
+	materials := heightmapMaterials(options.Colors)
+	grid.Palette = make([]color.RGBA, 1, len(materials.palette)+2)
+	grid.Palette = append(grid.Palette, materials.palette...)
+
+	water := voxel.Material(0)
+	if options.SeaLevel > 0 {
+		water = voxel.Material(len(grid.Palette))
+		grid.Palette = append(grid.Palette, options.Water)
+	}
+
+	for z := int32(0); z < grid.NumVoxelsZ; z++ {
+		for x := int32(0); x < grid.NumVoxelsX; x++ {
+			px, py := bounds.Min.X+int(x), bounds.Min.Y+int(z)
+
+			v := color.Gray16Model.Convert(heights.At(px, py)).(color.Gray16).Y
+			top := min(int32(math.Round(float64(v)/65535*scale)), grid.NumVoxelsY-1)
+
+			m := voxel.Material(0)
+			if options.Colors != nil {
+				cb := options.Colors.Bounds()
+				m = materials.get(options.Colors.At(cb.Min.X+int(x), cb.Min.Y+int(z)))
+			}
+
+			for y := int32(0); y <= top; y++ {
+				if m != 0 {
+					grid.SetMaterial(x, y, z, m)
+				} else {
+					grid.SetVoxel(x, y, z, true)
+				}
+			}
+			for y := top + 1; y < options.SeaLevel; y++ {
+				grid.SetMaterial(x, y, z, water)
+			}
+		}
+	}
+
+	return grid, nil
+}
+
+// heightmapPalette gives each color in an image a Material, starting at 1
+type heightmapPalette struct {
+	materials map[color.RGBA]voxel.Material
+	palette   []color.RGBA
+	quantize  bool
+}
+
+func heightmapMaterials(img image.Image) *heightmapPalette {
+	p := &heightmapPalette{materials: map[color.RGBA]voxel.Material{}}
+	if img == nil {
+		return p
+	}
+
+	bounds := img.Bounds()
+	for pass := 0; pass < 2; pass++ {
+		p.materials, p.palette = map[color.RGBA]voxel.Material{}, nil
+
+		full := false
+		for y := bounds.Min.Y; y < bounds.Max.Y && !full; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X && !full; x++ {
+				c := p.key(img.At(x, y))
+				if _, ok := p.materials[c]; ok {
+					continue
+				}
+				if full = len(p.palette) == heightmapMaxColors; !full {
+					p.palette = append(p.palette, c)
+					p.materials[c] = voxel.Material(len(p.palette))
+				}
+			}
+		}
+
+		// too many colors, go round again with fewer
+		if !full || p.quantize {
+			break
+		}
+		p.quantize = true
+	}
+
+	return p
+}
+
+func (p *heightmapPalette) key(c color.Color) color.RGBA {
+	rgba := color.RGBAModel.Convert(c).(color.RGBA)
+	rgba.A = 255
+	if p.quantize {
+		rgba.R, rgba.G, rgba.B = rgba.R&0xf8, rgba.G&0xf8, rgba.B&0xf8
+	}
+	return rgba
+}
+
+func (p *heightmapPalette) get(c color.Color) voxel.Material {
+	return p.materials[p.key(c)]
+}
@@ -0,0 +1,244 @@
+package terrain
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"testing"
+
+	"github.com/mmcilroy/voxel_raycaster/voxel"
+)
+
+// columnHeight returns how many voxels are set from the bottom of a column
+func columnHeight(grid *voxel.VoxelGrid, x, z int32) int32 {
+	y := int32(0)
+	for ; y < grid.NumVoxelsY && grid.GetVoxel(x, y, z); y++ {
+	}
+	for h := y; h < grid.NumVoxelsY; h++ {
+		if grid.GetVoxel(x, h, z) {
+			return -1
+		}
+	}
+	return y
+}
+
+func TestHeightmap(t *testing.T) {
+	heights := image.NewGray16(image.Rect(0, 0, 5, 3))
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 5; x++ {
+			heights.SetGray16(x, y, color.Gray16{Y: uint16((x + y*5) * 65535 / 14)})
+		}
+	}
+
+	grid, err := NewGridFromHeightmap(heights, 1, HeightmapOptions{Scale: 14})
+	if err != nil {
+		t.Fatalf("NewGridFromHeightmap failed: %v\n", err)
+	}
+
+	if grid.Count() != (voxel.Vector3i{X: 5, Y: 15, Z: 3}) {
+		t.Fatalf("Incorrect size: %v\n", grid.Count())
+	}
+
+	for z := int32(0); z < 3; z++ {
+		for x := int32(0); x < 5; x++ {
+			if h := columnHeight(grid, x, z); h != x+z*5+1 {
+				t.Fatalf("Incorrect height at %d %d: %d\n", x, z, h)
+			}
+		}
+	}
+
+	// 8 bit images give the same heights as 16 bit ones
+	gray := image.NewGray(image.Rect(0, 0, 4, 4))
+	gray16 := image.NewGray16(gray.Bounds())
+	for i := range gray.Pix {
+		gray.Pix[i] = uint8(i * 17)
+		gray16.SetGray16(i%4, i/4, color.Gray16{Y: uint16(i * 17 * 257)})
+	}
+
+	a, _ := NewGridFromHeightmap(gray, 1, HeightmapOptions{Scale: 40})
+	b, _ := NewGridFromHeightmap(gray16, 1, HeightmapOptions{Scale: 40})
+	for z := int32(0); z < 4; z++ {
+		for x := int32(0); x < 4; x++ {
+			if columnHeight(a, x, z) != columnHeight(b, x, z) {
+				t.Fatalf("8 and 16 bit heights differ at %d %d\n", x, z)
+			}
+		}
+	}
+
+	// the default scale makes white the top of a 256 voxel grid
+	white := image.NewGray(image.Rect(0, 0, 1, 1))
+	white.Pix[0] = 255
+	grid, _ = NewGridFromHeightmap(white, 1, HeightmapOptions{})
+	if grid.NumVoxelsY != 256 || columnHeight(grid, 0, 0) != 256 {
+		t.Fatalf("Incorrect default scale: %d %d\n", grid.NumVoxelsY, columnHeight(grid, 0, 0))
+	}
+}
+
+func TestHeightmapColors(t *testing.T) {
+	heights := image.NewGray(image.Rect(0, 0, 4, 4))
+	for i := range heights.Pix {
+		heights.Pix[i] = uint8(i * 16)
+	}
+
+	colors := image.NewRGBA(image.Rect(10, 10, 14, 14))
+	red, green := color.RGBA{R: 255, A: 255}, color.RGBA{G: 255, A: 255}
+	for y := 10; y < 14; y++ {
+		for x := 10; x < 14; x++ {
+			if x < 12 {
+				colors.SetRGBA(x, y, red)
+			} else {
+				colors.SetRGBA(x, y, green)
+			}
+		}
+	}
+
+	water := color.RGBA{B: 255, A: 255}
+	grid, err := NewGridFromHeightmap(heights, 1, HeightmapOptions{Scale: 16, SeaLevel: 8, Water: water, Colors: colors})
+	if err != nil {
+		t.Fatalf("NewGridFromHeightmap failed: %v\n", err)
+	}
+
+	if len(grid.Palette) != 4 || grid.Palette[1] != red || grid.Palette[2] != green || grid.Palette[3] != water {
+		t.Fatalf("Incorrect palette: %v\n", grid.Palette)
+	}
+
+	for z := int32(0); z < 4; z++ {
+		for x := int32(0); x < 4; x++ {
+			expected := voxel.Material(1)
+			if x >= 2 {
+				expected = 2
+			}
+
+			top := int32(math.Round(float64((x+z*4)*16*257) / 65535 * 16))
+			for y := int32(0); y < grid.NumVoxelsY; y++ {
+				m := grid.GetMaterial(x, y, z)
+				switch {
+				case y <= top && m != expected:
+					t.Fatalf("Incorrect ground at %d %d %d: %d\n", x, y, z, m)
+				case y > top && y < 8 && m != 3:
+					t.Fatalf("Missing water at %d %d %d: %d\n", x, y, z, m)
+				case y > top && y >= 8 && grid.GetVoxel(x, y, z):
+					t.Fatalf("Voxel above the surface at %d %d %d\n", x, y, z)
+				}
+			}
+		}
+	}
+
+	if _, err := NewGridFromHeightmap(heights, 1, HeightmapOptions{Colors: image.NewRGBA(image.Rect(0, 0, 3, 4))}); err == nil {
+		t.Fatalf("Expected an error for mismatched colors\n")
+	}
+}
+
+func TestHeightmapManyColors(t *testing.T) {
+	heights := image.NewGray(image.Rect(0, 0, 256, 300))
+	colors := image.NewRGBA(heights.Bounds())
+	for y := 0; y < 300; y++ {
+		for x := 0; x < 256; x++ {
+			colors.SetRGBA(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: uint8(y >> 8), A: 255})
+		}
+	}
+
+	grid, err := NewGridFromHeightmap(heights, 1, HeightmapOptions{Scale: 1, Colors: colors})
+	if err != nil {
+		t.Fatalf("NewGridFromHeightmap failed: %v\n", err)
+	}
+
+	// too many colors to keep so they are rounded
+	if len(grid.Palette) > 32769 {
+		t.Fatalf("Too many colors: %d\n", len(grid.Palette))
+	}
+	m := grid.GetMaterial(13, 0, 270)
+	if grid.Palette[m] != (color.RGBA{R: 8, G: 8, B: 0, A: 255}) {
+		t.Fatalf("Incorrect color: %v\n", grid.Palette[m])
+	}
+}
+
+func TestDecodePGM(t *testing.T) {
+	pixels := []uint16{0, 100, 200, 300, 400, 1000}
+
+	// binary 16 bit
+	var binary16 bytes.Buffer
+	fmt.Fprintf(&binary16, "P5\n# a comment\n3 2\n1000\n")
+	for _, p := range pixels {
+		binary16.Write([]byte{byte(p >> 8), byte(p)})
+	}
+
+	// text
+	var text bytes.Buffer
+	fmt.Fprintf(&text, "P2 3 2 1000\n")
+	for _, p := range pixels {
+		fmt.Fprintf(&text, "%d\n", p)
+	}
+
+	for _, data := range [][]byte{binary16.Bytes(), text.Bytes()} {
+		img, format, err := image.Decode(bytes.NewReader(data))
+		if err != nil || format != "pgm" {
+			t.Fatalf("Decode failed: %v %s\n", err, format)
+		}
+		if img.Bounds() != image.Rect(0, 0, 3, 2) {
+			t.Fatalf("Incorrect bounds: %v\n", img.Bounds())
+		}
+		for i, p := range pixels {
+			v := color.Gray16Model.Convert(img.At(i%3, i/3)).(color.Gray16).Y
+			if v != uint16(int(p)*65535/1000) {
+				t.Fatalf("Incorrect pixel %d: %d\n", i, v)
+			}
+		}
+	}
+
+	// binary 8 bit
+	data := append([]byte("P5 2 2 255\n"), 0, 64, 128, 255)
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width != 2 || config.Height != 2 || config.ColorModel != color.GrayModel {
+		t.Fatalf("DecodeConfig failed: %v %v\n", err, config)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Decode failed: %v\n", err)
+	}
+	gray, ok := img.(*image.Gray)
+	if !ok || !bytes.Equal(gray.Pix, data[len(data)-4:]) {
+		t.Fatalf("Incorrect 8 bit image: %v\n", img)
+	}
+
+	if _, err := DecodePGM(bytes.NewReader([]byte("P5 2 2 255\n\x00"))); err == nil {
+		t.Fatalf("Expected an error for a short image\n")
+	}
+
+	// values outside 0 to maxValue, and sizes too big to allocate
+	for _, bad := range []string{"P2 2 1 100\n5 -1\n", "P2 2 1 100\n101 5\n", "P5 1 1 100\n\xff", "P5 65536 65536 255\n", "P5 4294967296 4294967296 255\n"} {
+		if _, err := DecodePGM(bytes.NewReader([]byte(bad))); err == nil {
+			t.Fatalf("Expected an error for %q\n", bad)
+		}
+	}
+	if _, err := DecodePGMConfig(bytes.NewReader([]byte("P5 65536 65536 255\n"))); err == nil {
+		t.Fatalf("Expected an error for a huge image config\n")
+	}
+}
+
+func TestHeightmapPNG(t *testing.T) {
+	heights := image.NewGray16(image.Rect(0, 0, 8, 8))
+	for i := 0; i < 64; i++ {
+		heights.SetGray16(i%8, i/8, color.Gray16{Y: uint16(i * 1000)})
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, heights); err != nil {
+		t.Fatalf("Encode failed: %v\n", err)
+	}
+	img, _, err := image.Decode(&buf)
+	if err != nil {
+		t.Fatalf("Decode failed: %v\n", err)
+	}
+
+	// 16 bit precision survives the round trip
+	grid, _ := NewGridFromHeightmap(img, 1, HeightmapOptions{Scale: 65535.0 / 1000})
+	for i := int32(0); i < 64; i++ {
+		if h := columnHeight(grid, i%8, i/8); h != i+1 {
+			t.Fatalf("Incorrect height %d: %d\n", i, h)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package terrain
+
+import (
+	"math"
+	"math/rand"
+)
+
+// Noise is Ken Perlin's improved gradient noise with its permutation
+// shuffled by a seed, so the same seed always gives the same noise. it is 0
+// at whole numbers and stays between -1 and 1
+type Noise struct {
+	perm [512]uint8
+}
+
+func NewNoise(seed int64) *Noise {
+	noise := &Noise{}
+	for i, p := range rand.New(rand.NewSource(seed)).Perm(256) {
+		noise.perm[i] = uint8(p)
+		noise.perm[i+256] = uint8(p)
+	}
+	return noise
+}
+
+func fade(t float64) float64 {
+	return t * t * t * (t*(t*6-15) + 10)
+}
+
+func lerp(t, a, b float64) float64 {
+	return a + t*(b-a)
+}
+
+// grad2 picks one of 8 directions for a corner and dots it with x, y
+func grad2(hash uint8, x, y float64) float64 {
+	switch hash & 7 {
+	case 0:
+		return x + y
+	case 1:
+		return -x + y
+	case 2:
+		return x - y
+	case 3:
+		return -x - y
+	case 4:
+		return x
+	case 5:
+		return -x
+	case 6:
+		return y
+	default:
+		return -y
+	}
+}
+
+// grad3 picks one of the 12 edge directions of a cube, 4 of them twice
+func grad3(hash uint8, x, y, z float64) float64 {
+	h := hash & 15
+	u, v := y, z
+	if h < 8 {
+		u = x
+	}
+	if h < 4 {
+		v = y
+	} else if h == 12 || h == 14 {
+		v = x
+	}
+	if h&1 != 0 {
+		u = -u
+	}
+	if h&2 != 0 {
+		v = -v
+	}
+	return u + v
+}
+
+// Noise2 returns 2d noise at x, y
+func (n *Noise) Noise2(x, y float64) float64 {
+	fx, fy := math.Floor(x), math.Floor(y)
+	xi, yi := int(fx)&255, int(fy)&255
+	x, y = x-fx, y-fy
+	u, v := fade(x), fade(y)
+
+	p := &n.perm
+	a, b := int(p[xi])+yi, int(p[xi+1])+yi
+
+	return lerp(v,
+		lerp(u, grad2(p[a], x, y), grad2(p[b], x-1, y)),
+		lerp(u, grad2(p[a+1], x, y-1), grad2(p[b+1], x-1, y-1)))
+}
+
+// Noise3 returns 3d noise at x, y, z
+func (n *Noise) Noise3(x, y, z float64) float64 {
+	fx, fy, fz := math.Floor(x), math.Floor(y), math.Floor(z)
+	xi, yi, zi := int(fx)&255, int(fy)&255, int(fz)&255
+	x, y, z = x-fx, y-fy, z-fz
+	u, v, w := fade(x), fade(y), fade(z)
+
+	p := &n.perm
+	a := int(p[xi]) + yi
+	aa, ab := int(p[a])+zi, int(p[a+1])+zi
+	b := int(p[xi+1]) + yi
+	ba, bb := int(p[b])+zi, int(p[b+1])+zi
+
+	return lerp(w,
+		lerp(v,
+			lerp(u, grad3(p[aa], x, y, z), grad3(p[ba], x-1, y, z)),
+			lerp(u, grad3(p[ab], x, y-1, z), grad3(p[bb], x-1, y-1, z))),
+		lerp(v,
+			lerp(u, grad3(p[aa+1], x, y, z-1), grad3(p[ba+1], x-1, y, z-1)),
+			lerp(u, grad3(p[ab+1], x, y-1, z-1), grad3(p[bb+1], x-1, y-1, z-1))))
+}
+
+// Fractal adds octaves of noise together, fractal brownian motion, each one
+// Lacunarity times smaller and Gain times weaker than the one before
+type Fractal struct {
+	Noise      *Noise
+	Octaves    int
+	Lacunarity float64
+	Gain       float64
+}
+
+// Fractal2 returns the sum of the octaves at x, y scaled back to -1 to 1
+func (f Fractal) Fractal2(x, y float64) float64 {
+	sum, amplitude, total := 0.0, 1.0, 0.0
+	for i := 0; i < max(f.Octaves, 1); i++ {
+		sum += amplitude * f.Noise.Noise2(x, y)
+		total += amplitude
+		amplitude *= f.Gain
+		x, y = x*f.Lacunarity, y*f.Lacunarity
+	}
+	return sum / total
+}
+
+// Fractal3 returns the sum of the octaves at x, y, z scaled back to -1 to 1
+func (f Fractal) Fractal3(x, y, z float64) float64 {
+	sum, amplitude, total := 0.0, 1.0, 0.0
+	for i := 0; i < max(f.Octaves, 1); i++ {
+		sum += amplitude * f.Noise.Noise3(x, y, z)
+		total += amplitude
+		amplitude *= f.Gain
+		x, y, z = x*f.Lacunarity, y*f.Lacunarity, z*f.Lacunarity
+	}
+	return sum / total
+}
@@ -0,0 +1,63 @@
+package terrain
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestNoise(t *testing.T) {
+	noise := NewNoise(7)
+	r := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 100000; i++ {
+		x, y, z := r.Float64()*512-256, r.Float64()*512-256, r.Float64()*512-256
+
+		n2, n3 := noise.Noise2(x, y), noise.Noise3(x, y, z)
+		if n2 < -1 || n2 > 1 || n3 < -1 || n3 > 1 {
+			t.Fatalf("Noise out of range: %f %f\n", n2, n3)
+		}
+
+		// small steps make small changes
+		if math.Abs(noise.Noise2(x+0.001, y)-n2) > 0.01 || math.Abs(noise.Noise3(x, y, z+0.001)-n3) > 0.01 {
+			t.Fatalf("Noise not smooth at %f %f %f\n", x, y, z)
+		}
+	}
+
+	// zero on the lattice
+	if noise.Noise2(3, -5) != 0 || noise.Noise3(1, 2, -3) != 0 {
+		t.Fatalf("Noise not zero at whole numbers\n")
+	}
+
+	// the seed picks the noise
+	same, other := NewNoise(7), NewNoise(8)
+	if same.Noise3(1.5, 2.25, 3.75) != noise.Noise3(1.5, 2.25, 3.75) || other.Noise3(1.5, 2.25, 3.75) == noise.Noise3(1.5, 2.25, 3.75) {
+		t.Fatalf("Seed not used\n")
+	}
+}
+
+func TestFractal(t *testing.T) {
+	fractal := Fractal{Noise: NewNoise(3), Octaves: 6, Lacunarity: 2, Gain: 0.5}
+	single := Fractal{Noise: fractal.Noise, Octaves: 1}
+
+	r := rand.New(rand.NewSource(1))
+	rough, smooth := 0.0, 0.0
+	for i := 0; i < 10000; i++ {
+		x, y := r.Float64()*100, r.Float64()*100
+		f := fractal.Fractal2(x, y)
+		if f < -1 || f > 1 || fractal.Fractal3(x, y, x) < -1 || fractal.Fractal3(x, y, x) > 1 {
+			t.Fatalf("Fractal out of range: %f\n", f)
+		}
+		if single.Fractal2(x, y) != fractal.Noise.Noise2(x, y) {
+			t.Fatalf("One octave isn't the noise\n")
+		}
+
+		// more octaves add finer detail
+		rough += math.Abs(fractal.Fractal2(x+0.05, y) - f)
+		smooth += math.Abs(single.Fractal2(x+0.05, y) - single.Fractal2(x, y))
+	}
+
+	if rough <= smooth {
+		t.Fatalf("Octaves not added: %f %f\n", rough, smooth)
+	}
+}
@@ -0,0 +1,158 @@
+package terrain
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"strconv"
+)
+
+// PGM images are registered with the image package so image.Decode reads
+// them along with PNG. both the binary P5 and text P2 forms are read, values
+// over 255 give a 16 bit image
+func init() {
+	image.RegisterFormat("pgm", "P5", DecodePGM, DecodePGMConfig)
+	image.RegisterFormat("pgm", "P2", DecodePGM, DecodePGMConfig)
+}
+
+// headers asking for more pixels than an 8192x8192 heightmap are taken to be
+// corrupt rather than allocated
+const MAX_PGM_PIXELS = 1 << 26
+
+type pgmHeader struct {
+	binary        bool
+	width, height int
+	maxValue      int
+}
+
+func readPGMHeader(r *bufio.Reader) (pgmHeader, error) {
+	var header pgmHeader
+
+	magic, err := pgmToken(r)
+	if err != nil {
+		return header, err
+	}
+	switch magic {
+	case "P5":
+		header.binary = true
+	case "P2":
+	default:
+		return header, fmt.Errorf("pgm: unknown format %q", magic)
+	}
+
+	values := [3]*int{&header.width, &header.height, &header.maxValue}
+	for _, v := range values {
+		if *v, err = pgmInt(r); err != nil {
+			return header, err
+		}
+	}
+
+	if header.width <= 0 || header.height <= 0 || header.maxValue <= 0 || header.maxValue > 65535 {
+		return header, fmt.Errorf("pgm: invalid header %+v", header)
+	}
+
+	if header.width > MAX_PGM_PIXELS || header.height > MAX_PGM_PIXELS || int64(header.width)*int64(header.height) > MAX_PGM_PIXELS {
+		return header, fmt.Errorf("pgm: image too big %dx%d", header.width, header.height)
+	}
+
+	return header, nil
+}
+
+// pgmToken returns the next whitespace separated word, skipping comments.
+// the single whitespace after the last header value is consumed with it
+func pgmToken(r *bufio.Reader) (string, error) {
+	var token []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			if err == io.EOF && len(token) > 0 {
+				return string(token), nil
+			}
+			return "", err
+		}
+
+		switch {
+		case b == '#' && len(token) == 0:
+			if _, err := r.ReadString('\n'); err != nil {
+				return "", err
+			}
+		case b == ' ' || b == '\t' || b == '\n' || b == '\r':
+			if len(token) > 0 {
+				return string(token), nil
+			}
+		default:
+			token = append(token, b)
+		}
+	}
+}
+
+func pgmInt(r *bufio.Reader) (int, error) {
+	token, err := pgmToken(r)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(token)
+}
+
+func DecodePGMConfig(r io.Reader) (image.Config, error) {
+	header, err := readPGMHeader(bufio.NewReader(r))
+	if err != nil {
+		return image.Config{}, err
+	}
+
+	model := color.GrayModel
+	if header.maxValue > 255 {
+		model = color.Gray16Model
+	}
+	return image.Config{ColorModel: model, Width: header.width, Height: header.height}, nil
+}
+
+// DecodePGM reads a PGM image, values are stretched so maxValue is white
+func DecodePGM(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+	header, err := readPGMHeader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	next := func() (int, error) {
+		if !header.binary {
+			return pgmInt(br)
+		}
+		if header.maxValue < 256 {
+			b, err := br.ReadByte()
+			return int(b), err
+		}
+		var b [2]byte
+		_, err := io.ReadFull(br, b[:])
+		return int(b[0])<<8 | int(b[1]), err
+	}
+
+	bounds := image.Rect(0, 0, header.width, header.height)
+	var img interface {
+		image.Image
+		Set(x, y int, c color.Color)
+	}
+	if header.maxValue > 255 {
+		img = image.NewGray16(bounds)
+	} else {
+		img = image.NewGray(bounds)
+	}
+
+	for y := 0; y < header.height; y++ {
+		for x := 0; x < header.width; x++ {
+			v, err := next()
+			if err != nil {
+				return nil, fmt.Errorf("pgm: %w", err)
+			}
+			if v < 0 || v > header.maxValue {
+				return nil, fmt.Errorf("pgm: value %d at %d, %d is outside 0 to %d", v, x, y, header.maxValue)
+			}
+			img.Set(x, y, color.Gray16{Y: uint16(v * 65535 / header.maxValue)})
+		}
+	}
+
+	return img, nil
+}
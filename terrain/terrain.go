@@ -0,0 +1,222 @@
+package terrain
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/mmcilroy/voxel_raycaster/voxel"
+)
+
+// Layer is a band of material under the surface. layers stack down from the
+// surface, each Thickness voxels deep, and a Thickness of 0 goes all the way
+// down. a layer is only used from MinY up to but not including MaxY, a MaxY
+// of 0 means no limit, so snow can sit on peaks and sand along the shore.
+// a layer that can't be used at a voxel's height is skipped there without
+// using up any depth
+type Layer struct {
+	Thickness int32
+	Material  voxel.Material
+	MinY      int32
+	MaxY      int32
+}
+
+// Terrain says how to build a world. heights are fractions of the height of
+// the grid being filled and wavelengths are in voxels, the size of the
+// largest features the noise makes
+type Terrain struct {
+	Seed int64
+
+	// the surface is Level + Amplitude * the height noise
+	Level      float64
+	Amplitude  float64
+	Wavelength float64
+	Octaves    int
+	Lacunarity float64
+	Gain       float64
+
+	// 3d noise moves the surface in and out by up to Overhang voxels, which
+	// makes overhangs and arches. 0 leaves a plain heightmap
+	Overhang           float64
+	OverhangWavelength float64
+
+	// solid voxels are hollowed out where the cave noise is closer to 0
+	// than CaveSize, which makes winding tunnels. 0 for no caves
+	CaveSize       float64
+	CaveWavelength float64
+
+	Layers []Layer
+
+	// empty voxels below SeaLevel that are open to the sky are filled with
+	// Water, unless it is 0
+	SeaLevel int32
+	Water    voxel.Material
+
+	// given to the grid when it isn't nil
+	Palette []color.RGBA
+}
+
+// the materials used by NewTerrain
+const (
+	GRASS voxel.Material = iota + 1
+	DIRT
+	STONE
+	SAND
+	SNOW
+	WATER
+)
+
+// NewTerrain returns rolling hills with overhangs and caves, layers of grass,
+// dirt and stone, sand by the sea and snow on the peaks
+func NewTerrain(seed int64, height int32) *Terrain {
+	return &Terrain{
+		Seed:               seed,
+		Level:              0.4,
+		Amplitude:          0.3,
+		Wavelength:         128,
+		Octaves:            5,
+		Lacunarity:         2,
+		Gain:               0.5,
+		Overhang:           4,
+		OverhangWavelength: 24,
+		CaveSize:           0.06,
+		CaveWavelength:     32,
+		Layers: []Layer{
+			{Thickness: 2, Material: SNOW, MinY: height * 3 / 4},
+			{Thickness: 3, Material: SAND, MaxY: height*3/10 + 2},
+			{Thickness: 1, Material: GRASS},
+			{Thickness: 3, Material: DIRT},
+			{Material: STONE},
+		},
+		SeaLevel: height * 3 / 10,
+		Water:    WATER,
+		Palette: []color.RGBA{
+			{},
+			{R: 86, G: 150, B: 60, A: 255},
+			{R: 120, G: 85, B: 55, A: 255},
+			{R: 128, G: 128, B: 128, A: 255},
+			{R: 220, G: 205, B: 150, A: 255},
+			{R: 245, G: 245, B: 250, A: 255},
+			{R: 50, G: 100, B: 200, A: 255},
+		},
+	}
+}
+
+// generator holds the noise for one call to Generate
+type generator struct {
+	*Terrain
+	count    voxel.Vector3i
+	surface  Fractal
+	overhang Fractal
+	caves    Fractal
+}
+
+// Generate fills the grid with terrain, anything already in it is replaced
+func (t *Terrain) Generate(grid *voxel.VoxelGrid) {
+	t.GenerateAt(grid, 0, 0)
+}
+
+// GenerateAt fills the grid with the piece of terrain whose corner is at x, z
+// so grids side by side join up, which is how a voxel.StreamingWorld gets its
+// chunks. heights are still fractions of the grid's height
+func (t *Terrain) GenerateAt(grid *voxel.VoxelGrid, originX, originZ int32) {
+	g := t.generator(grid.Count())
+
+	grid.Clear()
+	if t.Palette != nil {
+		grid.Palette = t.Palette
+	}
+
+	for z := int32(0); z < grid.NumVoxelsZ; z++ {
+		for x := int32(0); x < grid.NumVoxelsX; x++ {
+			g.column(originX+x, originZ+z, func(y int32, m voxel.Material) {
+				if m != 0 {
+					grid.SetMaterial(x, y, z, m)
+				} else {
+					grid.SetVoxel(x, y, z, true)
+				}
+			})
+		}
+	}
+}
+
+func (t *Terrain) generator(count voxel.Vector3i) *generator {
+	// each kind of noise gets its own seed so they don't line up
+	fractal := func(seed int64, octaves int) Fractal {
+		return Fractal{Noise: NewNoise(seed), Octaves: octaves, Lacunarity: t.Lacunarity, Gain: t.Gain}
+	}
+
+	return &generator{
+		Terrain:  t,
+		count:    count,
+		surface:  fractal(t.Seed, t.Octaves),
+		overhang: fractal(t.Seed+1, 2),
+		caves:    fractal(t.Seed+2, 2),
+	}
+}
+
+func (g *generator) surfaceHeight(x, z float64) float64 {
+	n := g.surface.Fractal2(x/g.Wavelength, z/g.Wavelength)
+	return (g.Level + g.Amplitude*n) * float64(g.count.Y)
+}
+
+// column calls set for every voxel in the column that should be set, from
+// the top down
+func (g *generator) column(x, z int32, set func(y int32, m voxel.Material)) {
+	fx, fz := float64(x)+0.5, float64(z)+0.5
+	h := g.surfaceHeight(fx, fz)
+
+	// voxels further below the surface than the overhangs reach are solid
+	// and further above are empty, so only the band between needs 3d noise
+	top := min(int32(math.Ceil(h+g.Overhang)), g.count.Y-1)
+
+	// how far below the last empty voxel we are, and whether anything solid
+	// is above so water doesn't end up in caves
+	depth := int32(0)
+	covered := false
+
+	for y := g.count.Y - 1; y >= 0; y-- {
+		fy := float64(y) + 0.5
+
+		solid := false
+		if y <= top {
+			density := h - fy
+			if g.Overhang > 0 && math.Abs(density) < g.Overhang {
+				w := g.OverhangWavelength
+				density += g.Overhang * g.overhang.Fractal3(fx/w, fy/w, fz/w)
+			}
+			solid = density > 0
+		}
+
+		if solid && g.CaveSize > 0 {
+			w := g.CaveWavelength
+			solid = math.Abs(g.caves.Fractal3(fx/w, fy/w, fz/w)) >= g.CaveSize
+		}
+
+		if !solid {
+			depth = 0
+			if y < g.SeaLevel && g.Water != 0 && !covered {
+				set(y, g.Water)
+			}
+			continue
+		}
+
+		set(y, g.material(depth, y))
+		depth++
+		covered = true
+	}
+}
+
+// material returns the material depth voxels under the surface at height y
+func (g *generator) material(depth, y int32) voxel.Material {
+	top := int32(0)
+	for _, layer := range g.Layers {
+		if y < layer.MinY || (layer.MaxY != 0 && y >= layer.MaxY) {
+			continue
+		}
+		if layer.Thickness == 0 || depth < top+layer.Thickness {
+			return layer.Material
+		}
+		top += layer.Thickness
+	}
+	return 0
+}
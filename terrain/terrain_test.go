@@ -0,0 +1,137 @@
+package terrain
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mmcilroy/voxel_raycaster/voxel"
+)
+
+func generate(t *Terrain, nx, ny, nz int32) *voxel.VoxelGrid {
+	grid := voxel.NewVoxelGrid(nx, ny, nz, 1)
+	t.Generate(grid)
+	return grid
+}
+
+func TestGenerateHeightmap(t *testing.T) {
+	terrain := NewTerrain(5, 48)
+	terrain.Overhang, terrain.CaveSize = 0, 0
+	grid := generate(terrain, 40, 48, 36)
+
+	for z := int32(0); z < grid.NumVoxelsZ; z++ {
+		for x := int32(0); x < grid.NumVoxelsX; x++ {
+			// solid from the bottom up to the surface with water on top
+			y := int32(0)
+			for ; y < grid.NumVoxelsY && grid.GetVoxel(x, y, z) && grid.GetMaterial(x, y, z) != WATER; y++ {
+			}
+			surface := y
+			for ; y < terrain.SeaLevel; y++ {
+				if grid.GetMaterial(x, y, z) != WATER {
+					t.Fatalf("Missing water: %d %d %d\n", x, y, z)
+				}
+			}
+			for ; y < grid.NumVoxelsY; y++ {
+				if grid.GetVoxel(x, y, z) {
+					t.Fatalf("Voxel above the surface: %d %d %d\n", x, y, z)
+				}
+			}
+
+			if surface == 0 {
+				continue
+			}
+
+			// the layers stack down from the surface
+			top := surface - 1
+			expected := []voxel.Material{GRASS, DIRT, DIRT, DIRT, STONE}
+			if top >= terrain.Layers[0].MinY {
+				expected = []voxel.Material{SNOW, SNOW, GRASS, DIRT, DIRT, DIRT, STONE}
+			}
+			for i, m := range expected {
+				y := top - int32(i)
+				if y < 0 || y < terrain.Layers[1].MaxY {
+					break
+				}
+				if grid.GetMaterial(x, y, z) != m {
+					t.Fatalf("Incorrect layer at %d %d %d: %d %d\n", x, y, z, grid.GetMaterial(x, y, z), m)
+				}
+			}
+		}
+	}
+
+	if grid.Palette[GRASS] != terrain.Palette[GRASS] {
+		t.Fatalf("Palette not set\n")
+	}
+}
+
+func TestGenerateOverhangsAndCaves(t *testing.T) {
+	terrain := NewTerrain(9, 64)
+	terrain.Water = 0
+	plain := *terrain
+	plain.Overhang, plain.CaveSize = 0, 0
+
+	grid := generate(terrain, 64, 64, 64)
+	flat := generate(&plain, 64, 64, 64)
+
+	// overhangs and caves leave gaps under solid voxels that a heightmap can't
+	gaps := 0
+	for z := int32(0); z < grid.NumVoxelsZ; z++ {
+		for x := int32(0); x < grid.NumVoxelsX; x++ {
+			solid := false
+			for y := grid.NumVoxelsY - 1; y >= 0; y-- {
+				if grid.GetVoxel(x, y, z) {
+					solid = true
+				} else if solid {
+					gaps++
+				}
+
+				// overhangs only reach so far from the plain surface
+				if below := y - int32(terrain.Overhang) - 1; below >= 0 && grid.GetVoxel(x, y, z) && !flat.GetVoxel(x, below, z) {
+					t.Fatalf("Voxel too far above the surface: %d %d %d\n", x, y, z)
+				}
+			}
+		}
+	}
+
+	if gaps == 0 {
+		t.Fatalf("No overhangs or caves\n")
+	}
+
+	// the same seed always makes the same world, a different one doesn't
+	if again := generate(terrain, 64, 64, 64); !bytes.Equal(again.Bricks(), grid.Bricks()) {
+		t.Fatalf("Terrain not repeatable\n")
+	}
+	terrain.Seed++
+	if other := generate(terrain, 64, 64, 64); bytes.Equal(other.Bricks(), grid.Bricks()) {
+		t.Fatalf("Seed not used\n")
+	}
+}
+
+func TestGenerateAt(t *testing.T) {
+	terrain := NewTerrain(3, 48)
+	whole := generate(terrain, 48, 48, 32)
+
+	// pieces side by side make the same terrain as one big grid
+	for _, origin := range []voxel.Vector3i{{X: 0, Z: 0}, {X: 16, Z: 0}, {X: 32, Z: 16}} {
+		piece := voxel.NewVoxelGrid(16, 48, 16, 1)
+		terrain.GenerateAt(piece, origin.X, origin.Z)
+
+		for z := int32(0); z < 16; z++ {
+			for x := int32(0); x < 16; x++ {
+				for y := int32(0); y < 48; y++ {
+					if piece.GetMaterial(x, y, z) != whole.GetMaterial(origin.X+x, y, origin.Z+z) {
+						t.Fatalf("Pieces don't match at %d %d %d\n", origin.X+x, y, origin.Z+z)
+					}
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkGenerate(b *testing.B) {
+	terrain := NewTerrain(1, 128)
+	grid := voxel.NewVoxelGrid(256, 128, 256, 1)
+
+	for i := 0; i < b.N; i++ {
+		terrain.Generate(grid)
+	}
+}
@@ -0,0 +1,144 @@
+package voxel
+
+const CHUNK_SIZE = 16
+
+const CHUNK_VOXELS = CHUNK_SIZE * CHUNK_SIZE * CHUNK_SIZE
+
+type voxelChunk struct {
+	voxels [CHUNK_VOXELS / 8]uint8
+	count  int32 // number of set voxels, chunk is freed when this reaches 0
+}
+
+// ChunkedVoxels only allocates storage for chunks that have something in them
+// which keeps large mostly empty worlds cheap
+type ChunkedVoxels struct {
+	chunks map[Vector3i]*voxelChunk
+	size   float32
+	count  Vector3i
+}
+
+func NewChunkedVoxels(nx, ny, nz int32, sz float32) *ChunkedVoxels {
+	return &ChunkedVoxels{
+		chunks: map[Vector3i]*voxelChunk{},
+		size:   sz,
+		count:  Vector3i{X: nx, Y: ny, Z: nz},
+	}
+}
+
+func chunkKey(x, y, z int32) Vector3i {
+	return Vector3i{X: floorDiv(x, CHUNK_SIZE), Y: floorDiv(y, CHUNK_SIZE), Z: floorDiv(z, CHUNK_SIZE)}
+}
+
+func floorDiv(a, b int32) int32 {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+func chunkBit(x, y, z int32) (int32, uint8) {
+	lx, ly, lz := x-floorDiv(x, CHUNK_SIZE)*CHUNK_SIZE, y-floorDiv(y, CHUNK_SIZE)*CHUNK_SIZE, z-floorDiv(z, CHUNK_SIZE)*CHUNK_SIZE
+	i := lx + lz*CHUNK_SIZE + ly*CHUNK_SIZE*CHUNK_SIZE
+	return i / 8, uint8(1) << (i % 8)
+}
+
+func (voxels *ChunkedVoxels) inside(x, y, z int32) bool {
+	return x >= 0 && y >= 0 && z >= 0 && x < voxels.count.X && y < voxels.count.Y && z < voxels.count.Z
+}
+
+func (voxels *ChunkedVoxels) Set(x, y, z int32, b bool) {
+	if !voxels.inside(x, y, z) {
+		return
+	}
+
+	key := chunkKey(x, y, z)
+	chunk := voxels.chunks[key]
+	if chunk == nil {
+		// nothing to clear in a chunk that doesn't exist
+		if !b {
+			return
+		}
+		chunk = &voxelChunk{}
+		voxels.chunks[key] = chunk
+	}
+
+	i, mask := chunkBit(x, y, z)
+	present := chunk.voxels[i]&mask != 0
+
+	if b && !present {
+		chunk.voxels[i] |= mask
+		chunk.count++
+	} else if !b && present {
+		chunk.voxels[i] &= ^mask
+		chunk.count--
+		if chunk.count == 0 {
+			delete(voxels.chunks, key)
+		}
+	}
+}
+
+func (voxels *ChunkedVoxels) Get(x, y, z int32) bool {
+	if !voxels.inside(x, y, z) {
+		return false
+	}
+
+	chunk := voxels.chunks[chunkKey(x, y, z)]
+	if chunk == nil {
+		return false
+	}
+
+	i, mask := chunkBit(x, y, z)
+	return chunk.voxels[i]&mask != 0
+}
+
+func (voxels *ChunkedVoxels) Size() float32 {
+	return voxels.size
+}
+
+func (voxels *ChunkedVoxels) Count() Vector3i {
+	return voxels.count
+}
+
+// NumChunks returns how many chunks are currently allocated
+func (voxels *ChunkedVoxels) NumChunks() int {
+	return len(voxels.chunks)
+}
+
+// EmptyBox reports the whole chunk around mapPos as empty if it was never allocated
+func (voxels *ChunkedVoxels) EmptyBox(mapPos Vector3i) (Vector3i, Vector3i, bool) {
+	key := chunkKey(mapPos.X, mapPos.Y, mapPos.Z)
+	if voxels.chunks[key] != nil {
+		return Vector3i{}, Vector3i{}, false
+	}
+
+	boxMin := Vector3i{X: key.X * CHUNK_SIZE, Y: key.Y * CHUNK_SIZE, Z: key.Z * CHUNK_SIZE}
+	boxMax := Vector3i{X: boxMin.X + CHUNK_SIZE, Y: boxMin.Y + CHUNK_SIZE, Z: boxMin.Z + CHUNK_SIZE}
+	return boxMin, boxMax, true
+}
+
+// forEach calls fn for every set voxel, only visiting allocated chunks
+func (voxels *ChunkedVoxels) forEach(fn func(x, y, z int32)) {
+	for key, chunk := range voxels.chunks {
+		for i := int32(0); i < CHUNK_VOXELS; i++ {
+			if chunk.voxels[i/8]&(uint8(1)<<(i%8)) == 0 {
+				continue
+			}
+			lx := i % CHUNK_SIZE
+			lz := (i / CHUNK_SIZE) % CHUNK_SIZE
+			ly := i / (CHUNK_SIZE * CHUNK_SIZE)
+			fn(key.X*CHUNK_SIZE+lx, key.Y*CHUNK_SIZE+ly, key.Z*CHUNK_SIZE+lz)
+		}
+	}
+}
+
+func (voxels *ChunkedVoxels) Compress() *Voxels {
+	var newVoxels Voxels = NewChunkedVoxels(halfCount(voxels.count.X), halfCount(voxels.count.Y), halfCount(voxels.count.Z), voxels.size*2)
+
+	// only the allocated chunks can contribute to the lower res version
+	voxels.forEach(func(x, y, z int32) {
+		newVoxels.Set(x/2, y/2, z/2, true)
+	})
+
+	return &newVoxels
+}
@@ -0,0 +1,117 @@
+package voxel
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestChunkedGetSet(t *testing.T) {
+	voxels := NewChunkedVoxels(64, 64, 64, 1)
+
+	voxels.Set(1, 2, 3, true)
+	voxels.Set(40, 50, 60, true)
+
+	if !voxels.Get(1, 2, 3) || !voxels.Get(40, 50, 60) {
+		t.Fatalf("Voxels not set\n")
+	}
+
+	if voxels.Get(3, 2, 1) {
+		t.Fatalf("Unexpected voxel\n")
+	}
+
+	if voxels.NumChunks() != 2 {
+		t.Fatalf("Unexpected chunks: %d\n", voxels.NumChunks())
+	}
+
+	// out of range is ignored
+	voxels.Set(-1, 0, 0, true)
+	voxels.Set(64, 0, 0, true)
+	if voxels.NumChunks() != 2 {
+		t.Fatalf("Unexpected chunks: %d\n", voxels.NumChunks())
+	}
+
+	// clearing the last voxel frees the chunk
+	voxels.Set(1, 2, 3, false)
+	if voxels.Get(1, 2, 3) || voxels.NumChunks() != 1 {
+		t.Fatalf("Chunk not freed: %d\n", voxels.NumChunks())
+	}
+}
+
+func TestChunkedCompress(t *testing.T) {
+	voxels := NewChunkedVoxels(64, 64, 64, 1)
+	voxels.Set(33, 17, 9, true)
+
+	compressed := *voxels.Compress()
+
+	if compressed.Size() != 2 || !compressed.Count().Equals(Vector3i{X: 32, Y: 32, Z: 32}) {
+		t.Fatalf("Incorrect compressed grid: %f %+v\n", compressed.Size(), compressed.Count())
+	}
+
+	if !compressed.Get(16, 8, 4) {
+		t.Fatalf("Compressed voxel not set\n")
+	}
+}
+
+func TestChunkedTrace(t *testing.T) {
+	var dense Voxels = NewTestVoxels(128, 64, 128, 1)
+	var chunked Voxels = NewChunkedVoxels(128, 64, 128, 1)
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 64; i++ {
+		x, y, z := r.Int31n(128), r.Int31n(64), r.Int31n(128)
+		dense.Set(x, y, z, true)
+		chunked.Set(x, y, z, true)
+	}
+
+	denseSteps, chunkedSteps := int32(0), int32(0)
+
+	for i := 0; i < 1000; i++ {
+		rs := Vector3f{X: r.Float32() * 128, Y: r.Float32() * 64, Z: r.Float32() * 128}
+		rd := Vector3f{X: r.Float32() - 0.5, Y: r.Float32() - 0.5, Z: r.Float32() - 0.5}.Normalize()
+
+		params := TraceParams{RayStart: rs, RayDir: rd}
+		expected := Trace(&dense, params)
+		result := Trace(&chunked, params)
+
+		if expected.Status != result.Status {
+			t.Fatalf("Mismatch: %+v %+v\n", expected, result)
+		}
+
+		if expected.Hit() && !expected.MapPos.Equals(result.MapPos) {
+			t.Fatalf("Incorrect mapPos: %+v %+v\n", expected, result)
+		}
+
+		if expected.Hit() && Distance(expected.HitPos, result.HitPos) > 0.001 {
+			t.Fatalf("Incorrect hitPos: %+v %+v\n", expected, result)
+		}
+
+		denseSteps += expected.NumSteps
+		chunkedSteps += result.NumSteps
+	}
+
+	// missing chunks should be skipped in one step
+	if chunkedSteps >= denseSteps {
+		t.Fatalf("Chunks not skipped: %d %d\n", denseSteps, chunkedSteps)
+	}
+}
+
+func TestChunkedMipmap(t *testing.T) {
+	voxels0 := Voxels(NewChunkedVoxels(64, 64, 64, 1))
+	voxels0.Set(32, 32, 32, true)
+
+	voxels1 := voxels0.Compress()
+	voxels2 := (*voxels1).Compress()
+
+	tracer := MipmapTracerImpl{
+		Voxels: []*Voxels{&voxels0, voxels1, voxels2},
+	}
+
+	rs := Vector3f{X: 0.5, Y: 0.5, Z: 0.5}
+	re := Vector3f{X: 32.5, Y: 32.5, Z: 32.5}
+
+	result := tracer.Trace(TraceParams{RayStart: rs, RayDir: Direction(re, rs)})
+
+	if !result.Hit() || !result.MapPos.Equals(Vector3i{X: 32, Y: 32, Z: 32}) {
+		t.Fatalf("Failed to hit: %+v\n", result)
+	}
+}
@@ -0,0 +1,442 @@
+package voxel
+
+import (
+	"math"
+)
+
+// distances are stored in steps of 1/DISTANCE_SCALE voxels
+const DISTANCE_SCALE = 4
+
+// the value signed distances are stored relative to
+const distanceBias = 128
+
+// DistanceField holds, for every voxel, the distance from its center to the
+// center of the nearest set voxel in voxels. set voxels are 0 away unless the
+// field is signed, in which case they hold the negative distance to the
+// nearest empty voxel instead. distances are rounded down to a quarter voxel
+// and stored in a byte each, so they never overestimate and top out at 63.75
+// voxels, or 31.75 either way when signed
+type DistanceField struct {
+	NumVoxelsX int32
+	NumVoxelsY int32
+	NumVoxelsZ int32
+	VoxelSize  float32
+	Signed     bool
+	Distances  []uint8
+}
+
+func NewDistanceField(voxels Voxels, signed bool) *DistanceField {
+	return buildDistanceField(voxels.Count(), voxels.Size(), signed, voxels.Get)
+}
+
+func NewDistanceFieldFromGrid(grid *VoxelGrid, signed bool) *DistanceField {
+	return buildDistanceField(grid.Count(), grid.VoxelSize, signed, grid.GetVoxel)
+}
+
+// the field is built with the separable transform from Felzenszwalb and
+// Huttenlocher's "Distance Transforms of Sampled Functions", squared distances
+// are found along x then z then y which takes linear time overall
+func buildDistanceField(count Vector3i, size float32, signed bool, get func(x, y, z int32) bool) *DistanceField {
+	field := &DistanceField{
+		NumVoxelsX: count.X,
+		NumVoxelsY: count.Y,
+		NumVoxelsZ: count.Z,
+		VoxelSize:  size,
+		Signed:     signed,
+		Distances:  make([]uint8, count.X*count.Y*count.Z),
+	}
+
+	set := make([]bool, len(field.Distances))
+	for y := int32(0); y < count.Y; y++ {
+		for z := int32(0); z < count.Z; z++ {
+			for x := int32(0); x < count.X; x++ {
+				set[field.index(x, y, z)] = get(x, y, z)
+			}
+		}
+	}
+
+	outside := squaredDistances(count, set, true)
+
+	var inside []float64
+	if signed {
+		inside = squaredDistances(count, set, false)
+	}
+
+	for i := range field.Distances {
+		if !set[i] || !signed {
+			field.Distances[i] = field.quantize(math.Sqrt(outside[i]))
+		} else {
+			field.Distances[i] = field.quantize(-math.Sqrt(inside[i]))
+		}
+	}
+
+	return field
+}
+
+// squaredDistances returns the squared distance from each voxel to the
+// nearest one whose set value matches
+func squaredDistances(count Vector3i, set []bool, to bool) []float64 {
+	dist := make([]float64, len(set))
+	for i := range set {
+		if set[i] != to {
+			dist[i] = math.Inf(1)
+		}
+	}
+
+	n := max(count.X, count.Y, count.Z)
+	t := distanceTransform{
+		f: make([]float64, n),
+		d: make([]float64, n),
+		v: make([]int32, n),
+		z: make([]float64, n+1),
+	}
+
+	// x rows
+	for y := int32(0); y < count.Y; y++ {
+		for z := int32(0); z < count.Z; z++ {
+			t.line(dist, (z+y*count.Z)*count.X, 1, count.X)
+		}
+	}
+
+	// z rows
+	for y := int32(0); y < count.Y; y++ {
+		for x := int32(0); x < count.X; x++ {
+			t.line(dist, x+y*count.X*count.Z, count.X, count.Z)
+		}
+	}
+
+	// y rows
+	for z := int32(0); z < count.Z; z++ {
+		for x := int32(0); x < count.X; x++ {
+			t.line(dist, x+z*count.X, count.X*count.Z, count.Y)
+		}
+	}
+
+	return dist
+}
+
+// distanceTransform holds the buffers for the 1D transform so they can be
+// reused for every row
+type distanceTransform struct {
+	f []float64 // the row being transformed
+	d []float64 // the result
+	v []int32   // locations of the parabolas in the lower envelope
+	z []float64 // boundaries between the parabolas
+}
+
+// line transforms the n values starting at start, stride apart, in place
+func (t *distanceTransform) line(dist []float64, start, stride, n int32) {
+	f, d, v, z := t.f[:n], t.d[:n], t.v[:n], t.z[:n+1]
+
+	// rows with nothing to measure from stay infinite
+	first := int32(-1)
+	for q := int32(0); q < n; q++ {
+		f[q] = dist[start+q*stride]
+		if first < 0 && !math.IsInf(f[q], 1) {
+			first = q
+		}
+	}
+	if first < 0 {
+		return
+	}
+
+	// find the lower envelope of the parabolas rooted at each finite value
+	k := int32(0)
+	v[0] = first
+	z[0] = math.Inf(-1)
+	z[1] = math.Inf(1)
+
+	for q := first + 1; q < n; q++ {
+		if math.IsInf(f[q], 1) {
+			continue
+		}
+		s := intersect(f, q, v[k])
+		for s <= z[k] {
+			k--
+			s = intersect(f, q, v[k])
+		}
+		k++
+		v[k] = q
+		z[k] = s
+		z[k+1] = math.Inf(1)
+	}
+
+	k = 0
+	for q := int32(0); q < n; q++ {
+		for z[k+1] < float64(q) {
+			k++
+		}
+		p := v[k]
+		d[q] = float64((q-p)*(q-p)) + f[p]
+	}
+
+	for q := int32(0); q < n; q++ {
+		dist[start+q*stride] = d[q]
+	}
+}
+
+// intersect returns where the parabolas rooted at q and p cross
+func intersect(f []float64, q, p int32) float64 {
+	return ((f[q] + float64(q*q)) - (f[p] + float64(p*p))) / float64(2*q-2*p)
+}
+
+func (field *DistanceField) index(x, y, z int32) int32 {
+	return x + z*field.NumVoxelsX + y*field.NumVoxelsX*field.NumVoxelsZ
+}
+
+func (field *DistanceField) quantize(d float64) uint8 {
+	// round towards zero so the magnitude is never overestimated, anything
+	// too far to store, including nothing at all, gets the furthest value
+	steps := math.Trunc(d * DISTANCE_SCALE)
+
+	if field.Signed {
+		return uint8(min(max(steps, -distanceBias), 255-distanceBias) + distanceBias)
+	}
+	return uint8(min(steps, 255))
+}
+
+func (field *DistanceField) inside(x, y, z int32) bool {
+	return x >= 0 && y >= 0 && z >= 0 && x < field.NumVoxelsX && y < field.NumVoxelsY && z < field.NumVoxelsZ
+}
+
+// Get returns the distance stored for a voxel, in voxels. voxels outside the
+// field are as far away as the field can store
+func (field *DistanceField) Get(x, y, z int32) float32 {
+	if !field.inside(x, y, z) {
+		return field.maxDistance()
+	}
+
+	d := field.Distances[field.index(x, y, z)]
+	if field.Signed {
+		return float32(int32(d)-distanceBias) / DISTANCE_SCALE
+	}
+	return float32(d) / DISTANCE_SCALE
+}
+
+func (field *DistanceField) maxDistance() float32 {
+	if field.Signed {
+		return float32(255-distanceBias) / DISTANCE_SCALE
+	}
+	return 255.0 / DISTANCE_SCALE
+}
+
+// Distance returns the distance stored for the voxel containing pos, both in
+// world units. outside the field it returns the distance to the field's
+// bounds, which is never more than the distance to anything in it
+func (field *DistanceField) Distance(pos Vector3f) float32 {
+	p := pos.DivScalar(field.VoxelSize)
+	x, y, z := int32(math.Floor(float64(p.X))), int32(math.Floor(float64(p.Y))), int32(math.Floor(float64(p.Z)))
+
+	if !field.inside(x, y, z) {
+		return field.boundsDistance(p) * field.VoxelSize
+	}
+
+	return field.Get(x, y, z) * field.VoxelSize
+}
+
+// Sample returns the distance at pos interpolated between the nearest voxel
+// centers, both in world units. it is smoother than Distance but can
+// overestimate slightly between voxels
+func (field *DistanceField) Sample(pos Vector3f) float32 {
+	p := pos.DivScalar(field.VoxelSize).SubScalar(0.5)
+	f := p.Floor()
+	x, y, z := int32(f.X), int32(f.Y), int32(f.Z)
+	t := p.Sub(f)
+
+	if !field.inside(x, y, z) || !field.inside(x+1, y+1, z+1) {
+		return field.Distance(pos)
+	}
+
+	lerp := func(a, b, t float32) float32 { return a + (b-a)*t }
+
+	d00 := lerp(field.Get(x, y, z), field.Get(x+1, y, z), t.X)
+	d01 := lerp(field.Get(x, y, z+1), field.Get(x+1, y, z+1), t.X)
+	d10 := lerp(field.Get(x, y+1, z), field.Get(x+1, y+1, z), t.X)
+	d11 := lerp(field.Get(x, y+1, z+1), field.Get(x+1, y+1, z+1), t.X)
+
+	return lerp(lerp(d00, d01, t.Z), lerp(d10, d11, t.Z), t.Y) * field.VoxelSize
+}
+
+// boundsDistance returns how far p, in voxels, is from the field's bounds
+func (field *DistanceField) boundsDistance(p Vector3f) float32 {
+	outside := func(v, n float32) float32 {
+		return max(-v, v-n, 0)
+	}
+	return Vector3f{
+		X: outside(p.X, float32(field.NumVoxelsX)),
+		Y: outside(p.Y, float32(field.NumVoxelsY)),
+		Z: outside(p.Z, float32(field.NumVoxelsZ)),
+	}.Length()
+}
+
+// DistanceFieldTracer sphere traces through the empty space around voxels,
+// leaping as far as the distance field says is safe, and steps through
+// voxels one at a time like Trace once something is close. the field must be
+// rebuilt if the voxels change
+type DistanceFieldTracer struct {
+	Voxels *Voxels
+	Field  *DistanceField
+}
+
+func NewDistanceFieldTracer(voxels *Voxels) *DistanceFieldTracer {
+	return &DistanceFieldTracer{Voxels: voxels, Field: NewDistanceField(*voxels, false)}
+}
+
+// leaps smaller than this aren't worth it, a DDA step is just as good
+const minLeap = 1
+
+// keeps a leap from landing exactly on the surface of a voxel
+const leapMargin = 0.01
+
+// the distance from a voxel's center to its corners
+var halfDiagonal = float32(math.Sqrt(3) / 2)
+
+func (tracer *DistanceFieldTracer) Trace(params TraceParams) RaycastHit {
+	var result RaycastHit
+	voxels := tracer.Voxels
+
+	// everything is the same as Trace apart from the leaps
+	rayPos := params.RayStart.DivScalar((*voxels).Size())
+	dist, mapPos, face, ok := clipRay(rayPos, params.RayDir, (*voxels).Count())
+	if !ok {
+		result.Status = RAYCAST_MISS
+		result.HitPos = params.RayStart
+		result.MapPos = rayPos.Floor().ToVector3i()
+		return result
+	}
+	deltaDist := params.RayDir.Inverse().Abs()
+	step := params.RayDir.Sign().ToVector3i()
+	sideDist := calcSideDist(rayPos, params.RayDir, deltaDist, mapPos)
+
+	// leaps stop short of where the ray leaves the grid so it steps out
+	// like Trace does
+	exitDist := gridExit(rayPos, params.RayDir, (*voxels).Count())
+
+	result.Status = RAYCAST_MAX_STEPS
+	for {
+		if params.Callback != nil {
+			params.Callback(voxels, mapPos)
+		}
+
+		hit, oob := checkVoxel(voxels, mapPos, params.RayDir)
+		result.NumSteps++
+		if hit {
+			result.Status = RAYCAST_HIT
+			if face == FACE_NONE {
+				result.Status = RAYCAST_STARTED_INSIDE
+			}
+			break
+		} else if oob {
+			result.Status = RAYCAST_OUT_OF_BOUNDS
+			break
+		}
+
+		// leap over the empty space the field says is safe, the voxel we land
+		// in is empty and is checked and stepped out of like any other
+		if leapDist, leapPos, ok := tracer.leap(rayPos, params.RayDir, dist, mapPos, exitDist); ok {
+			dist, mapPos = leapDist, leapPos
+			sideDist = calcSideDist(rayPos, params.RayDir, deltaDist, mapPos)
+			face = entryFace(sideDist, deltaDist, step)
+		} else if sideDist.X <= sideDist.Y && sideDist.X <= sideDist.Z {
+			dist = sideDist.X
+			sideDist.X += deltaDist.X
+			mapPos.X += step.X
+			face = stepFace(0, step.X)
+		} else if sideDist.Y <= sideDist.X && sideDist.Y <= sideDist.Z {
+			dist = sideDist.Y
+			sideDist.Y += deltaDist.Y
+			mapPos.Y += step.Y
+			face = stepFace(1, step.Y)
+		} else {
+			dist = sideDist.Z
+			sideDist.Z += deltaDist.Z
+			mapPos.Z += step.Z
+			face = stepFace(2, step.Z)
+		}
+
+		if params.MaxSteps > 0 && result.NumSteps >= params.MaxSteps {
+			break
+		}
+	}
+
+	result.Face, result.Normal = face, face.Normal()
+	result.MapPos = mapPos
+	result.T = dist * (*voxels).Size()
+	result.HitPos = rayPos.Plus(params.RayDir.MulScalar(dist)).MulScalar((*voxels).Size())
+	result.snap()
+
+	return result
+}
+
+// leap returns how far along the ray it can jump from dist and the voxel it
+// lands in, or false if that isn't worth it. the field is in voxels and dist
+// is in lengths of rayDir, and the leap has to stay inside the grid
+func (tracer *DistanceFieldTracer) leap(rayPos Vector3f, rayDir Vector3f, dist float32, mapPos Vector3i, exitDist float32) (float32, Vector3i, bool) {
+	rayLength := rayDir.Length()
+	leap := tracer.leapDistance(rayPos.Plus(rayDir.MulScalar(dist)), mapPos)
+	leap = min(leap, (exitDist-dist)*rayLength-leapMargin)
+	if leap <= minLeap {
+		return 0, mapPos, false
+	}
+
+	dist += leap / rayLength
+	leapPos := clampToGrid(rayPos.Plus(rayDir.MulScalar(dist)).Floor().ToVector3i(), (*tracer.Voxels).Count())
+	return dist, leapPos, !leapPos.Equals(mapPos)
+}
+
+// gridExit returns how far along rayDir from rayPos, in voxels, the ray
+// leaves the grid
+func gridExit(rayPos Vector3f, rayDir Vector3f, count Vector3i) float32 {
+	exit := float32(math.Inf(1))
+	pos, dir, hi := [3]float32{rayPos.X, rayPos.Y, rayPos.Z}, [3]float32{rayDir.X, rayDir.Y, rayDir.Z}, [3]int32{count.X, count.Y, count.Z}
+	for i := range pos {
+		if dir[i] > 0 {
+			exit = min(exit, (float32(hi[i])-pos[i])/dir[i])
+		} else if dir[i] < 0 {
+			exit = min(exit, -pos[i]/dir[i])
+		}
+	}
+	return exit
+}
+
+// clampToGrid keeps mapPos inside a grid of count voxels
+func clampToGrid(mapPos Vector3i, count Vector3i) Vector3i {
+	return Vector3i{
+		X: max(0, min(count.X-1, mapPos.X)),
+		Y: max(0, min(count.Y-1, mapPos.Y)),
+		Z: max(0, min(count.Z-1, mapPos.Z)),
+	}
+}
+
+// entryFace is the face a ray came into its voxel through, the side it
+// crossed last is a deltaDist behind the next one on that axis. axes the ray
+// doesn't move along are never crossed
+func entryFace(sideDist Vector3f, deltaDist Vector3f, step Vector3i) Face {
+	crossed := func(side, delta float32) float32 {
+		if math.IsInf(float64(delta), 0) {
+			return float32(math.Inf(-1))
+		}
+		return side - delta
+	}
+
+	x, y, z := crossed(sideDist.X, deltaDist.X), crossed(sideDist.Y, deltaDist.Y), crossed(sideDist.Z, deltaDist.Z)
+	if x >= y && x >= z {
+		return stepFace(0, step.X)
+	} else if y >= z {
+		return stepFace(1, step.Y)
+	}
+	return stepFace(2, step.Z)
+}
+
+// leapDistance returns how far pos, in voxel mapPos, can move in any direction
+// without touching a set voxel. the field holds the distance between voxel
+// centers so both the offset from our center and the half diagonal of the
+// voxel we'd hit are taken off
+func (tracer *DistanceFieldTracer) leapDistance(pos Vector3f, mapPos Vector3i) float32 {
+	if isOutside(tracer.Voxels, mapPos) {
+		return 0
+	}
+
+	center := voxelCenter(mapPos)
+	return tracer.Field.Get(mapPos.X, mapPos.Y, mapPos.Z) - Distance(pos, center) - halfDiagonal - leapMargin
+}
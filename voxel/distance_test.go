@@ -0,0 +1,164 @@
+package voxel
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// bruteDistance is what the scenes used to do, check every voxel
+func bruteDistance(grid *VoxelGrid, x, y, z int32, to bool) float64 {
+	best := math.Inf(1)
+	for iy := int32(0); iy < grid.NumVoxelsY; iy++ {
+		for iz := int32(0); iz < grid.NumVoxelsZ; iz++ {
+			for ix := int32(0); ix < grid.NumVoxelsX; ix++ {
+				if grid.GetVoxel(ix, iy, iz) == to {
+					dx, dy, dz := float64(ix-x), float64(iy-y), float64(iz-z)
+					best = min(best, math.Sqrt(dx*dx+dy*dy+dz*dz))
+				}
+			}
+		}
+	}
+	return best
+}
+
+func TestDistanceField(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	grid := NewVoxelGrid(13, 9, 11, 1)
+	for i := 0; i < 40; i++ {
+		grid.SetVoxel(r.Int31n(13), r.Int31n(9), r.Int31n(11), true)
+	}
+	grid.Fill(Sphere{Center: Vector3f{X: 6, Y: 4, Z: 5}, Radius: 3.5}, FILL_UNION, 0)
+
+	for _, signed := range []bool{false, true} {
+		field := NewDistanceFieldFromGrid(grid, signed)
+
+		for y := int32(0); y < grid.NumVoxelsY; y++ {
+			for z := int32(0); z < grid.NumVoxelsZ; z++ {
+				for x := int32(0); x < grid.NumVoxelsX; x++ {
+					expected := bruteDistance(grid, x, y, z, true)
+					if signed && grid.GetVoxel(x, y, z) {
+						expected = -bruteDistance(grid, x, y, z, false)
+					}
+
+					// rounded towards zero to the nearest quarter
+					d := float64(field.Get(x, y, z))
+					if math.Abs(d) > math.Abs(expected) || math.Abs(expected)-math.Abs(d) >= 1.0/DISTANCE_SCALE || (d < 0) != (expected < 0) {
+						t.Fatalf("Signed %t distance at %d, %d, %d is %f, expected %f\n", signed, x, y, z, d, expected)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestDistanceFieldLookup(t *testing.T) {
+	voxels := NewChunkedVoxels(80, 8, 8, 0.5)
+	voxels.Set(0, 0, 0, true)
+
+	field := NewDistanceField(voxels, false)
+
+	// far away distances are clamped
+	if field.Get(79, 7, 7) != 255.0/DISTANCE_SCALE {
+		t.Fatalf("Incorrect clamped distance %f\n", field.Get(79, 7, 7))
+	}
+
+	// world space lookups are scaled by the voxel size
+	if d := field.Distance(Vector3f{X: 2.1, Y: 0.1, Z: 0.1}); d != 2 {
+		t.Fatalf("Incorrect world distance %f\n", d)
+	}
+
+	// outside the field is the distance to its bounds
+	if d := field.Distance(Vector3f{X: -3, Y: 0, Z: 0}); d != 3 {
+		t.Fatalf("Incorrect outside distance %f\n", d)
+	}
+
+	if d := field.Sample(Vector3f{X: 1.5, Y: 0.25, Z: 0.25}); d < 1 || d > 1.5 {
+		t.Fatalf("Incorrect sampled distance %f\n", d)
+	}
+
+	// with nothing set everything is as far as possible
+	empty := NewDistanceFieldFromGrid(NewVoxelGrid(4, 4, 4, 1), true)
+	if empty.Get(1, 1, 1) != float32(255-distanceBias)/DISTANCE_SCALE {
+		t.Fatalf("Incorrect empty distance %f\n", empty.Get(1, 1, 1))
+	}
+}
+
+func BenchmarkDistanceField(b *testing.B) {
+	grid := NewVoxelGrid(128, 128, 128, 1)
+	grid.Fill(Sphere{Center: Vector3f{X: 64, Y: 64, Z: 64}, Radius: 40}, FILL_UNION, 0)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		NewDistanceFieldFromGrid(grid, true)
+	}
+}
+
+func TestDistanceFieldTrace(t *testing.T) {
+	var sparse Voxels = NewTestVoxels(64, 64, 64, 1)
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 128; i++ {
+		sparse.Set(r.Int31n(64), r.Int31n(64), r.Int31n(64), true)
+	}
+
+	tracer := NewDistanceFieldTracer(&sparse)
+
+	for i := 0; i < 5000; i++ {
+		// some rays start outside the grid and the directions aren't all
+		// the same length, leaps have to be scaled to match
+		rs := Vector3f{X: r.Float32()*96 - 16, Y: r.Float32()*96 - 16, Z: r.Float32()*96 - 16}
+		rd := Vector3f{X: r.Float32() - 0.5, Y: r.Float32() - 0.5, Z: r.Float32() - 0.5}.Normalize().MulScalar(0.1 + r.Float32()*5)
+
+		params := TraceParams{RayStart: rs, RayDir: rd}
+		expected := Trace(&sparse, params)
+		result := tracer.Trace(params)
+
+		if expected.Status != result.Status || !expected.MapPos.Equals(result.MapPos) || expected.Face != result.Face {
+			t.Fatalf("Mismatch for %v %v: %+v, expected %+v\n", rs, rd, result, expected)
+		}
+
+		// t is in lengths of RayDir so short directions give big t
+		if Distance(expected.HitPos, result.HitPos) > 0.001 || math.Abs(float64(expected.T-result.T)) > 0.001*max(1, math.Abs(float64(expected.T))) {
+			t.Fatalf("Incorrect hitPos or t for %v %v: %+v, expected %+v\n", rs, rd, result, expected)
+		}
+
+		if result.NumSteps > expected.NumSteps {
+			t.Fatalf("Suspicious numSteps: %+v %+v\n", expected, result)
+		}
+	}
+}
+
+// benchTracer traces the heightfield with a tracer and reports the average
+// number of steps per ray
+func benchTracer(b *testing.B, tracer Tracer) {
+	rays := benchRays(1024)
+	numSteps := 0
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		numSteps += int(tracer.Trace(rays[i%len(rays)]).NumSteps)
+	}
+
+	b.ReportMetric(float64(numSteps)/float64(b.N), "steps/ray")
+}
+
+func BenchmarkMipmapTracer(b *testing.B) {
+	var voxels Voxels = NewTestVoxels(benchWidth, benchHeight, benchWidth, 1)
+	benchHeightfield(func(x, y, z int32) { voxels.Set(x, y, z, true) })
+
+	tracer := MipmapTracerImpl{Voxels: []*Voxels{&voxels}}
+	for lowest := &voxels; (*lowest).Count().Y > 2; {
+		lowest = (*lowest).Compress()
+		tracer.Voxels = append(tracer.Voxels, lowest)
+	}
+
+	benchTracer(b, &tracer)
+}
+
+func BenchmarkDistanceFieldTracer(b *testing.B) {
+	var voxels Voxels = NewTestVoxels(benchWidth, benchHeight, benchWidth, 1)
+	benchHeightfield(func(x, y, z int32) { voxels.Set(x, y, z, true) })
+
+	benchTracer(b, NewDistanceFieldTracer(&voxels))
+}
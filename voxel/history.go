@@ -0,0 +1,182 @@
+package voxel
+
+import (
+	"fmt"
+)
+
+// the state of a single voxel before or after an edit
+type voxelState struct {
+	set      bool
+	material Material
+}
+
+type voxelChange struct {
+	pos    Vector3i
+	before voxelState
+	after  voxelState
+}
+
+// Edit groups voxel changes so they can be undone in one go. changes are made
+// to the grid straight away, Commit adds them to the history
+type Edit struct {
+	history *History
+	changes []voxelChange
+	index   map[Vector3i]int // where each voxel is in changes
+}
+
+// History records edits to a grid so they can be undone and redone
+type History struct {
+	grid *VoxelGrid
+	undo []*Edit
+	redo []*Edit
+	edit *Edit // the edit in progress, if any
+}
+
+func NewHistory(grid *VoxelGrid) *History {
+	return &History{grid: grid}
+}
+
+// Begin starts a new edit, only one edit can be in progress at a time so
+// calling this again before Commit or Cancel commits the previous one
+func (history *History) Begin() *Edit {
+	if history.edit != nil {
+		history.edit.Commit()
+	}
+
+	history.edit = &Edit{
+		history: history,
+		index:   map[Vector3i]int{},
+	}
+	return history.edit
+}
+
+func (edit *Edit) SetVoxel(x, y, z int32, set bool) {
+	edit.change(x, y, z, voxelState{set: set})
+}
+
+func (edit *Edit) SetMaterial(x, y, z int32, m Material) {
+	edit.change(x, y, z, voxelState{set: true, material: m})
+}
+
+func (edit *Edit) change(x, y, z int32, state voxelState) {
+	grid := edit.history.grid
+	if !grid.Contains(x, y, z) {
+		fmt.Printf("Edit: Invalid XYZ - %d, %d, %d\n", x, y, z)
+		return
+	}
+
+	// only the state from before the first change to a voxel is kept
+	pos := Vector3i{X: x, Y: y, Z: z}
+	i, ok := edit.index[pos]
+	if !ok {
+		i = len(edit.changes)
+		edit.index[pos] = i
+		edit.changes = append(edit.changes, voxelChange{pos: pos, before: grid.voxelState(x, y, z)})
+	}
+	edit.changes[i].after = state
+
+	grid.setVoxelState(x, y, z, state)
+}
+
+// Commit adds the edit to the history, anything that was undone can no
+// longer be redone
+func (edit *Edit) Commit() {
+	history := edit.history
+	if history.edit != edit {
+		return
+	}
+	history.edit = nil
+
+	if len(edit.changes) == 0 {
+		return
+	}
+
+	edit.index = nil
+	history.undo = append(history.undo, edit)
+	history.redo = nil
+}
+
+// Cancel puts back everything the edit changed
+func (edit *Edit) Cancel() {
+	history := edit.history
+	if history.edit != edit {
+		return
+	}
+	history.edit = nil
+
+	edit.revert()
+}
+
+func (edit *Edit) revert() {
+	grid := edit.history.grid
+	for i := len(edit.changes) - 1; i >= 0; i-- {
+		change := &edit.changes[i]
+		grid.setVoxelState(change.pos.X, change.pos.Y, change.pos.Z, change.before)
+	}
+}
+
+func (edit *Edit) apply() {
+	grid := edit.history.grid
+	for i := range edit.changes {
+		change := &edit.changes[i]
+		grid.setVoxelState(change.pos.X, change.pos.Y, change.pos.Z, change.after)
+	}
+}
+
+// Undo reverts the last committed edit, returning false if there was nothing
+// to undo. an edit in progress is committed first
+func (history *History) Undo() bool {
+	if history.edit != nil {
+		history.edit.Commit()
+	}
+
+	n := len(history.undo)
+	if n == 0 {
+		return false
+	}
+
+	edit := history.undo[n-1]
+	history.undo = history.undo[:n-1]
+	edit.revert()
+	history.redo = append(history.redo, edit)
+	return true
+}
+
+// Redo makes the last undone edit again, returning false if there was
+// nothing to redo
+func (history *History) Redo() bool {
+	if history.edit != nil {
+		history.edit.Commit()
+	}
+
+	n := len(history.redo)
+	if n == 0 {
+		return false
+	}
+
+	edit := history.redo[n-1]
+	history.redo = history.redo[:n-1]
+	edit.apply()
+	history.undo = append(history.undo, edit)
+	return true
+}
+
+func (history *History) CanUndo() bool {
+	return len(history.undo) > 0
+}
+
+func (history *History) CanRedo() bool {
+	return len(history.redo) > 0
+}
+
+func (grid *VoxelGrid) voxelState(x, y, z int32) voxelState {
+	return voxelState{set: grid.GetVoxel(x, y, z), material: grid.GetMaterial(x, y, z)}
+}
+
+func (grid *VoxelGrid) setVoxelState(x, y, z int32, state voxelState) {
+	if state.set && state.material != 0 {
+		grid.SetMaterial(x, y, z, state.material)
+	} else {
+		grid.SetVoxel(x, y, z, state.set)
+	}
+}
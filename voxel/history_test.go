@@ -0,0 +1,75 @@
+package voxel
+
+import (
+	"testing"
+)
+
+func TestHistoryUndoRedo(t *testing.T) {
+	grid := NewVoxelGrid(8, 8, 8, 1)
+	grid.SetMaterial(1, 1, 1, 4)
+	history := NewHistory(grid)
+
+	edit := history.Begin()
+	edit.SetVoxel(0, 0, 0, true)
+	edit.SetMaterial(1, 1, 1, 6)
+	edit.SetMaterial(5, 5, 5, 2)
+	edit.SetVoxel(5, 5, 5, false) // only the first before state counts
+	edit.Commit()
+
+	second := history.Begin()
+	second.SetVoxel(1, 1, 1, false)
+	second.Commit()
+
+	if grid.GetVoxel(1, 1, 1) || !grid.GetVoxel(0, 0, 0) || grid.GetVoxel(5, 5, 5) {
+		t.Fatalf("Edits not applied\n")
+	}
+
+	if !history.Undo() || !grid.GetVoxel(1, 1, 1) || grid.GetMaterial(1, 1, 1) != 6 {
+		t.Fatalf("Undo of second edit failed\n")
+	}
+
+	if !history.Undo() || grid.GetVoxel(0, 0, 0) || grid.GetMaterial(1, 1, 1) != 4 || grid.GetVoxel(5, 5, 5) {
+		t.Fatalf("Undo of first edit failed\n")
+	}
+
+	if history.Undo() {
+		t.Fatalf("Undo with nothing left\n")
+	}
+
+	if !history.Redo() || !history.Redo() || history.Redo() {
+		t.Fatalf("Redo failed\n")
+	}
+
+	if grid.GetVoxel(1, 1, 1) || !grid.GetVoxel(0, 0, 0) {
+		t.Fatalf("Redo did not apply edits\n")
+	}
+
+	// a new edit after an undo throws away the redo
+	history.Undo()
+	edit = history.Begin()
+	edit.SetVoxel(7, 7, 7, true)
+	edit.Commit()
+
+	if history.CanRedo() || history.Redo() {
+		t.Fatalf("Redo should have been cleared\n")
+	}
+}
+
+func TestHistoryCancel(t *testing.T) {
+	grid := NewVoxelGrid(4, 4, 4, 1)
+	grid.Compress()
+	history := NewHistory(grid)
+
+	edit := history.Begin()
+	edit.SetMaterial(3, 3, 3, 1)
+	edit.SetVoxel(2, 2, 2, true)
+	edit.Cancel()
+
+	if grid.GetVoxel(3, 3, 3) || grid.GetVoxel(2, 2, 2) || grid.Child.GetVoxel(1, 1, 1) {
+		t.Fatalf("Cancel did not revert edits\n")
+	}
+
+	if history.CanUndo() {
+		t.Fatalf("Cancelled edit is in the history\n")
+	}
+}
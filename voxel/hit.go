@@ -0,0 +1,108 @@
+package voxel
+
+// Face is one of the six faces of a voxel, named after the way it points. a
+// ray going +x goes into a voxel through its FACE_NEG_X face
+type Face int8
+
+const (
+	FACE_NONE Face = iota
+	FACE_NEG_X
+	FACE_POS_X
+	FACE_NEG_Y
+	FACE_POS_Y
+	FACE_NEG_Z
+	FACE_POS_Z
+)
+
+var faceNormals = [...]Vector3f{
+	FACE_NONE:  {},
+	FACE_NEG_X: {X: -1},
+	FACE_POS_X: {X: 1},
+	FACE_NEG_Y: {Y: -1},
+	FACE_POS_Y: {Y: 1},
+	FACE_NEG_Z: {Z: -1},
+	FACE_POS_Z: {Z: 1},
+}
+
+// stepFace returns the face a ray goes in through when it steps along axis
+// 0, 1 or 2 in the direction of step
+func stepFace(axis int, step int32) Face {
+	if step > 0 {
+		return FACE_NEG_X + Face(axis*2)
+	}
+	return FACE_POS_X + Face(axis*2)
+}
+
+// Normal returns the direction the face points out of its voxel
+func (face Face) Normal() Vector3f {
+	return faceNormals[face]
+}
+
+// Offset returns the voxel on the other side of the face
+func (face Face) Offset() Vector3i {
+	return faceNormals[face].ToVector3i()
+}
+
+// Axis returns 0, 1 or 2 for faces across x, y or z, -1 for FACE_NONE
+func (face Face) Axis() int {
+	if face == FACE_NONE {
+		return -1
+	}
+	return (int(face) - 1) / 2
+}
+
+// RaycastHit is where a ray ended up and why it stopped, it comes from every
+// kind of tracer
+type RaycastHit struct {
+	Status RaycastResult
+
+	// the face of MapPos the ray came in through and which way it points,
+	// FACE_NONE if the ray started in MapPos
+	Face   Face
+	Normal Vector3f
+
+	// HitPos is RayStart + RayDir * T in world space, MapPos is the voxel it
+	// is in at grid Level, 0 being full res and counting up through Child
+	T      float32
+	HitPos Vector3f
+	MapPos Vector3i
+	Level  int32
+
+	// how many voxels were checked along the way
+	NumSteps int32
+}
+
+// Hit reports whether the ray stopped at a set voxel, either one it went
+// into or the one it started in
+func (hit *RaycastHit) Hit() bool {
+	return hit.Status == RAYCAST_HIT || hit.Status == RAYCAST_STARTED_INSIDE
+}
+
+// FaceCenter returns the middle of the face that was hit. voxelSize is the
+// size of the voxels at MapPos
+func (hit *RaycastHit) FaceCenter(voxelSize float32) Vector3f {
+	center := voxelCenter(hit.MapPos).MulScalar(voxelSize)
+	switch hit.Face.Axis() {
+	case 0:
+		center.X = hit.HitPos.X
+	case 1:
+		center.Y = hit.HitPos.Y
+	case 2:
+		center.Z = hit.HitPos.Z
+	default:
+		return Vector3fZero()
+	}
+	return center
+}
+
+// snap puts HitPos exactly on the face it crossed to undo rounding errors
+func (hit *RaycastHit) snap() {
+	switch hit.Face.Axis() {
+	case 0:
+		hit.HitPos = hit.HitPos.RoundX()
+	case 1:
+		hit.HitPos = hit.HitPos.RoundY()
+	case 2:
+		hit.HitPos = hit.HitPos.RoundZ()
+	}
+}
@@ -0,0 +1,45 @@
+package voxel
+
+import (
+	"testing"
+)
+
+func TestFace(t *testing.T) {
+	for axis := 0; axis < 3; axis++ {
+		in, out := stepFace(axis, 1), stepFace(axis, -1)
+		if in.Axis() != axis || out.Axis() != axis || in.Normal() != out.Normal().MulScalar(-1) {
+			t.Fatalf("Incorrect faces for axis %d: %d %d\n", axis, in, out)
+		}
+
+		// a ray going +ve comes in through the face pointing back at it
+		if in.Offset().ToVector3f() != in.Normal() || in.Normal().DotProduct(Vector3f{X: 1, Y: 1, Z: 1}) != -1 {
+			t.Fatalf("Incorrect offset for axis %d: %v\n", axis, in.Offset())
+		}
+	}
+
+	if FACE_NONE.Axis() != -1 || FACE_NONE.Normal() != Vector3fZero() {
+		t.Fatalf("Incorrect FACE_NONE\n")
+	}
+}
+
+func TestRaycastHitLevel(t *testing.T) {
+	grid := NewVoxelGrid(16, 16, 16, 1)
+	grid.SetVoxel(8, 8, 8, true)
+	lowest := grid.Compress().Compress()
+
+	hit := lowest.Raycast(Vector3f{X: 8.5, Y: 20, Z: 8.5}, Vector3f{Y: -1})
+	if !hit.Hit() || hit.Level != 2 || hit.Face != FACE_POS_Y || !hit.MapPos.Equals(Vector3i{X: 2, Y: 2, Z: 2}) {
+		t.Fatalf("Incorrect low res hit: %+v\n", hit)
+	}
+
+	hit = lowest.RaycastRecursive(Vector3f{X: 8.5, Y: 20, Z: 8.5}, Vector3f{Y: -1})
+	if !hit.Hit() || hit.Level != 0 || hit.Face != FACE_POS_Y || hit.HitPos.Y != 9 || hit.T != 11 {
+		t.Fatalf("Incorrect full res hit: %+v\n", hit)
+	}
+
+	// starting inside a set voxel isn't the same as hitting it
+	hit = grid.Raycast(Vector3f{X: 8.5, Y: 8.5, Z: 8.5}, Vector3f{Y: -1})
+	if hit.Status != RAYCAST_STARTED_INSIDE || hit.Face != FACE_NONE || !hit.Hit() {
+		t.Fatalf("Incorrect hit from inside: %+v\n", hit)
+	}
+}
@@ -0,0 +1,146 @@
+package voxel
+
+import (
+	"math/bits"
+)
+
+// VoxelFn is called for each voxel visited, returning false stops the visit
+type VoxelFn func(x, y, z int32) bool
+
+// the position of each bit within a brick
+var brickOffsets = func() [8]Vector3i {
+	var offsets [8]Vector3i
+	for bit := int32(0); bit < 8; bit++ {
+		offsets[bit] = Vector3i{X: bit & 1, Y: bit >> 2, Z: (bit >> 1) & 1}
+	}
+	return offsets
+}()
+
+// ForEachVoxel calls fn for every set voxel between from (inclusive) and to
+// (exclusive), a brick at a time, so voxels aren't visited in x, y, z order.
+// empty bricks are skipped without looking at their voxels and full ones
+// inside the region are visited without checking them
+func (grid *VoxelGrid) ForEachVoxel(from, to Vector3i, fn VoxelFn) {
+	grid.forEachBrick(from, to, func(i int32, brick Vector3i, voxels uint8, whole bool) bool {
+		if voxels == 255 && whole {
+			x, y, z := brick.X*2, brick.Y*2, brick.Z*2
+			return fn(x, y, z) && fn(x+1, y, z) && fn(x, y, z+1) && fn(x+1, y, z+1) &&
+				fn(x, y+1, z) && fn(x+1, y+1, z) && fn(x, y+1, z+1) && fn(x+1, y+1, z+1)
+		}
+
+		for voxels != 0 {
+			bit := bits.TrailingZeros8(voxels)
+			voxels &= voxels - 1
+
+			pos := Vector3i{X: brick.X*2 + brickOffsets[bit].X, Y: brick.Y*2 + brickOffsets[bit].Y, Z: brick.Z*2 + brickOffsets[bit].Z}
+			if !whole && !insideRegion(pos, from, to) {
+				continue
+			}
+			if !fn(pos.X, pos.Y, pos.Z) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// CountVoxels returns the number of set voxels between from (inclusive) and
+// to (exclusive)
+func (grid *VoxelGrid) CountVoxels(from, to Vector3i) int {
+	count := 0
+	grid.forEachBrick(from, to, func(i int32, brick Vector3i, voxels uint8, whole bool) bool {
+		if whole {
+			count += bits.OnesCount8(voxels)
+			return true
+		}
+		for bit := 0; bit < 8; bit++ {
+			offset := brickOffsets[bit]
+			pos := Vector3i{X: brick.X*2 + offset.X, Y: brick.Y*2 + offset.Y, Z: brick.Z*2 + offset.Z}
+			if voxels&(uint8(1)<<bit) != 0 && insideRegion(pos, from, to) {
+				count++
+			}
+		}
+		return true
+	})
+	return count
+}
+
+// ForEachSurfaceVoxel calls fn for every set voxel between from (inclusive)
+// and to (exclusive) that has an empty voxel, or the edge of the grid, on at least
+// one side. full bricks surrounded by full bricks are skipped without looking
+// at their voxels
+func (grid *VoxelGrid) ForEachSurfaceVoxel(from, to Vector3i, fn VoxelFn) {
+	bricks := Vector3i{X: halfCount(grid.NumVoxelsX), Y: halfCount(grid.NumVoxelsY), Z: halfCount(grid.NumVoxelsZ)}
+
+	full := func(brick Vector3i) bool {
+		if brick.X < 0 || brick.Y < 0 || brick.Z < 0 || brick.X >= bricks.X || brick.Y >= bricks.Y || brick.Z >= bricks.Z {
+			return false
+		}
+		return grid.voxels.get(grid.VoxelIndex(brick.X*2, brick.Y*2, brick.Z*2)) == 255
+	}
+
+	set := func(x, y, z int32) bool {
+		return grid.Contains(x, y, z) && grid.GetVoxel(x, y, z)
+	}
+
+	grid.forEachBrick(from, to, func(i int32, brick Vector3i, voxels uint8, whole bool) bool {
+		if voxels == 255 &&
+			full(Vector3i{X: brick.X - 1, Y: brick.Y, Z: brick.Z}) && full(Vector3i{X: brick.X + 1, Y: brick.Y, Z: brick.Z}) &&
+			full(Vector3i{X: brick.X, Y: brick.Y - 1, Z: brick.Z}) && full(Vector3i{X: brick.X, Y: brick.Y + 1, Z: brick.Z}) &&
+			full(Vector3i{X: brick.X, Y: brick.Y, Z: brick.Z - 1}) && full(Vector3i{X: brick.X, Y: brick.Y, Z: brick.Z + 1}) {
+			return true
+		}
+
+		for voxels != 0 {
+			bit := bits.TrailingZeros8(voxels)
+			voxels &= voxels - 1
+
+			x, y, z := brick.X*2+brickOffsets[bit].X, brick.Y*2+brickOffsets[bit].Y, brick.Z*2+brickOffsets[bit].Z
+			if !whole && !insideRegion(Vector3i{X: x, Y: y, Z: z}, from, to) {
+				continue
+			}
+			if set(x-1, y, z) && set(x+1, y, z) && set(x, y-1, z) && set(x, y+1, z) && set(x, y, z-1) && set(x, y, z+1) {
+				continue
+			}
+			if !fn(x, y, z) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// forEachBrick calls fn for each non empty brick that overlaps from to to,
+// whole is true when the brick lies entirely inside the region
+func (grid *VoxelGrid) forEachBrick(from, to Vector3i, fn func(i int32, brick Vector3i, voxels uint8, whole bool) bool) {
+	from = Vector3i{X: max(from.X, 0), Y: max(from.Y, 0), Z: max(from.Z, 0)}
+	to = Vector3i{X: min(to.X, grid.NumVoxelsX), Y: min(to.Y, grid.NumVoxelsY), Z: min(to.Z, grid.NumVoxelsZ)}
+	if from.X >= to.X || from.Y >= to.Y || from.Z >= to.Z {
+		return
+	}
+
+	brickMin := Vector3i{X: from.X / 2, Y: from.Y / 2, Z: from.Z / 2}
+	brickMax := Vector3i{X: halfCount(to.X), Y: halfCount(to.Y), Z: halfCount(to.Z)}
+
+	for by := brickMin.Y; by < brickMax.Y; by++ {
+		wholeY := by*2 >= from.Y && by*2+2 <= to.Y
+		for bz := brickMin.Z; bz < brickMax.Z; bz++ {
+			wholeZ := bz*2 >= from.Z && bz*2+2 <= to.Z
+			i := grid.VoxelIndex(brickMin.X*2, by*2, bz*2)
+			for bx := brickMin.X; bx < brickMax.X; bx, i = bx+1, i+1 {
+				voxels := grid.voxels.get(i)
+				if voxels == 0 {
+					continue
+				}
+				whole := wholeY && wholeZ && bx*2 >= from.X && bx*2+2 <= to.X
+				if !fn(i, Vector3i{X: bx, Y: by, Z: bz}, voxels, whole) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func insideRegion(pos, from, to Vector3i) bool {
+	return pos.X >= from.X && pos.Y >= from.Y && pos.Z >= from.Z && pos.X < to.X && pos.Y < to.Y && pos.Z < to.Z
+}
@@ -0,0 +1,108 @@
+package voxel
+
+import (
+	"testing"
+)
+
+func TestForEachVoxel(t *testing.T) {
+	grid := randomGrid(19, 17, 15, 3)
+	grid.Fill(Box{Min: Vector3f{X: 2, Y: 2, Z: 2}, Max: Vector3f{X: 12, Y: 14, Z: 10}}, FILL_UNION, 0)
+
+	regions := [][2]Vector3i{
+		{{}, grid.Count()},
+		{{X: 3, Y: 1, Z: 4}, {X: 12, Y: 11, Z: 9}},
+		{{X: -5, Y: -5, Z: -5}, {X: 100, Y: 100, Z: 100}},
+		{{X: 5, Y: 5, Z: 5}, {X: 5, Y: 9, Z: 9}},
+	}
+
+	for _, region := range regions {
+		from, to := region[0], region[1]
+
+		// what a plain loop over every voxel finds
+		expected := map[Vector3i]bool{}
+		surface := map[Vector3i]bool{}
+		set := func(x, y, z int32) bool { return grid.Contains(x, y, z) && grid.GetVoxel(x, y, z) }
+		for y := max(from.Y, 0); y < min(to.Y, grid.NumVoxelsY); y++ {
+			for z := max(from.Z, 0); z < min(to.Z, grid.NumVoxelsZ); z++ {
+				for x := max(from.X, 0); x < min(to.X, grid.NumVoxelsX); x++ {
+					if !grid.GetVoxel(x, y, z) {
+						continue
+					}
+					expected[Vector3i{X: x, Y: y, Z: z}] = true
+					if !set(x-1, y, z) || !set(x+1, y, z) || !set(x, y-1, z) || !set(x, y+1, z) || !set(x, y, z-1) || !set(x, y, z+1) {
+						surface[Vector3i{X: x, Y: y, Z: z}] = true
+					}
+				}
+			}
+		}
+
+		visited := map[Vector3i]bool{}
+		grid.ForEachVoxel(from, to, func(x, y, z int32) bool {
+			pos := Vector3i{X: x, Y: y, Z: z}
+			if visited[pos] || !expected[pos] {
+				t.Fatalf("Unexpected visit to %d, %d, %d\n", x, y, z)
+			}
+			visited[pos] = true
+			return true
+		})
+
+		if len(visited) != len(expected) || grid.CountVoxels(from, to) != len(expected) {
+			t.Fatalf("Incorrect count %d %d %d\n", len(visited), grid.CountVoxels(from, to), len(expected))
+		}
+
+		visited = map[Vector3i]bool{}
+		grid.ForEachSurfaceVoxel(from, to, func(x, y, z int32) bool {
+			visited[Vector3i{X: x, Y: y, Z: z}] = true
+			return true
+		})
+
+		if len(visited) != len(surface) {
+			t.Fatalf("Incorrect surface count %d %d\n", len(visited), len(surface))
+		}
+		for pos := range visited {
+			if !surface[pos] {
+				t.Fatalf("Not a surface voxel %+v\n", pos)
+			}
+		}
+	}
+
+	// returning false stops the visit
+	n := 0
+	grid.ForEachVoxel(Vector3i{}, grid.Count(), func(x, y, z int32) bool {
+		n++
+		return n < 10
+	})
+	if n != 10 {
+		t.Fatalf("Visit did not stop: %d\n", n)
+	}
+}
+
+func BenchmarkCountVoxels(b *testing.B) {
+	grid := NewVoxelGrid(benchWidth, benchHeight, benchWidth, 1)
+	benchHeightfield(func(x, y, z int32) { grid.SetVoxel(x, y, z, true) })
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		grid.CountVoxels(Vector3i{}, grid.Count())
+	}
+}
+
+func BenchmarkForEachSurfaceVoxel(b *testing.B) {
+	grid := NewVoxelGrid(benchWidth, benchHeight, benchWidth, 1)
+	benchHeightfield(func(x, y, z int32) { grid.SetVoxel(x, y, z, true) })
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		grid.ForEachSurfaceVoxel(Vector3i{}, grid.Count(), func(x, y, z int32) bool { return true })
+	}
+}
+
+func BenchmarkForEachVoxel(b *testing.B) {
+	grid := NewVoxelGrid(benchWidth, benchHeight, benchWidth, 1)
+	benchHeightfield(func(x, y, z int32) { grid.SetVoxel(x, y, z, true) })
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		grid.ForEachVoxel(Vector3i{}, grid.Count(), func(x, y, z int32) bool { return true })
+	}
+}
@@ -0,0 +1,126 @@
+package voxel
+
+import (
+	"fmt"
+)
+
+// Material is an index into a grid's Palette, 0 means no material was assigned
+type Material uint16
+
+// a brick whose voxels don't all share one material gets a small palette of
+// its own, each voxel then stores an index into it
+type brickPalette struct {
+	materials []Material
+	indices   [8]uint8
+}
+
+// brick material entries either hold the material for every voxel in the brick
+// or, when this bit is set, the index of the brick's palette
+const mixedBrick = uint32(1) << 31
+
+func (grid *VoxelGrid) GetMaterial(x, y, z int32) Material {
+	if grid.isOutside(Vector3i{X: x, Y: y, Z: z}) {
+		return 0
+	}
+
+	i := grid.VoxelIndex(x, y, z)
+	if grid.voxels.get(i)&voxelBitMask(x%2, y%2, z%2) == 0 {
+		return 0
+	}
+
+	if grid.materials.len() == 0 {
+		return 0
+	}
+
+	entry := grid.materials.get(i)
+	if entry&mixedBrick == 0 {
+		return Material(entry)
+	}
+
+	palette := grid.palettes.get(int32(entry &^ mixedBrick))
+	return palette.materials[palette.indices[voxelBit(x%2, y%2, z%2)]]
+}
+
+// SetMaterial sets the voxel and gives it a material
+func (grid *VoxelGrid) SetMaterial(x, y, z int32, m Material) {
+	if grid.isOutside(Vector3i{X: x, Y: y, Z: z}) {
+		fmt.Printf("SetMaterial: Invalid XYZ - %d, %d, %d\n", x, y, z)
+		return
+	}
+
+	grid.setVoxel(grid.VoxelIndex(x, y, z), voxelBit(x%2, y%2, z%2), true, m)
+}
+
+func (grid *VoxelGrid) brickMaterials(i int32) [8]Material {
+	var materials [8]Material
+
+	if grid.materials.len() == 0 {
+		return materials
+	}
+
+	entry := grid.materials.get(i)
+	if entry&mixedBrick == 0 {
+		for bit := range materials {
+			materials[bit] = Material(entry)
+		}
+		return materials
+	}
+
+	palette := grid.palettes.get(int32(entry &^ mixedBrick))
+	for bit := range materials {
+		materials[bit] = palette.materials[palette.indices[bit]]
+	}
+	return materials
+}
+
+// packBrickMaterials stores the materials for brick i as compactly as possible,
+// only the voxels that are present are taken into account
+func (grid *VoxelGrid) packBrickMaterials(i int32, materials [8]Material) {
+	voxels := grid.voxels.get(i)
+
+	// free the old palette, we'll make a new one if still needed
+	if entry := grid.materials.get(i); entry&mixedBrick != 0 {
+		grid.palettes.set(int32(entry&^mixedBrick), brickPalette{})
+		grid.freePalettes = append(grid.freePalettes, entry&^mixedBrick)
+	}
+
+	// find the distinct materials of the present voxels
+	palette := brickPalette{}
+	for bit := uint8(0); bit < 8; bit++ {
+		if voxels&(uint8(1)<<bit) == 0 {
+			continue
+		}
+		index := -1
+		for j, pm := range palette.materials {
+			if pm == materials[bit] {
+				index = j
+				break
+			}
+		}
+		if index < 0 {
+			index = len(palette.materials)
+			palette.materials = append(palette.materials, materials[bit])
+		}
+		palette.indices[bit] = uint8(index)
+	}
+
+	// one material (or none) for the whole brick is the cheap case
+	if len(palette.materials) <= 1 {
+		grid.materials.set(i, 0)
+		if len(palette.materials) == 1 {
+			grid.materials.set(i, uint32(palette.materials[0]))
+		}
+		return
+	}
+
+	var p uint32
+	if n := len(grid.freePalettes); n > 0 {
+		p = grid.freePalettes[n-1]
+		grid.freePalettes = grid.freePalettes[:n-1]
+		grid.palettes.set(int32(p), palette)
+	} else {
+		p = uint32(grid.palettes.append(palette))
+	}
+
+	grid.materials.set(i, mixedBrick|p)
+}
@@ -0,0 +1,66 @@
+package voxel
+
+import (
+	"testing"
+)
+
+func TestMaterialGetSet(t *testing.T) {
+	grid := NewVoxelGrid(4, 4, 4, 1)
+
+	// voxels set without a material have none
+	grid.SetVoxel(0, 0, 0, true)
+	if grid.GetMaterial(0, 0, 0) != 0 || grid.materials.len() != 0 {
+		t.Fatalf("Unexpected material\n")
+	}
+
+	grid.SetMaterial(1, 0, 0, 7)
+	grid.SetMaterial(2, 2, 2, 9)
+
+	if !grid.GetVoxel(1, 0, 0) || !grid.GetVoxel(2, 2, 2) {
+		t.Fatalf("SetMaterial did not set voxels\n")
+	}
+
+	if grid.GetMaterial(0, 0, 0) != 0 || grid.GetMaterial(1, 0, 0) != 7 || grid.GetMaterial(2, 2, 2) != 9 {
+		t.Fatalf("Incorrect materials: %d %d %d\n", grid.GetMaterial(0, 0, 0), grid.GetMaterial(1, 0, 0), grid.GetMaterial(2, 2, 2))
+	}
+
+	// empty voxels have no material
+	if grid.GetMaterial(3, 3, 3) != 0 || grid.GetMaterial(-1, 0, 0) != 0 {
+		t.Fatalf("Unexpected material\n")
+	}
+}
+
+func TestMaterialBrickPalette(t *testing.T) {
+	grid := NewVoxelGrid(2, 2, 2, 1)
+
+	// a uniform brick doesn't need a palette
+	for y := int32(0); y < 2; y++ {
+		for z := int32(0); z < 2; z++ {
+			for x := int32(0); x < 2; x++ {
+				grid.SetMaterial(x, y, z, 3)
+			}
+		}
+	}
+
+	if grid.voxels.get(0) != 255 || grid.materials.get(0) != 3 || grid.palettes.len() != 0 {
+		t.Fatalf("Brick not uniform: %d %d %d\n", grid.voxels.get(0), grid.materials.get(0), grid.palettes.len())
+	}
+
+	// a different material needs one
+	grid.SetMaterial(1, 1, 1, 4)
+	if grid.materials.get(0)&mixedBrick == 0 || grid.GetMaterial(1, 1, 1) != 4 || grid.GetMaterial(0, 1, 1) != 3 {
+		t.Fatalf("Brick not mixed: %d\n", grid.materials.get(0))
+	}
+
+	// once the odd voxel is cleared the brick is uniform again
+	grid.SetVoxel(1, 1, 1, false)
+	if grid.materials.get(0) != 3 || len(grid.freePalettes) != 1 {
+		t.Fatalf("Brick not uniform: %d\n", grid.materials.get(0))
+	}
+
+	// and the freed palette gets reused
+	grid.SetMaterial(1, 1, 1, 5)
+	if grid.palettes.len() != 1 || len(grid.freePalettes) != 0 || grid.GetMaterial(1, 1, 1) != 5 {
+		t.Fatalf("Palette not reused: %d %d\n", grid.palettes.len(), len(grid.freePalettes))
+	}
+}
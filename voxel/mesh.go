@@ -0,0 +1,283 @@
+package voxel
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image/color"
+	"io"
+)
+
+// Quad is a rectangle covering the faces of one or more voxels that share a
+// material. the corners go anticlockwise when looking at the front of the quad
+type Quad struct {
+	Corners  [4]Vector3f
+	Normal   Vector3f
+	Material Material
+	Color    color.RGBA
+}
+
+// Mesh is the visible surface of a grid, only faces between a set voxel and
+// an empty voxel, or the edge of the grid, are included
+type Mesh struct {
+	Quads []Quad
+}
+
+// the color given to voxels without a material or whose material isn't in
+// the grid's Palette
+var defaultMeshColor = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+
+// NewMesh builds a mesh of the grid's exposed faces, merging neighbouring
+// faces that point the same way and share a material into as few quads as it
+// can. corners are in world units, so voxel x, y, z covers x*VoxelSize to
+// (x+1)*VoxelSize
+func NewMesh(grid *VoxelGrid) *Mesh {
+	mesh := &Mesh{}
+	count := [3]int32{grid.NumVoxelsX, grid.NumVoxelsY, grid.NumVoxelsZ}
+
+	// slices with nothing in them can't have faces on either side, find
+	// them once rather than asking every voxel in them
+	var occupied [3][]bool
+	for d := range occupied {
+		occupied[d] = make([]bool, count[d])
+	}
+	grid.ForEachVoxel(Vector3i{}, grid.Count(), func(x, y, z int32) bool {
+		occupied[0][x], occupied[1][y], occupied[2][z] = true, true, true
+		return true
+	})
+
+	for d := 0; d < 3; d++ {
+		// u cross v points along d so quads built from them face +d
+		u, v := (d+1)%3, (d+2)%3
+
+		// the material + 1 of each voxel in a slice, 0 where it is empty.
+		// the slice in front of one plane is the one behind the next
+		behind := make([]int32, count[u]*count[v])
+		front := make([]int32, count[u]*count[v])
+		slice := func(s int32, out []int32) {
+			clear(out)
+			if s >= count[d] || !occupied[d][s] {
+				return
+			}
+			var from, to [3]int32
+			from[d], to[d], to[u], to[v] = s, s+1, count[u], count[v]
+			grid.ForEachVoxel(Vector3i{X: from[0], Y: from[1], Z: from[2]}, Vector3i{X: to[0], Y: to[1], Z: to[2]}, func(x, y, z int32) bool {
+				p := [3]int32{x, y, z}
+				out[p[u]+p[v]*count[u]] = int32(grid.GetMaterial(x, y, z)) + 1
+				return true
+			})
+		}
+
+		// each entry is the material + 1 of the face at that u, v, negative
+		// for faces pointing towards -d and 0 for no face
+		mask := make([]int32, count[u]*count[v])
+
+		// the plane at s is between slice s - 1 and slice s
+		for s := int32(0); s <= count[d]; s++ {
+			behind, front = front, behind
+			slice(s, front)
+
+			if (s == 0 || !occupied[d][s-1]) && (s == count[d] || !occupied[d][s]) {
+				continue
+			}
+
+			empty := true
+			for k := range mask {
+				mask[k] = 0
+				if behind[k] != 0 && front[k] == 0 {
+					mask[k] = behind[k]
+				} else if front[k] != 0 && behind[k] == 0 {
+					mask[k] = -front[k]
+				}
+				empty = empty && mask[k] == 0
+			}
+			if empty {
+				continue
+			}
+
+			// grow each face as far as it goes along u, then take as many
+			// rows along v as match it all the way across
+			for j := int32(0); j < count[v]; j++ {
+				for i := int32(0); i < count[u]; {
+					face := mask[i+j*count[u]]
+					if face == 0 {
+						i++
+						continue
+					}
+
+					w := int32(1)
+					for i+w < count[u] && mask[i+w+j*count[u]] == face {
+						w++
+					}
+
+					h := int32(1)
+				rows:
+					for j+h < count[v] {
+						for k := int32(0); k < w; k++ {
+							if mask[i+k+(j+h)*count[u]] != face {
+								break rows
+							}
+						}
+						h++
+					}
+
+					for l := int32(0); l < h; l++ {
+						for k := int32(0); k < w; k++ {
+							mask[i+k+(j+l)*count[u]] = 0
+						}
+					}
+
+					mesh.Quads = append(mesh.Quads, grid.meshQuad(d, u, v, s, i, j, w, h, face))
+					i += w
+				}
+			}
+		}
+	}
+
+	return mesh
+}
+
+func (grid *VoxelGrid) meshQuad(d, u, v int, s, i, j, w, h, face int32) Quad {
+	corner := func(du, dv int32) Vector3f {
+		var p [3]float32
+		p[d], p[u], p[v] = float32(s), float32(i+du), float32(j+dv)
+		return Vector3f{X: p[0], Y: p[1], Z: p[2]}.MulScalar(grid.VoxelSize)
+	}
+
+	var normal [3]float32
+	normal[d] = 1
+
+	quad := Quad{
+		Corners:  [4]Vector3f{corner(0, 0), corner(w, 0), corner(w, h), corner(0, h)},
+		Normal:   Vector3f{X: normal[0], Y: normal[1], Z: normal[2]},
+		Material: Material(face - 1),
+	}
+
+	if face < 0 {
+		quad.Corners[1], quad.Corners[3] = quad.Corners[3], quad.Corners[1]
+		quad.Normal = quad.Normal.MulScalar(-1)
+		quad.Material = Material(-face - 1)
+	}
+
+	quad.Color = defaultMeshColor
+	if quad.Material != 0 && int(quad.Material) < len(grid.Palette) {
+		quad.Color = grid.Palette[quad.Material]
+	}
+
+	return quad
+}
+
+// meshVertex is a corner of a quad along with everything that stops it being
+// shared with the corners of other quads
+type meshVertex struct {
+	pos    Vector3f
+	normal Vector3f
+	color  color.RGBA
+}
+
+// indexed returns the unique vertices of the mesh and the indices of each
+// quad's corners. matchNormals keeps corners with different normals apart
+func (mesh *Mesh) indexed(matchNormals bool) ([]meshVertex, [][4]int) {
+	var vertices []meshVertex
+	faces := make([][4]int, len(mesh.Quads))
+	indices := map[meshVertex]int{}
+
+	for q, quad := range mesh.Quads {
+		for c, pos := range quad.Corners {
+			vertex := meshVertex{pos: pos, color: quad.Color}
+			if matchNormals {
+				vertex.normal = quad.Normal
+			}
+
+			index, ok := indices[vertex]
+			if !ok {
+				index = len(vertices)
+				indices[vertex] = index
+				vertices = append(vertices, vertex)
+			}
+			faces[q][c] = index
+		}
+	}
+
+	return vertices, faces
+}
+
+// WriteOBJ writes the mesh as a Wavefront OBJ file. colors are written after
+// each vertex position, which most tools that read OBJ files understand, and
+// each face refers to one of the six normals
+func (mesh *Mesh) WriteOBJ(w io.Writer) error {
+	vertices, faces := mesh.indexed(false)
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# %d vertices, %d faces\n", len(vertices), len(faces))
+
+	for _, vertex := range vertices {
+		fmt.Fprintf(bw, "v %g %g %g %.4g %.4g %.4g\n", vertex.pos.X, vertex.pos.Y, vertex.pos.Z,
+			float32(vertex.color.R)/255, float32(vertex.color.G)/255, float32(vertex.color.B)/255)
+	}
+
+	normals := map[Vector3f]int{}
+	for _, quad := range mesh.Quads {
+		if _, ok := normals[quad.Normal]; !ok {
+			normals[quad.Normal] = len(normals) + 1
+			fmt.Fprintf(bw, "vn %g %g %g\n", quad.Normal.X, quad.Normal.Y, quad.Normal.Z)
+		}
+	}
+
+	// obj indices start at 1
+	for q, face := range faces {
+		n := normals[mesh.Quads[q].Normal]
+		fmt.Fprintf(bw, "f %d//%d %d//%d %d//%d %d//%d\n", face[0]+1, n, face[1]+1, n, face[2]+1, n, face[3]+1, n)
+	}
+
+	return bw.Flush()
+}
+
+// WritePLY writes the mesh as a binary little endian PLY file. PLY keeps
+// normals on vertices so corners are only shared between quads that face
+// the same way
+func (mesh *Mesh) WritePLY(w io.Writer) error {
+	vertices, faces := mesh.indexed(true)
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "ply\nformat binary_little_endian 1.0\n")
+	fmt.Fprintf(bw, "element vertex %d\n", len(vertices))
+	fmt.Fprintf(bw, "property float x\nproperty float y\nproperty float z\n")
+	fmt.Fprintf(bw, "property float nx\nproperty float ny\nproperty float nz\n")
+	fmt.Fprintf(bw, "property uchar red\nproperty uchar green\nproperty uchar blue\n")
+	fmt.Fprintf(bw, "element face %d\n", len(faces))
+	fmt.Fprintf(bw, "property list uchar int vertex_indices\n")
+	fmt.Fprintf(bw, "end_header\n")
+
+	for _, vertex := range vertices {
+		if err := binary.Write(bw, binary.LittleEndian, plyVertex{
+			X: vertex.pos.X, Y: vertex.pos.Y, Z: vertex.pos.Z,
+			NX: vertex.normal.X, NY: vertex.normal.Y, NZ: vertex.normal.Z,
+			R: vertex.color.R, G: vertex.color.G, B: vertex.color.B,
+		}); err != nil {
+			return err
+		}
+	}
+
+	for _, face := range faces {
+		if err := binary.Write(bw, binary.LittleEndian, plyFace{
+			N:       4,
+			Indices: [4]int32{int32(face[0]), int32(face[1]), int32(face[2]), int32(face[3])},
+		}); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+type plyVertex struct {
+	X, Y, Z    float32
+	NX, NY, NZ float32
+	R, G, B    uint8
+}
+
+type plyFace struct {
+	N       uint8
+	Indices [4]int32
+}
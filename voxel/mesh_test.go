@@ -0,0 +1,197 @@
+package voxel
+
+import (
+	"bufio"
+	"bytes"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+// checkWatertight splits every quad edge into voxel sized pieces and checks
+// each piece is matched by one going the other way, T junctions left by
+// merging faces are fine as long as nothing is left open
+func checkWatertight(t *testing.T, grid *VoxelGrid, mesh *Mesh) {
+	edges := map[[2]Vector3i]int{}
+
+	for _, quad := range mesh.Quads {
+		for c := range quad.Corners {
+			from := quad.Corners[c].DivScalar(grid.VoxelSize).ToVector3i()
+			to := quad.Corners[(c+1)%4].DivScalar(grid.VoxelSize).ToVector3i()
+			step := Vector3i{X: sign(to.X - from.X), Y: sign(to.Y - from.Y), Z: sign(to.Z - from.Z)}
+			for p := from; !p.Equals(to); {
+				next := Vector3i{X: p.X + step.X, Y: p.Y + step.Y, Z: p.Z + step.Z}
+				edges[[2]Vector3i{p, next}]++
+				edges[[2]Vector3i{next, p}]--
+				p = next
+			}
+		}
+	}
+
+	for edge, n := range edges {
+		if n != 0 {
+			t.Fatalf("Open edge: %+v %d\n", edge, n)
+		}
+	}
+}
+
+func sign(n int32) int32 {
+	if n < 0 {
+		return -1
+	} else if n > 0 {
+		return 1
+	}
+	return 0
+}
+
+// exposedFaces counts the voxel faces the mesh should cover
+func exposedFaces(grid *VoxelGrid) int {
+	set := func(x, y, z int32) bool { return grid.Contains(x, y, z) && grid.GetVoxel(x, y, z) }
+	faces := 0
+	grid.ForEachVoxel(Vector3i{}, grid.Count(), func(x, y, z int32) bool {
+		for _, n := range []Vector3i{{X: -1}, {X: 1}, {Y: -1}, {Y: 1}, {Z: -1}, {Z: 1}} {
+			if !set(x+n.X, y+n.Y, z+n.Z) {
+				faces++
+			}
+		}
+		return true
+	})
+	return faces
+}
+
+func checkMesh(t *testing.T, grid *VoxelGrid, mesh *Mesh) {
+	checkWatertight(t, grid, mesh)
+
+	area := float32(0)
+	for _, quad := range mesh.Quads {
+		// the normal has to agree with the winding
+		edge1 := quad.Corners[1].Sub(quad.Corners[0])
+		edge2 := quad.Corners[3].Sub(quad.Corners[0])
+		cross := edge1.CrossProduct(edge2)
+		if cross.DotProduct(quad.Normal) <= 0 {
+			t.Fatalf("Quad faces the wrong way: %+v\n", quad)
+		}
+		area += cross.Length()
+	}
+
+	faceArea := grid.VoxelSize * grid.VoxelSize
+	if expected := exposedFaces(grid); int(area/faceArea+0.5) != expected {
+		t.Fatalf("Incorrect area: %f %d\n", area/faceArea, expected)
+	}
+}
+
+func TestMeshSingleVoxel(t *testing.T) {
+	grid := NewVoxelGrid(3, 3, 3, 0.5)
+	grid.SetVoxel(1, 1, 1, true)
+
+	mesh := NewMesh(grid)
+	if len(mesh.Quads) != 6 {
+		t.Fatalf("Incorrect quads: %d\n", len(mesh.Quads))
+	}
+	checkMesh(t, grid, mesh)
+
+	for _, quad := range mesh.Quads {
+		if quad.Color != defaultMeshColor {
+			t.Fatalf("Incorrect color: %+v\n", quad.Color)
+		}
+	}
+}
+
+func TestMeshBox(t *testing.T) {
+	grid := NewVoxelGrid(9, 8, 7, 1)
+	grid.Palette = []color.RGBA{{}, {R: 255, A: 255}, {G: 255, A: 255}}
+
+	// a box touching the edge of the grid still gets its faces there
+	grid.Fill(Box{Min: Vector3f{X: 1, Y: 0, Z: 2}, Max: Vector3f{X: 6, Y: 5, Z: 7}}, FILL_UNION, 1)
+
+	mesh := NewMesh(grid)
+	if len(mesh.Quads) != 6 {
+		t.Fatalf("Incorrect quads: %d\n", len(mesh.Quads))
+	}
+	checkMesh(t, grid, mesh)
+
+	// a second material splits the faces it touches in two
+	grid.Fill(Box{Min: Vector3f{X: 1, Y: 0, Z: 2}, Max: Vector3f{X: 3, Y: 5, Z: 7}}, FILL_UNION, 2)
+
+	mesh = NewMesh(grid)
+	if len(mesh.Quads) != 10 {
+		t.Fatalf("Incorrect quads: %d\n", len(mesh.Quads))
+	}
+	checkMesh(t, grid, mesh)
+
+	for _, quad := range mesh.Quads {
+		if quad.Color != grid.Palette[quad.Material] {
+			t.Fatalf("Incorrect color: %+v\n", quad)
+		}
+	}
+}
+
+func TestMeshShapes(t *testing.T) {
+	grid := NewVoxelGrid(24, 21, 23, 0.25)
+	grid.Fill(Sphere{Center: Vector3f{X: 3, Y: 2.5, Z: 3}, Radius: 2}, FILL_UNION, 0)
+	grid.Fill(Box{Min: Vector3f{X: 2, Y: 2, Z: 2}, Max: Vector3f{X: 4, Y: 3, Z: 4}}, FILL_SUBTRACT, 0)
+
+	mesh := NewMesh(grid)
+	checkMesh(t, grid, mesh)
+
+	if len(mesh.Quads) >= exposedFaces(grid) {
+		t.Fatalf("Faces not merged: %d %d\n", len(mesh.Quads), exposedFaces(grid))
+	}
+
+	random := randomGrid(13, 11, 9, 5)
+	checkMesh(t, random, NewMesh(random))
+
+	if len(NewMesh(NewVoxelGrid(4, 4, 4, 1)).Quads) != 0 {
+		t.Fatalf("Empty grid has faces\n")
+	}
+}
+
+func TestMeshWrite(t *testing.T) {
+	grid := NewVoxelGrid(4, 4, 4, 1)
+	grid.Palette = []color.RGBA{{}, {R: 255, A: 255}}
+	grid.SetMaterial(0, 0, 0, 1)
+	grid.SetVoxel(1, 0, 0, true)
+
+	mesh := NewMesh(grid)
+
+	var obj bytes.Buffer
+	if err := mesh.WriteOBJ(&obj); err != nil {
+		t.Fatalf("WriteOBJ failed: %v\n", err)
+	}
+
+	counts := map[string]int{}
+	scanner := bufio.NewScanner(&obj)
+	for scanner.Scan() {
+		counts[strings.Fields(scanner.Text())[0]]++
+	}
+
+	// the two colors keep the shared corners apart, ply also keeps apart
+	// corners shared by quads facing different ways
+	if counts["v"] != 16 || counts["vn"] != 6 || counts["f"] != len(mesh.Quads) {
+		t.Fatalf("Incorrect obj: %+v %d\n", counts, len(mesh.Quads))
+	}
+
+	var ply bytes.Buffer
+	if err := mesh.WritePLY(&ply); err != nil {
+		t.Fatalf("WritePLY failed: %v\n", err)
+	}
+
+	header, body, found := strings.Cut(ply.String(), "end_header\n")
+	if !found || !strings.Contains(header, "element vertex 40\n") || !strings.Contains(header, "element face 10\n") {
+		t.Fatalf("Incorrect ply header: %s\n", header)
+	}
+
+	if len(body) != 40*27+10*17 {
+		t.Fatalf("Incorrect ply size: %d\n", len(body))
+	}
+}
+
+func BenchmarkMesh(b *testing.B) {
+	grid := NewVoxelGrid(benchWidth, benchHeight, benchWidth, 1)
+	benchHeightfield(func(x, y, z int32) { grid.SetVoxel(x, y, z, true) })
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		NewMesh(grid)
+	}
+}
@@ -0,0 +1,185 @@
+package voxel
+
+import (
+	"bufio"
+	"fmt"
+	"image/color"
+	"io"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Triangle is one face of a TriangleMesh, Material is an index into the
+// mesh's Materials or -1 when the face has none
+type Triangle struct {
+	Corners  [3]Vector3f
+	Material int
+}
+
+// MeshMaterial is a material from an MTL file, only the diffuse color is kept
+type MeshMaterial struct {
+	Name  string
+	Color color.RGBA
+}
+
+// TriangleMesh is a list of triangles as read from a Wavefront OBJ file
+type TriangleMesh struct {
+	Triangles []Triangle
+	Materials []MeshMaterial
+}
+
+// Bounds returns the smallest box containing every triangle
+func (mesh *TriangleMesh) Bounds() (Vector3f, Vector3f) {
+	if len(mesh.Triangles) == 0 {
+		return Vector3f{}, Vector3f{}
+	}
+
+	lo, hi := mesh.Triangles[0].Corners[0], mesh.Triangles[0].Corners[0]
+	for _, tri := range mesh.Triangles {
+		for _, c := range tri.Corners {
+			lo, hi = lo.Min(c), hi.Max(c)
+		}
+	}
+	return lo, hi
+}
+
+// ReadOBJ reads the vertices and faces of a Wavefront OBJ file, faces with
+// more than three corners are split into triangles. material libraries named
+// by mtllib are opened from fsys, which can be nil to ignore them, and the
+// faces that follow a usemtl take that material
+func ReadOBJ(r io.Reader, fsys fs.FS) (*TriangleMesh, error) {
+	mesh := &TriangleMesh{}
+	materials := map[string]int{}
+	var vertices []Vector3f
+	material := -1
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		switch fields[0] {
+		case "v":
+			v, err := parseVector(fields[1:])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			vertices = append(vertices, v)
+
+		case "f":
+			if len(fields) < 4 {
+				return nil, fmt.Errorf("line %d: face has %d corners", line, len(fields)-1)
+			}
+
+			corners := make([]Vector3f, len(fields)-1)
+			for i, field := range fields[1:] {
+				// only the vertex index matters, not the texture or normal
+				index, _, _ := strings.Cut(field, "/")
+				n, err := strconv.Atoi(index)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", line, err)
+				}
+
+				// negative indices count back from the last vertex
+				if n < 0 {
+					n += len(vertices) + 1
+				}
+				if n < 1 || n > len(vertices) {
+					return nil, fmt.Errorf("line %d: no vertex %s", line, index)
+				}
+				corners[i] = vertices[n-1]
+			}
+
+			for i := 2; i < len(corners); i++ {
+				mesh.Triangles = append(mesh.Triangles, Triangle{
+					Corners:  [3]Vector3f{corners[0], corners[i-1], corners[i]},
+					Material: material,
+				})
+			}
+
+		case "mtllib":
+			if fsys == nil {
+				continue
+			}
+			for _, name := range fields[1:] {
+				if err := mesh.readMTL(fsys, path.Clean(name), materials); err != nil {
+					return nil, fmt.Errorf("line %d: %w", line, err)
+				}
+			}
+
+		case "usemtl":
+			material = -1
+			if len(fields) > 1 {
+				if i, ok := materials[fields[1]]; ok {
+					material = i
+				}
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return mesh, nil
+}
+
+func (mesh *TriangleMesh) readMTL(fsys fs.FS, name string, materials map[string]int) error {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	current := -1
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		switch fields[0] {
+		case "newmtl":
+			current = len(mesh.Materials)
+			materials[fields[1]] = current
+			mesh.Materials = append(mesh.Materials, MeshMaterial{Name: fields[1], Color: color.RGBA{R: 255, G: 255, B: 255, A: 255}})
+
+		case "Kd":
+			if current < 0 {
+				continue
+			}
+			kd, err := parseVector(fields[1:])
+			if err != nil {
+				return fmt.Errorf("%s line %d: %w", name, line, err)
+			}
+			mesh.Materials[current].Color = color.RGBA{R: unitToByte(kd.X), G: unitToByte(kd.Y), B: unitToByte(kd.Z), A: 255}
+		}
+	}
+
+	return scanner.Err()
+}
+
+func parseVector(fields []string) (Vector3f, error) {
+	if len(fields) < 3 {
+		return Vector3f{}, fmt.Errorf("expected 3 values, got %d", len(fields))
+	}
+
+	var v [3]float32
+	for i := range v {
+		f, err := strconv.ParseFloat(fields[i], 32)
+		if err != nil {
+			return Vector3f{}, err
+		}
+		v[i] = float32(f)
+	}
+	return Vector3f{X: v[0], Y: v[1], Z: v[2]}, nil
+}
+
+func unitToByte(f float32) uint8 {
+	return uint8(min(max(f, 0), 1)*255 + 0.5)
+}
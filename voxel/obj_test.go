@@ -0,0 +1,89 @@
+package voxel
+
+import (
+	"image/color"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// a 4x4x4 cube with the bottom, top and sides in different materials
+const cubeOBJ = `# cube
+mtllib cube.mtl
+v 0 0 0
+v 4 0 0
+v 4 0 4
+v 0 0 4
+v 0 4 0
+v 4 4 0
+v 4 4 4
+v 0 4 4
+usemtl bottom
+f 1 2 3 4
+usemtl top
+f 5/1 8/2 7/3 6/4
+usemtl missing
+f 1//1 5//1 6//1 2//1
+f -6 -2 -1 -5
+usemtl sides
+f 2/1/1 6/1/1 7/1/1 3/1/1
+f 4 8 5 1
+`
+
+const cubeMTL = `newmtl bottom
+Kd 1 0 0
+newmtl top
+Kd 0 1 0.5
+newmtl sides
+Kd 0 0 1
+`
+
+func cubeMesh(t *testing.T) *TriangleMesh {
+	mesh, err := ReadOBJ(strings.NewReader(cubeOBJ), fstest.MapFS{"cube.mtl": {Data: []byte(cubeMTL)}})
+	if err != nil {
+		t.Fatalf("ReadOBJ failed: %v\n", err)
+	}
+	return mesh
+}
+
+func TestReadOBJ(t *testing.T) {
+	mesh := cubeMesh(t)
+
+	if len(mesh.Triangles) != 12 {
+		t.Fatalf("Incorrect triangles: %d\n", len(mesh.Triangles))
+	}
+
+	if len(mesh.Materials) != 3 || mesh.Materials[1].Name != "top" || mesh.Materials[1].Color != (color.RGBA{G: 255, B: 128, A: 255}) {
+		t.Fatalf("Incorrect materials: %+v\n", mesh.Materials)
+	}
+
+	// quads are split into a fan, unknown materials are left out
+	expected := []int{0, 0, 1, 1, -1, -1, -1, -1, 2, 2, 2, 2}
+	for i, tri := range mesh.Triangles {
+		if tri.Material != expected[i] {
+			t.Fatalf("Incorrect material: %d %d\n", i, tri.Material)
+		}
+	}
+
+	// negative indices count back from the last vertex
+	if mesh.Triangles[6].Corners != [3]Vector3f{{X: 4, Z: 4}, {X: 4, Y: 4, Z: 4}, {Y: 4, Z: 4}} {
+		t.Fatalf("Incorrect corners: %+v\n", mesh.Triangles[6].Corners)
+	}
+
+	lo, hi := mesh.Bounds()
+	if lo != (Vector3f{}) || hi != (Vector3f{X: 4, Y: 4, Z: 4}) {
+		t.Fatalf("Incorrect bounds: %+v %+v\n", lo, hi)
+	}
+
+	// materials are ignored without somewhere to find them
+	mesh, err := ReadOBJ(strings.NewReader(cubeOBJ), nil)
+	if err != nil || len(mesh.Materials) != 0 || mesh.Triangles[0].Material != -1 {
+		t.Fatalf("Materials not ignored: %v %+v\n", err, mesh.Materials)
+	}
+
+	for _, bad := range []string{"v 1 2\n", "v 0 0 0\nf 1 2\n", "v 0 0 0\nf 1 1 2\n", "v 0 0 0\nf 1 1 x\n", "mtllib missing.mtl\n"} {
+		if _, err := ReadOBJ(strings.NewReader(bad), fstest.MapFS{}); err == nil {
+			t.Fatalf("Expected error: %q\n", bad)
+		}
+	}
+}
@@ -0,0 +1,452 @@
+package voxel
+
+import (
+	"math"
+	"unsafe"
+)
+
+// each node covers a cube of voxels split into 8 children, the mask says which
+// children have something in them. nodes covering 2x2x2 voxels have no
+// children, their mask holds the voxels themselves in the same layout as a
+// VoxelGrid brick
+type octreeNode struct {
+	children uint32 // index of the first of 8 child nodes
+	mask     uint8
+}
+
+// Octree is a sparse voxel octree which only stores nodes that aren't empty
+type Octree struct {
+	root  octreeNode
+	nodes []octreeNode
+	free  []uint32 // blocks of 8 nodes no longer used by a node, to be reused
+	depth int32    // the root covers 2^depth voxels in each direction
+	size  float32
+	count Vector3i
+}
+
+func NewOctree(voxels Voxels) *Octree {
+	return buildOctree(voxels.Count(), voxels.Size(), voxels.Get)
+}
+
+func NewOctreeFromGrid(grid *VoxelGrid) *Octree {
+	return buildOctree(Vector3i{X: grid.NumVoxelsX, Y: grid.NumVoxelsY, Z: grid.NumVoxelsZ}, grid.VoxelSize, func(x, y, z int32) bool {
+		if grid.isOutside(Vector3i{X: x, Y: y, Z: z}) {
+			return false
+		}
+		return grid.GetVoxel(x, y, z)
+	})
+}
+
+func buildOctree(count Vector3i, size float32, get func(x, y, z int32) bool) *Octree {
+	octree := &Octree{
+		depth: 1,
+		size:  size,
+		count: count,
+	}
+
+	// root needs to be big enough to cover the whole grid
+	for int32(1)<<octree.depth < max(count.X, count.Y, count.Z) {
+		octree.depth++
+	}
+
+	octree.root = octree.build(octree.depth, 0, 0, 0, func(x, y, z int32) bool {
+		if x >= count.X || y >= count.Y || z >= count.Z {
+			return false
+		}
+		return get(x, y, z)
+	})
+
+	return octree
+}
+
+func (octree *Octree) build(level, x, y, z int32, get func(x, y, z int32) bool) octreeNode {
+	half := int32(1) << (level - 1)
+
+	var node octreeNode
+	var children [8]octreeNode
+
+	for c := int32(0); c < 8; c++ {
+		cx, cy, cz := x+(c&1)*half, y+(c>>2)*half, z+((c>>1)&1)*half
+		if level == 1 {
+			if get(cx, cy, cz) {
+				node.mask |= uint8(1) << c
+			}
+			continue
+		}
+		children[c] = octree.build(level-1, cx, cy, cz, get)
+		if children[c].mask != 0 {
+			node.mask |= uint8(1) << c
+		}
+	}
+
+	// only nodes that have something in them store their children
+	if level > 1 && node.mask != 0 {
+		node.children = uint32(len(octree.nodes))
+		octree.nodes = append(octree.nodes, children[:]...)
+	}
+
+	return node
+}
+
+func octreeChild(level, x, y, z int32) int32 {
+	shift := level - 1
+	return (x>>shift)&1 + ((z>>shift)&1)*2 + ((y>>shift)&1)*4
+}
+
+func (octree *Octree) inside(x, y, z int32) bool {
+	return x >= 0 && y >= 0 && z >= 0 && x < octree.count.X && y < octree.count.Y && z < octree.count.Z
+}
+
+func (octree *Octree) Get(x, y, z int32) bool {
+	if !octree.inside(x, y, z) {
+		return false
+	}
+
+	node := octree.root
+	for level := octree.depth; level > 1; level-- {
+		c := octreeChild(level, x, y, z)
+		if node.mask&(uint8(1)<<c) == 0 {
+			return false
+		}
+		node = octree.nodes[node.children+uint32(c)]
+	}
+
+	return node.mask&(uint8(1)<<octreeChild(1, x, y, z)) != 0
+}
+
+// node returns the root for index -1, nodes are referred to by index as
+// appending new ones can move them
+func (octree *Octree) node(i int64) *octreeNode {
+	if i < 0 {
+		return &octree.root
+	}
+	return &octree.nodes[i]
+}
+
+func (octree *Octree) Set(x, y, z int32, b bool) {
+	if !octree.inside(x, y, z) {
+		return
+	}
+
+	// remember the path down so masks can be fixed on the way back up
+	path := make([]int64, 0, octree.depth)
+	node := int64(-1)
+
+	for level := octree.depth; level > 1; level-- {
+		c := uint32(octreeChild(level, x, y, z))
+		if octree.node(node).mask&(uint8(1)<<c) == 0 {
+			// nothing to clear below an empty node
+			if !b {
+				return
+			}
+			if octree.node(node).mask == 0 {
+				children := octree.allocChildren()
+				octree.node(node).children = children
+			}
+			octree.node(node).mask |= uint8(1) << c
+		}
+		path = append(path, node)
+		node = int64(octree.node(node).children + c)
+	}
+
+	mask := uint8(1) << octreeChild(1, x, y, z)
+	if b {
+		octree.node(node).mask |= mask
+		return
+	}
+
+	octree.node(node).mask &= ^mask
+
+	// clear the parents of any nodes that are now empty, a parent with
+	// nothing left in it doesn't need its children any more
+	for level := int32(2); octree.node(node).mask == 0 && len(path) > 0; level++ {
+		node = path[len(path)-1]
+		path = path[:len(path)-1]
+		octree.node(node).mask &= ^(uint8(1) << octreeChild(level, x, y, z))
+		if octree.node(node).mask == 0 {
+			octree.free = append(octree.free, octree.node(node).children)
+		}
+	}
+}
+
+// allocChildren returns the index of a block of 8 empty nodes, reusing one
+// that was freed if there is one. a node only has children while its mask
+// isn't 0 so freed nodes are already empty, any children they had were
+// freed before them
+func (octree *Octree) allocChildren() uint32 {
+	if n := len(octree.free); n > 0 {
+		children := octree.free[n-1]
+		octree.free = octree.free[:n-1]
+		return children
+	}
+
+	children := uint32(len(octree.nodes))
+	octree.nodes = append(octree.nodes, make([]octreeNode, 8)...)
+	return children
+}
+
+func (octree *Octree) Size() float32 {
+	return octree.size
+}
+
+func (octree *Octree) Count() Vector3i {
+	return octree.count
+}
+
+func (octree *Octree) Compress() *Voxels {
+	count := Vector3i{X: halfCount(octree.count.X), Y: halfCount(octree.count.Y), Z: halfCount(octree.count.Z)}
+
+	var newVoxels Voxels = buildOctree(count, octree.size*2, func(x, y, z int32) bool {
+		px, py, pz := x*2, y*2, z*2
+		return octree.Get(px, py, pz) ||
+			octree.Get(px+1, py, pz) ||
+			octree.Get(px, py+1, pz) ||
+			octree.Get(px+1, py+1, pz) ||
+			octree.Get(px, py, pz+1) ||
+			octree.Get(px+1, py, pz+1) ||
+			octree.Get(px, py+1, pz+1) ||
+			octree.Get(px+1, py+1, pz+1)
+	})
+
+	return &newVoxels
+}
+
+// EmptyBox returns the largest empty node containing mapPos
+func (octree *Octree) EmptyBox(mapPos Vector3i) (Vector3i, Vector3i, bool) {
+	node := octree.root
+	for level := octree.depth; level > 0; level-- {
+		c := octreeChild(level, mapPos.X, mapPos.Y, mapPos.Z)
+		if node.mask&(uint8(1)<<c) == 0 {
+			// mask off the low bits to find the corner of the empty child
+			childSize := int32(1) << (level - 1)
+			boxMin := Vector3i{X: mapPos.X &^ (childSize - 1), Y: mapPos.Y &^ (childSize - 1), Z: mapPos.Z &^ (childSize - 1)}
+			boxMax := Vector3i{X: boxMin.X + childSize, Y: boxMin.Y + childSize, Z: boxMin.Z + childSize}
+			return boxMin, boxMax, true
+		}
+		if level == 1 {
+			break
+		}
+		node = octree.nodes[node.children+uint32(c)]
+	}
+
+	return Vector3i{}, Vector3i{}, false
+}
+
+// NumBytes returns how much memory the nodes use
+func (octree *Octree) NumBytes() int {
+	return (len(octree.nodes) + 1) * int(unsafe.Sizeof(octreeNode{}))
+}
+
+// OctreeTracerImpl traces front to back through the octree. at each node it
+// only looks at the children that have something in them, in the order the
+// ray goes through them, so empty space is never visited at all and the
+// callback is only made for the voxel that is hit
+type OctreeTracerImpl struct {
+	Octree *Octree
+}
+
+// octreeRay is a ray in voxel space being traced through an octree
+type octreeRay struct {
+	octree   *Octree
+	params   TraceParams
+	pos, dir [3]float32
+	start    float32  // how far along the ray it enters the grid
+	face     Face     // the face it enters the grid through
+	startPos [3]int32 // the voxel it starts in, or enters the grid through
+	numSteps int32
+}
+
+// octreeVisit is a child the ray goes through and where it goes into it,
+// axis is -1 for the child it starts in
+type octreeVisit struct {
+	child  int32
+	corner Vector3i
+	enter  float32
+	axis   int
+}
+
+func (tracer *OctreeTracerImpl) Trace(params TraceParams) RaycastHit {
+	var result RaycastHit
+	octree := tracer.Octree
+
+	// convert rayPos to voxel space
+	rayPos := params.RayStart.DivScalar(octree.size)
+
+	// find where the ray enters the grid the same way Trace does so misses
+	// look the same
+	start, startPos, face, ok := clipRay(rayPos, params.RayDir, octree.count)
+	if !ok {
+		result.Status = RAYCAST_MISS
+		result.HitPos = params.RayStart
+		result.MapPos = rayPos.Floor().ToVector3i()
+		return result
+	}
+
+	ray := octreeRay{
+		octree:   octree,
+		params:   params,
+		pos:      [3]float32{rayPos.X, rayPos.Y, rayPos.Z},
+		dir:      [3]float32{params.RayDir.X, params.RayDir.Y, params.RayDir.Z},
+		start:    start,
+		face:     face,
+		startPos: [3]int32{startPos.X, startPos.Y, startPos.Z},
+	}
+
+	var dist float32
+	if octree.root.mask == 0 || !ray.visit(octree.root, octree.depth, Vector3i{}, &result, &dist) {
+		dist = ray.exit(&result)
+	}
+
+	result.NumSteps = ray.numSteps
+	result.Normal = result.Face.Normal()
+	result.T = dist * octree.size
+	result.HitPos = rayPos.Plus(params.RayDir.MulScalar(dist)).MulScalar(octree.size)
+
+	// snap to grid to prevent rounding errors
+	result.snap()
+
+	return result
+}
+
+// visit goes through the children of node, which covers 2^level voxels from
+// corner, nearest first. it returns true once the ray has hit something or
+// run out of steps
+func (ray *octreeRay) visit(node octreeNode, level int32, corner Vector3i, hit *RaycastHit, dist *float32) bool {
+	half := int32(1) << (level - 1)
+
+	// sort the children the ray goes through by where it goes into them
+	var visits [8]octreeVisit
+	n := 0
+	for c := int32(0); c < 8; c++ {
+		if node.mask&(uint8(1)<<c) == 0 {
+			continue
+		}
+
+		childCorner := Vector3i{X: corner.X + (c&1)*half, Y: corner.Y + (c>>2)*half, Z: corner.Z + ((c>>1)&1)*half}
+		enter, axis, _, _, ok := ray.box(childCorner, Vector3i{X: childCorner.X + half, Y: childCorner.Y + half, Z: childCorner.Z + half})
+		if !ok {
+			continue
+		}
+
+		// children the ray goes into at the same place are gone into in
+		// axis order, the same as Trace steps
+		i := n
+		for ; i > 0 && (visits[i-1].enter > enter || visits[i-1].enter == enter && visits[i-1].axis > axis); i-- {
+			visits[i] = visits[i-1]
+		}
+		visits[i] = octreeVisit{child: c, corner: childCorner, enter: enter, axis: axis}
+		n++
+	}
+
+	for _, v := range visits[:n] {
+		ray.numSteps++
+
+		// the child the ray starts in is where it came in through the
+		// grid's face, or started inside it
+		hit.MapPos, hit.Face, *dist = v.corner, ray.face, ray.start
+		if v.axis >= 0 {
+			hit.Face, *dist = stepFace(v.axis, ray.step(v.axis)), v.enter
+		}
+
+		// children of the lowest nodes are voxels
+		if level == 1 {
+			if ray.params.Callback != nil {
+				var voxels Voxels = ray.octree
+				ray.params.Callback(&voxels, v.corner)
+			}
+			hit.Status = RAYCAST_HIT
+			if hit.Face == FACE_NONE {
+				hit.Status = RAYCAST_STARTED_INSIDE
+			}
+			return true
+		}
+
+		if ray.params.MaxSteps > 0 && ray.numSteps >= ray.params.MaxSteps {
+			hit.Status = RAYCAST_MAX_STEPS
+			return true
+		}
+
+		if ray.visit(ray.octree.nodes[node.children+uint32(v.child)], level-1, v.corner, hit, dist) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// exit is where the ray leaves the grid when it doesn't hit anything, the
+// voxel just outside it and the face it goes into that voxel through
+func (ray *octreeRay) exit(hit *RaycastHit) float32 {
+	count := ray.octree.count
+	_, _, exit, axis, _ := ray.box(Vector3i{}, count)
+	hi := [3]int32{count.X, count.Y, count.Z}
+
+	mapPos := [3]int32{}
+	for i := range mapPos {
+		mapPos[i] = int32(math.Floor(float64(ray.pos[i] + ray.dir[i]*exit)))
+	}
+	if ray.dir[axis] > 0 {
+		mapPos[axis] = hi[axis]
+	} else {
+		mapPos[axis] = -1
+	}
+
+	hit.Status = RAYCAST_OUT_OF_BOUNDS
+	hit.MapPos = Vector3i{X: mapPos[0], Y: mapPos[1], Z: mapPos[2]}
+	hit.Face = stepFace(axis, ray.step(axis))
+	return exit
+}
+
+// box returns how far along the ray it goes into the box from boxMin
+// (inclusive) to boxMax (exclusive) and the axis it goes in through, -1 if it
+// starts in the box, then how far along it comes out and the axis it goes out
+// through. like Trace, which side of a voxel boundary the ray is on at the
+// start comes from the voxel it starts in rather than its position, and when
+// it crosses boundaries on two axes at the same place the lower axis is
+// crossed first, so a box it only touches is gone through whenever Trace
+// would step through it. false means the box isn't gone through
+func (ray *octreeRay) box(boxMin, boxMax Vector3i) (float32, int, float32, int, bool) {
+	lo, hi := [3]int32{boxMin.X, boxMin.Y, boxMin.Z}, [3]int32{boxMax.X, boxMax.Y, boxMax.Z}
+	enter, exit := float32(math.Inf(-1)), float32(math.Inf(1))
+	enterAxis, exitAxis := -1, len(lo)
+
+	for i := range ray.pos {
+		inside := ray.startPos[i] >= lo[i] && ray.startPos[i] < hi[i]
+		if ray.dir[i] == 0 {
+			if !inside {
+				return 0, 0, 0, 0, false
+			}
+			continue
+		}
+
+		near, far := lo[i], hi[i]
+		if ray.dir[i] < 0 {
+			near, far = hi[i], lo[i]
+		}
+
+		// boxes behind the start are never gone through
+		if (ray.dir[i] > 0 && ray.startPos[i] >= hi[i]) || (ray.dir[i] < 0 && ray.startPos[i] < lo[i]) {
+			return 0, 0, 0, 0, false
+		}
+
+		if t := (float32(far) - ray.pos[i]) / ray.dir[i]; t < exit {
+			exit, exitAxis = t, i
+		}
+		if inside {
+			continue
+		}
+		if t := (float32(near) - ray.pos[i]) / ray.dir[i]; t >= enter {
+			enter, enterAxis = t, i
+		}
+	}
+
+	ok := enter < exit || (enter == exit && enterAxis < exitAxis)
+	return enter, enterAxis, exit, exitAxis, ok
+}
+
+func (ray *octreeRay) step(axis int) int32 {
+	if ray.dir[axis] > 0 {
+		return 1
+	}
+	return -1
+}
@@ -0,0 +1,210 @@
+package voxel
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestOctreeGetSet(t *testing.T) {
+	octree := NewOctree(NewTestVoxels(20, 10, 5, 1))
+
+	octree.Set(1, 2, 3, true)
+	octree.Set(19, 9, 4, true)
+
+	if !octree.Get(1, 2, 3) || !octree.Get(19, 9, 4) {
+		t.Fatalf("Voxels not set\n")
+	}
+
+	if octree.Get(3, 2, 1) || octree.Get(20, 9, 4) {
+		t.Fatalf("Unexpected voxel\n")
+	}
+
+	octree.Set(1, 2, 3, false)
+	if octree.Get(1, 2, 3) {
+		t.Fatalf("Voxel not cleared\n")
+	}
+
+	// clearing the last voxel empties the whole branch
+	octree.Set(19, 9, 4, false)
+	if octree.root.mask != 0 {
+		t.Fatalf("Branch not cleared: %d\n", octree.root.mask)
+	}
+}
+
+func TestOctreeReuse(t *testing.T) {
+	octree := NewOctree(NewTestVoxels(64, 64, 64, 1))
+	r := rand.New(rand.NewSource(1))
+
+	// setting and clearing the same voxels over and over shouldn't keep
+	// adding nodes
+	numNodes := 0
+	for i := 0; i < 100; i++ {
+		x, y, z := r.Int31n(64), r.Int31n(64), r.Int31n(64)
+		octree.Set(x, y, z, true)
+		octree.Set(63-x, y, 63-z, true)
+		if i == 0 {
+			numNodes = len(octree.nodes)
+		}
+		if len(octree.nodes) > numNodes {
+			t.Fatalf("Nodes not reused: %d, expected %d\n", len(octree.nodes), numNodes)
+		}
+		if !octree.Get(x, y, z) || !octree.Get(63-x, y, 63-z) {
+			t.Fatalf("Voxels not set\n")
+		}
+
+		octree.Set(x, y, z, false)
+		octree.Set(63-x, y, 63-z, false)
+		if octree.root.mask != 0 {
+			t.Fatalf("Branch not cleared: %d\n", octree.root.mask)
+		}
+	}
+}
+
+func TestOctreeFromGrid(t *testing.T) {
+	grid := NewVoxelGrid(32, 16, 32, 1)
+	grid.SetVoxel(0, 0, 0, true)
+	grid.SetVoxel(31, 15, 31, true)
+	grid.SetVoxel(7, 8, 9, true)
+
+	octree := NewOctreeFromGrid(grid)
+
+	for y := int32(0); y < 16; y++ {
+		for z := int32(0); z < 32; z++ {
+			for x := int32(0); x < 32; x++ {
+				if octree.Get(x, y, z) != grid.GetVoxel(x, y, z) {
+					t.Fatalf("Mismatch: %d %d %d\n", x, y, z)
+				}
+			}
+		}
+	}
+
+	// only the nodes on the way to the 3 voxels are stored
+	if len(octree.nodes) > 3*8*4 {
+		t.Fatalf("Octree not sparse: %d\n", len(octree.nodes))
+	}
+}
+
+func TestOctreeTrace(t *testing.T) {
+	var dense Voxels = NewTestVoxels(64, 64, 64, 1)
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 128; i++ {
+		dense.Set(r.Int31n(64), r.Int31n(64), r.Int31n(64), true)
+	}
+
+	tracer := OctreeTracerImpl{Octree: NewOctree(dense)}
+
+	// the octree goes down through every level to get to a voxel so it can
+	// take more steps than Trace for a voxel right in front of the ray, but
+	// far fewer overall
+	numSteps, expectedSteps := int32(0), int32(0)
+
+	for i := 0; i < 4000; i++ {
+		// half the rays start outside the grid
+		rs := Vector3f{X: r.Float32() * 64, Y: r.Float32() * 64, Z: r.Float32() * 64}
+		if i%2 == 1 {
+			rs = Vector3f{X: r.Float32()*128 - 32, Y: r.Float32()*128 - 32, Z: r.Float32()*128 - 32}
+		}
+
+		// a quarter start on a voxel boundary, where it matters which voxel
+		// they start in, either on a corner or on one face. some of those
+		// are on the edge of the grid
+		switch i % 8 {
+		case 0, 1:
+			rs = rs.Floor()
+		case 2:
+			rs.Y = float32(r.Int31n(65))
+		case 3:
+			rs.X = float32(r.Int31n(2) * 64)
+		}
+		rd := Vector3f{X: r.Float32() - 0.5, Y: r.Float32() - 0.5, Z: r.Float32() - 0.5}.Normalize()
+
+		params := TraceParams{RayStart: rs, RayDir: rd}
+		expected := Trace(&dense, params)
+		result := tracer.Trace(params)
+
+		if expected.Status != result.Status {
+			t.Fatalf("Mismatch: %+v %+v\n", expected, result)
+		}
+
+		numSteps += result.NumSteps
+		expectedSteps += expected.NumSteps
+
+		if !expected.Hit() {
+			continue
+		}
+
+		if !expected.MapPos.Equals(result.MapPos) || expected.Face != result.Face {
+			t.Fatalf("Incorrect mapPos or side: %+v %+v\n", expected, result)
+		}
+
+		if Distance(expected.HitPos, result.HitPos) > 0.001 || math.Abs(float64(expected.T-result.T)) > 0.001 {
+			t.Fatalf("Incorrect hitPos: %+v %+v\n", expected, result)
+		}
+	}
+
+	if numSteps*4 > expectedSteps {
+		t.Fatalf("Suspicious numSteps: %d, Trace took %d\n", numSteps, expectedSteps)
+	}
+}
+
+const benchWidth, benchHeight = 256, 128
+
+func benchHeightfield(set func(x, y, z int32)) {
+	for z := int32(0); z < benchWidth; z++ {
+		for x := int32(0); x < benchWidth; x++ {
+			h := (math.Sin(float64(x)/17)*math.Cos(float64(z)/23) + 1) / 2 * benchHeight / 2
+			for y := int32(0); y <= int32(h); y++ {
+				set(x, y, z)
+			}
+		}
+	}
+}
+
+func benchRays(n int) []TraceParams {
+	r := rand.New(rand.NewSource(1))
+	rays := make([]TraceParams, n)
+	for i := range rays {
+		rays[i].RayStart = Vector3f{X: r.Float32() * benchWidth, Y: benchHeight - 1, Z: r.Float32() * benchWidth}
+		rays[i].RayDir = Vector3f{X: r.Float32() - 0.5, Y: -r.Float32(), Z: r.Float32() - 0.5}.Normalize()
+	}
+	return rays
+}
+
+func BenchmarkMipChainRaycast(b *testing.B) {
+	grid := NewVoxelGrid(benchWidth, benchHeight, benchWidth, 1)
+	benchHeightfield(func(x, y, z int32) { grid.SetVoxel(x, y, z, true) })
+
+	numBytes := grid.voxels.len()
+	for grid.NumVoxelsY > 2 {
+		grid = grid.Compress()
+		numBytes += grid.voxels.len()
+	}
+
+	rays := benchRays(1024)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		ray := rays[i%len(rays)]
+		grid.RaycastRecursive(ray.RayStart, ray.RayDir)
+	}
+
+	b.ReportMetric(float64(numBytes), "bytes")
+}
+
+func BenchmarkOctreeTrace(b *testing.B) {
+	grid := NewVoxelGrid(benchWidth, benchHeight, benchWidth, 1)
+	benchHeightfield(func(x, y, z int32) { grid.SetVoxel(x, y, z, true) })
+
+	tracer := OctreeTracerImpl{Octree: NewOctreeFromGrid(grid)}
+
+	rays := benchRays(1024)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		tracer.Trace(rays[i%len(rays)])
+	}
+
+	b.ReportMetric(float64(tracer.Octree.NumBytes()), "bytes")
+}
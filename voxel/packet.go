@@ -0,0 +1,634 @@
+package voxel
+
+import (
+	"math"
+	"slices"
+)
+
+// PACKET_SIZE is the width and height in pixels of the block of rays traced
+// together by RaycastPacket
+const PACKET_SIZE = 8
+const PACKET_RAYS = PACKET_SIZE * PACKET_SIZE
+
+// rays are taken to be up to PACKET_MARGIN voxels either side of where they
+// should be when working out which voxels a packet goes through, to allow
+// for rounding in the DDA
+const PACKET_MARGIN = 1.0 / 64
+
+// RayPacket is a block of primary rays from the camera. rays next to each
+// other on screen go through mostly the same voxels, so tracing them together
+// walks each level of the mip chain once for the whole block instead of once
+// per pixel. everything is kept as an array per component, ray i being pixel
+// X + i%Width, Y + i/Width
+type RayPacket struct {
+	X, Y          int32
+	Width, Height int32
+	Origin        Vector3f
+
+	DirX, DirY, DirZ [PACKET_RAYS]float32
+
+	// filled in by RaycastPacket. NumSteps in each hit only counts the voxels
+	// that ray looked at on its own, the packet's NumSteps is every voxel
+	// looked at for the whole packet
+	Hits     [PACKET_RAYS]RaycastHit
+	NumSteps int32
+
+	// where each ray has got to on its way down the mip chain
+	posX, posY, posZ [PACKET_RAYS]float32
+	t                [PACKET_RAYS]float32
+	numSteps         [PACKET_RAYS]int32
+	active           [PACKET_RAYS]uint8
+
+	// each ray's DDA through the level being traced, whether it is still
+	// being walked with the rest of the packet and the voxels it has looked
+	// at on its own
+	rays    [PACKET_RAYS]ddaRay
+	walking [PACKET_RAYS]bool
+	steps   [PACKET_RAYS]int32
+}
+
+// Packet sets up the rays for the block of pixels with its top left at x, y.
+// the block is cut short at maxX, maxY so it can stay inside part of the
+// screen, pass Resolution to only stop at the edges
+func (c *Camera) Packet(plane *CameraPlane, x, y, maxX, maxY int32, packet *RayPacket) {
+	packet.X, packet.Y = x, y
+	packet.Width = min(PACKET_SIZE, maxX-x)
+	packet.Height = min(PACKET_SIZE, maxY-y)
+	packet.Origin = c.Body.Position
+
+	for py := int32(0); py < packet.Height; py++ {
+		for px := int32(0); px < packet.Width; px++ {
+			i := px + py*packet.Width
+			_, rayDir := c.RayDir(plane, x+px, y+py)
+			packet.DirX[i], packet.DirY[i], packet.DirZ[i] = rayDir.X, rayDir.Y, rayDir.Z
+		}
+	}
+}
+
+// Len is how many rays are in the packet
+func (packet *RayPacket) Len() int {
+	return int(packet.Width * packet.Height)
+}
+
+// Dir returns the direction of ray i
+func (packet *RayPacket) Dir(i int) Vector3f {
+	return Vector3f{X: packet.DirX[i], Y: packet.DirY[i], Z: packet.DirZ[i]}
+}
+
+// RaycastPacket traces every ray in the packet, giving the same hits as
+// calling RaycastRecursive on each. the whole packet goes through the mip
+// chain a level at a time, rays that miss drop out and the rest carry on
+// together into the next level.
+//
+// at each level the packet is walked a slice of voxels at a time along the
+// axis the rays are mostly heading in. the voxels any ray could go through in
+// a slice are looked at once for the whole packet, if they are all empty the
+// rays skip the slice without stepping. otherwise each ray steps through the
+// slice using what was looked up, and the ones that don't hit anything carry
+// on together. the packet is split in half whenever its rays are too spread
+// out to share much
+func (grid *VoxelGrid) RaycastPacket(packet *RayPacket) {
+	n := packet.Len()
+	packet.NumSteps = 0
+
+	// every ray starts at the origin
+	for i := 0; i < n; i++ {
+		packet.posX[i], packet.posY[i], packet.posZ[i] = packet.Origin.X, packet.Origin.Y, packet.Origin.Z
+		packet.t[i] = 0
+		packet.numSteps[i] = 0
+		packet.active[i] = uint8(i)
+	}
+
+	// the parts of the DDA that only depend on direction are the same at
+	// every level
+	var deltaDist [PACKET_RAYS]Vector3f
+	var step [PACKET_RAYS]Vector3i
+	for i := 0; i < n; i++ {
+		rayDir := packet.Dir(i)
+		deltaDist[i] = rayDir.Inverse().Abs()
+		step[i] = rayDir.Sign().ToVector3i()
+	}
+
+	active := packet.active[:n]
+	for level := grid.level(); len(active) > 0; level-- {
+		for _, i := range active {
+			rayPos := Vector3f{X: packet.posX[i], Y: packet.posY[i], Z: packet.posZ[i]}
+			rayDir := packet.Dir(int(i))
+			packet.steps[i] = 0
+
+			// back up at full res like RaycastRecursive does
+			if grid.Parent == nil {
+				rayPos = rayPos.Sub(rayDir)
+				packet.t[i]--
+			}
+
+			packet.walking[i] = packet.rays[i].start(grid, rayPos.DivScalar(grid.VoxelSize), rayDir, deltaDist[i], step[i])
+			if !packet.walking[i] {
+				packet.Hits[i] = RaycastHit{Status: RAYCAST_MISS, HitPos: rayPos, MapPos: rayPos.DivScalar(grid.VoxelSize).Floor().ToVector3i(), Level: level}
+				packet.finishHit(int(i))
+				continue
+			}
+
+			// seeking needs the ray to step along every axis, anything
+			// heading straight down one is traced on its own
+			if rayDir.X == 0 || rayDir.Y == 0 || rayDir.Z == 0 {
+				grid.finishRay(packet, int(i), -1, 0, level)
+			}
+		}
+
+		grid.walkPacket(packet, 0, 0, packet.Width, packet.Height, nil, -1, 0, level)
+
+		// anything that hit carries on at a higher res
+		next := active[:0]
+		for _, i := range active {
+			hit := packet.Hits[i]
+			if hit.Hit() && grid.Parent != nil {
+				packet.posX[i], packet.posY[i], packet.posZ[i] = hit.HitPos.X, hit.HitPos.Y, hit.HitPos.Z
+				packet.t[i] = hit.T
+				packet.numSteps[i] = hit.NumSteps
+				next = append(next, i)
+			}
+		}
+
+		active = next
+		grid = grid.Parent
+	}
+}
+
+// packetSlice is the box of voxels the rays of a packet could go through in
+// one slice of the grid, and which of them are set
+type packetSlice struct {
+	axis   int
+	s      int32
+	other  [2]int
+	lo, hi [2]int32
+	set    uint64
+}
+
+// area is how many voxels are in the box
+func (slice *packetSlice) area() int32 {
+	return (slice.hi[0] - slice.lo[0] + 1) * (slice.hi[1] - slice.lo[1] + 1)
+}
+
+// bit is where the voxel at mapPos is in set, or -1 if it isn't in the box
+func (slice *packetSlice) bit(mapPos [3]int32) int32 {
+	u, v := mapPos[slice.other[0]], mapPos[slice.other[1]]
+	if mapPos[slice.axis] != slice.s || u < slice.lo[0] || u > slice.hi[0] || v < slice.lo[1] || v > slice.hi[1] {
+		return -1
+	}
+	return (u-slice.lo[0])*(slice.hi[1]-slice.lo[1]+1) + v - slice.lo[1]
+}
+
+// lookup fills in which voxels in the box are set
+func (slice *packetSlice) lookup(grid *VoxelGrid) {
+	var mapPos [3]int32
+	mapPos[slice.axis] = slice.s
+	slice.set = 0
+	for u := slice.lo[0]; u <= slice.hi[0]; u++ {
+		for v := slice.lo[1]; v <= slice.hi[1]; v++ {
+			mapPos[slice.other[0]], mapPos[slice.other[1]] = u, v
+			if grid.GetVoxel(mapPos[0], mapPos[1], mapPos[2]) {
+				slice.set |= 1 << slice.bit(mapPos)
+			}
+		}
+	}
+}
+
+// walkPacket walks the rays in the block of the packet from x0, y0 to x1, y1
+// through the grid a slice at a time along axis, starting at slice s. the
+// rays are taken from the walk that was split to make the block. with an
+// axis of -1 one is picked and the walk starts from the nearest ray
+func (grid *VoxelGrid) walkPacket(packet *RayPacket, x0, y0, x1, y1 int32, split []walkRay, axis int, s int32, level int32) {
+	var walk [PACKET_RAYS]walkRay
+	numRays := 0
+
+	picked := axis < 0
+	if picked {
+		for y := y0; y < y1; y++ {
+			for x := x0; x < x1; x++ {
+				if i := x + y*packet.Width; packet.walking[i] {
+					walk[numRays].i = uint8(i)
+					numRays++
+				}
+			}
+		}
+	} else {
+		for _, ray := range split {
+			x, y := int32(ray.i)%packet.Width, int32(ray.i)/packet.Width
+			if packet.walking[ray.i] && x >= x0 && x < x1 && y >= y0 && y < y1 {
+				walk[numRays] = ray
+				numRays++
+			}
+		}
+	}
+	if numRays == 0 {
+		return
+	}
+
+	// a ray on its own is quicker to step
+	if numRays == 1 {
+		grid.finishRay(packet, int(walk[0].i), axis, s, level)
+		return
+	}
+
+	count := [3]int32{grid.NumVoxelsX, grid.NumVoxelsY, grid.NumVoxelsZ}
+	sorted := walk[:numRays]
+
+	if picked {
+		// walk along the axis the first ray is mostly heading in, every
+		// ray has to be heading the same way along it
+		first := &packet.rays[sorted[0].i]
+		dir := first.rayDir.Abs()
+		axis = 2
+		if dir.X >= dir.Y && dir.X >= dir.Z {
+			axis = 0
+		} else if dir.Y >= dir.Z {
+			axis = 1
+		}
+
+		for _, ray := range sorted {
+			if packet.rays[ray.i].step[axis] != first.step[axis] {
+				grid.splitPacket(packet, x0, y0, x1, y1, nil, -1, 0, level)
+				return
+			}
+		}
+
+		// rays only need looking at from the slice they start in, so they
+		// are added to the walk in the order they start. the slice and the
+		// ray are sorted together as one number
+		var keys [PACKET_RAYS]int64
+		for j, ray := range sorted {
+			keys[j] = int64(packet.rays[ray.i].startPos[axis]*first.step[axis])<<8 | int64(ray.i)
+		}
+		slices.Sort(keys[:numRays])
+
+		other := [2]int{(axis + 1) % 3, (axis + 2) % 3}
+		for j, key := range keys[:numRays] {
+			i := uint8(key & 0xff)
+			dir := [3]float32{packet.DirX[i], packet.DirY[i], packet.DirZ[i]}
+			sorted[j] = walkRay{i: i, start: int32(key >> 8), slope: [2]float32{dir[other[0]] / dir[axis], dir[other[1]] / dir[axis]}}
+		}
+	}
+
+	step := packet.rays[sorted[0].i].step[axis]
+	slice := packetSlice{axis: axis, other: [2]int{(axis + 1) % 3, (axis + 2) % 3}}
+	if picked || sorted[0].start > s*step {
+		s = sorted[0].start * step
+	}
+
+	// every ray goes through the origin, so how far the rays in a slice are
+	// from it on the other axes is between the smallest and biggest slope
+	// times how far the slice is from it
+	origin := packet.Origin.DivScalar(grid.VoxelSize)
+	o := [3]float32{origin.X, origin.Y, origin.Z}
+	var slopes slopeBounds
+	numStarted := 0
+
+	for ; s >= 0 && s < count[axis]; s += step {
+		if numStarted == 0 {
+			slopes.reset()
+		}
+		for ; numStarted < len(sorted) && sorted[numStarted].start <= s*step; numStarted++ {
+			slopes.add(sorted[numStarted].slope)
+		}
+		if numStarted == 0 {
+			continue
+		}
+
+		// the voxels in the slice the rays could be in
+		slice.s = s
+		d0, d1 := float32(s)-o[axis], float32(s+1)-o[axis]
+		gone, empty := false, false
+		for j, a := range slice.other {
+			l := o[a] + min(slopes.min[j]*d0, slopes.min[j]*d1, slopes.max[j]*d0, slopes.max[j]*d1) - PACKET_MARGIN
+			h := o[a] + max(slopes.min[j]*d0, slopes.min[j]*d1, slopes.max[j]*d0, slopes.max[j]*d1) + PACKET_MARGIN
+			slice.lo[j] = max(0, int32(math.Floor(float64(l))))
+			slice.hi[j] = min(count[a]-1, int32(math.Floor(float64(h))))
+			empty = empty || slice.lo[j] > slice.hi[j]
+
+			// past the side of the grid with the rays all heading further
+			// away from it
+			if h < 0 && slopes.max[j]*float32(step) <= 0 || l >= float32(count[a]) && slopes.min[j]*float32(step) >= 0 {
+				gone = true
+			}
+		}
+		if gone && numStarted == len(sorted) {
+			break
+		}
+		if empty {
+			continue
+		}
+
+		// too spread out to share, the halves will be closer together
+		if slice.area() > min(PACKET_RAYS, 4*int32(numStarted)) {
+			grid.splitPacket(packet, x0, y0, x1, y1, sorted, axis, s, level)
+			return
+		}
+
+		slice.lookup(grid)
+		packet.NumSteps += slice.area()
+		if slice.set == 0 {
+			continue
+		}
+
+		// step each ray through the slice, the ones that stop in it leave
+		// the walk and what's left may be closer together
+		numLeft, started := 0, numStarted
+		slopes.reset()
+		for j, ray := range sorted {
+			if j >= started {
+				sorted[numLeft] = ray
+				numLeft++
+			} else if grid.stepSlice(packet, int(ray.i), &slice, level) {
+				sorted[numLeft] = ray
+				numLeft++
+				slopes.add(ray.slope)
+			} else {
+				numStarted--
+			}
+		}
+		sorted = sorted[:numLeft]
+		if len(sorted) == 0 {
+			return
+		}
+	}
+
+	// the rays have all left the grid
+	for _, ray := range sorted {
+		grid.finishRay(packet, int(ray.i), axis, s, level)
+	}
+}
+
+// walkRay is a ray in a walk, the slice it starts in along the walk and its
+// slope on the other axes
+type walkRay struct {
+	i     uint8
+	start int32
+	slope [2]float32
+}
+
+// slopeBounds are the smallest and biggest slopes of the rays in a walk
+type slopeBounds struct {
+	min, max [2]float32
+}
+
+func (slopes *slopeBounds) reset() {
+	slopes.min = [2]float32{float32(math.Inf(1)), float32(math.Inf(1))}
+	slopes.max = [2]float32{float32(math.Inf(-1)), float32(math.Inf(-1))}
+}
+
+func (slopes *slopeBounds) add(slope [2]float32) {
+	for j := range slope {
+		if slope[j] < slopes.min[j] {
+			slopes.min[j] = slope[j]
+		}
+		if slope[j] > slopes.max[j] {
+			slopes.max[j] = slope[j]
+		}
+	}
+}
+
+// splitPacket walks each half of the block from slice s
+func (grid *VoxelGrid) splitPacket(packet *RayPacket, x0, y0, x1, y1 int32, split []walkRay, axis int, s int32, level int32) {
+	if x1-x0 >= y1-y0 {
+		xm := (x0 + x1) / 2
+		grid.walkPacket(packet, x0, y0, xm, y1, split, axis, s, level)
+		grid.walkPacket(packet, xm, y0, x1, y1, split, axis, s, level)
+	} else {
+		ym := (y0 + y1) / 2
+		grid.walkPacket(packet, x0, y0, x1, ym, split, axis, s, level)
+		grid.walkPacket(packet, x0, ym, x1, y1, split, axis, s, level)
+	}
+}
+
+// seekSlice moves ray i to where it enters slice s along axis, if it hasn't
+// got that far already
+func (grid *VoxelGrid) seekSlice(packet *RayPacket, i int, axis int, s int32) {
+	ray := &packet.rays[i]
+	if (s-ray.mapPos[axis])*ray.step[axis] > 0 {
+		ray.seek(axis, (s-ray.startPos[axis])*ray.step[axis])
+		ray.leaveGrid([3]int32{grid.NumVoxelsX, grid.NumVoxelsY, grid.NumVoxelsZ})
+	}
+}
+
+// stepSlice steps ray i through the slice using the voxels that were looked
+// up for it, it returns true if the ray carries on into the next slice
+func (grid *VoxelGrid) stepSlice(packet *RayPacket, i int, slice *packetSlice, level int32) bool {
+	ray := &packet.rays[i]
+	grid.seekSlice(packet, i, slice.axis, slice.s)
+
+	status, numSteps := grid.march(ray, slice)
+	packet.steps[i] += numSteps
+	packet.NumSteps += numSteps
+	if status == RAYCAST_MISS {
+		return true
+	}
+
+	packet.walking[i] = false
+	ray.setHit(&packet.Hits[i], grid, status, level, packet.steps[i])
+	packet.finishHit(i)
+	return false
+}
+
+// finishRay traces ray i through the rest of the level on its own, starting
+// from where it enters slice s along axis. it starts from where it is if it
+// doesn't reach the slice or the axis is -1
+func (grid *VoxelGrid) finishRay(packet *RayPacket, i int, axis int, s int32, level int32) {
+	ray := &packet.rays[i]
+	packet.walking[i] = false
+
+	if axis >= 0 {
+		grid.seekSlice(packet, i, axis, s)
+	}
+
+	status, numSteps := grid.march(ray, nil)
+	packet.steps[i] += numSteps
+	packet.NumSteps += numSteps
+	ray.setHit(&packet.Hits[i], grid, status, level, packet.steps[i])
+	packet.finishHit(i)
+}
+
+// finishHit adds on how far ray i came and how many steps it took at lower res
+func (packet *RayPacket) finishHit(i int) {
+	packet.Hits[i].T += packet.t[i]
+	packet.Hits[i].NumSteps += packet.numSteps[i]
+}
+
+// ddaRay is a ray being stepped through a level of the grid on its way
+// through a packet, each axis is kept in an array so they can be picked by
+// number. it steps the same as raycast does, so where it will be after any
+// number of steps can be found without taking them
+type ddaRay struct {
+	rayPos    Vector3f // in voxels
+	rayDir    Vector3f
+	deltaDist [3]float32
+	step      [3]int32
+
+	// the voxel the ray entered the grid at and the distance to the first
+	// side on each axis from there
+	startPos  [3]int32
+	firstSide [3]float32
+
+	numSides [3]int32
+	sideDist [3]float32
+	mapPos   [3]int32
+	face     Face
+	dist     float32
+}
+
+// start clips the ray to the grid and puts it in the voxel it enters at,
+// it returns false if the ray misses the grid. rayPos is in voxels
+func (ray *ddaRay) start(grid *VoxelGrid, rayPos Vector3f, rayDir Vector3f, deltaDist Vector3f, step Vector3i) bool {
+	dist, mapPos, face, ok := clipRay(rayPos, rayDir, grid.Count())
+	if !ok {
+		return false
+	}
+
+	// length of ray from current position to next x or y-side
+	sideDist := calcSideDist(rayPos, rayDir, deltaDist, mapPos)
+
+	ray.rayPos, ray.rayDir = rayPos, rayDir
+	ray.deltaDist = [3]float32{deltaDist.X, deltaDist.Y, deltaDist.Z}
+	ray.step = [3]int32{step.X, step.Y, step.Z}
+	ray.startPos = [3]int32{mapPos.X, mapPos.Y, mapPos.Z}
+	ray.firstSide = [3]float32{sideDist.X, sideDist.Y, sideDist.Z}
+	ray.numSides = [3]int32{}
+	ray.sideDist = ray.firstSide
+	ray.mapPos = ray.startPos
+	ray.face = face
+	ray.dist = dist
+
+	return true
+}
+
+// march steps the ray from where it is until it hits something or leaves the
+// grid, returning why it stopped and how many voxels it looked at. given a
+// slice it uses the voxels looked up for it and stops with RAYCAST_MISS when
+// it steps into the next slice. it steps copies of the ray's state and
+// stores them when it stops
+func (grid *VoxelGrid) march(ray *ddaRay, slice *packetSlice) (RaycastResult, int32) {
+	mapPos, sideDist, numSides := ray.mapPos, ray.sideDist, ray.numSides
+	face, dist := ray.face, ray.dist
+	result := RAYCAST_MISS
+	numSteps := int32(0)
+
+	for {
+		b := int32(-1)
+		if slice != nil {
+			b = slice.bit(mapPos)
+		}
+		if b >= 0 {
+			if slice.set&(1<<b) != 0 {
+				result = RAYCAST_HIT
+			}
+		} else {
+			// rounding can take the ray outside the slice's box
+			result = grid.checkHit(Vector3i{X: mapPos[0], Y: mapPos[1], Z: mapPos[2]}, ray.rayDir)
+			numSteps++
+		}
+		if result != RAYCAST_MISS {
+			break
+		}
+
+		// jump to the next map square, ties go to the lowest axis
+		axis := 2
+		if sideDist[0] <= sideDist[1] && sideDist[0] <= sideDist[2] {
+			axis = 0
+		} else if sideDist[1] <= sideDist[2] {
+			axis = 1
+		}
+		dist = sideDist[axis]
+		numSides[axis]++
+		sideDist[axis] = sideDistAt(ray.firstSide[axis], ray.deltaDist[axis], numSides[axis])
+		mapPos[axis] += ray.step[axis]
+		face = stepFace(axis, ray.step[axis])
+
+		if slice != nil && axis == slice.axis {
+			break
+		}
+	}
+
+	ray.mapPos, ray.sideDist, ray.numSides = mapPos, sideDist, numSides
+	ray.face, ray.dist = face, dist
+
+	if result == RAYCAST_HIT && face == FACE_NONE {
+		result = RAYCAST_STARTED_INSIDE
+	}
+	return result, numSteps
+}
+
+// setHit fills in hit with where the ray stopped in grid
+func (ray *ddaRay) setHit(hit *RaycastHit, grid *VoxelGrid, status RaycastResult, level int32, numSteps int32) {
+	hit.Status = status
+	hit.Face, hit.Normal = ray.face, ray.face.Normal()
+	hit.T = ray.dist * grid.VoxelSize
+	hit.HitPos = ray.rayPos.Plus(ray.rayDir.MulScalar(ray.dist)).MulScalar(grid.VoxelSize)
+	hit.MapPos = Vector3i{X: ray.mapPos[0], Y: ray.mapPos[1], Z: ray.mapPos[2]}
+	hit.Level = level
+	hit.NumSteps = numSteps
+}
+
+// seek puts the ray where it would be straight after its nth step along
+// axis, as if it had stepped there itself. n is at least 1
+func (ray *ddaRay) seek(axis int, n int32) {
+	dist := sideDistAt(ray.firstSide[axis], ray.deltaDist[axis], n-1)
+	for a := 0; a < 3; a++ {
+		if a != axis {
+			ray.numSides[a] = ray.sidesBefore(a, dist, axis)
+		}
+	}
+	ray.numSides[axis] = n
+
+	for a := 0; a < 3; a++ {
+		ray.mapPos[a] = ray.startPos[a] + ray.numSides[a]*ray.step[a]
+		ray.sideDist[a] = sideDistAt(ray.firstSide[a], ray.deltaDist[a], ray.numSides[a])
+	}
+	ray.dist = dist
+	ray.face = stepFace(axis, ray.step[axis])
+}
+
+// sidesBefore is how many steps the ray takes along axis a before it steps
+// along other at dist. ties go to the lowest axis as they do in march
+func (ray *ddaRay) sidesBefore(a int, dist float32, other int) int32 {
+	before := func(n int32) bool {
+		d := sideDistAt(ray.firstSide[a], ray.deltaDist[a], n)
+		return d < dist || d == dist && a < other
+	}
+
+	// a guess that can only be out by rounding
+	n := int32(max(0, (dist-ray.firstSide[a])/ray.deltaDist[a]))
+	for n > 0 && !before(n-1) {
+		n--
+	}
+	for before(n) {
+		n++
+	}
+	return n
+}
+
+// leaveGrid moves a ray that was seeked out of the grid back to the step it
+// first left on, which is where march would have stopped
+func (ray *ddaRay) leaveGrid(count [3]int32) {
+	axis, n := -1, int32(0)
+	var dist float32
+
+	for a := 0; a < 3; a++ {
+		if ray.mapPos[a] >= 0 && ray.mapPos[a] < count[a] {
+			continue
+		}
+
+		// the step along a that took it from inside to out
+		na := count[a] - ray.startPos[a]
+		if ray.step[a] < 0 {
+			na = ray.startPos[a] + 1
+		}
+		d := sideDistAt(ray.firstSide[a], ray.deltaDist[a], na-1)
+		if axis < 0 || d < dist || d == dist && a < axis {
+			axis, n, dist = a, na, d
+		}
+	}
+
+	if axis >= 0 {
+		ray.seek(axis, n)
+	}
+}
@@ -0,0 +1,111 @@
+package voxel
+
+import (
+	"fmt"
+	"testing"
+)
+
+// packetScene is the bench heightfield with every level of the mip chain and
+// a camera looking across it
+func packetScene(resX, resY int32) (*VoxelGrid, Camera) {
+	grid := NewVoxelGrid(benchWidth, benchHeight, benchWidth, 1)
+	benchHeightfield(func(x, y, z int32) { grid.SetVoxel(x, y, z, true) })
+	for grid.NumVoxelsY > 2 {
+		grid = grid.Compress()
+	}
+
+	camera := NewCamera(float32(resX), float32(resY), 0.66)
+	camera.Body.Position = Vector3f{X: 8, Y: benchHeight * 0.6, Z: 8}
+	camera.Body.Rotate(0.7, -0.6)
+	return grid, camera
+}
+
+func TestRaycastPacket(t *testing.T) {
+	// not a multiple of PACKET_SIZE so the packets at the edges are cut short
+	grid, camera := packetScene(100, 60)
+
+	// looking straight along z the middle rays don't go along x or y at all
+	straight := NewCamera(100, 60, 0.66)
+	straight.Body.Position = camera.Body.Position
+	straight.Body.Rotate(0, 0)
+
+	for _, camera := range []Camera{camera, straight} {
+		plane := camera.Plane()
+
+		var packet RayPacket
+		hits, numSteps, packetSteps := 0, 0, 0
+		for y := int32(0); y < camera.Resolution.Y; y += PACKET_SIZE {
+			for x := int32(0); x < camera.Resolution.X; x += PACKET_SIZE {
+				camera.Packet(&plane, x, y, camera.Resolution.X, camera.Resolution.Y, &packet)
+				grid.RaycastPacket(&packet)
+				packetSteps += int(packet.NumSteps)
+
+				for i := 0; i < packet.Len(); i++ {
+					px, py := x+int32(i)%packet.Width, y+int32(i)/packet.Width
+					_, rayDir := camera.RayDir(&plane, px, py)
+					expected := grid.RaycastRecursive(camera.Body.Position, rayDir)
+					numSteps += int(expected.NumSteps)
+
+					// steps are shared between the rays in a packet
+					hit := packet.Hits[i]
+					hit.NumSteps = expected.NumSteps
+					if hit != expected {
+						t.Fatalf("Incorrect hit for %d, %d: %+v, expected %+v\n", px, py, packet.Hits[i], expected)
+					}
+					if expected.Hit() {
+						hits++
+					}
+				}
+			}
+		}
+
+		// make sure the camera is actually looking at something
+		if hits < 1000 || hits == 6000 {
+			t.Fatalf("Suspicious number of hits: %d\n", hits)
+		}
+
+		if packetSteps >= numSteps {
+			t.Fatalf("Incorrect number of steps: %d, expected fewer than %d\n", packetSteps, numSteps)
+		}
+	}
+}
+
+func BenchmarkPrimaryRays(b *testing.B) {
+	for _, res := range []Vector2i{{X: 320, Y: 180}, {X: 1600, Y: 900}} {
+		grid, camera := packetScene(res.X, res.Y)
+		numRays := float64(res.X * res.Y)
+
+		// how the scenes used to do it, a plane and a recursive raycast per pixel
+		b.Run(fmt.Sprintf("pixel/%dx%d", res.X, res.Y), func(b *testing.B) {
+			numSteps := 0
+			for i := 0; i < b.N; i++ {
+				for y := int32(0); y < res.Y; y++ {
+					for x := int32(0); x < res.X; x++ {
+						plane := camera.Plane()
+						_, rayDir := camera.RayDir(&plane, x, y)
+						numSteps += int(grid.RaycastRecursive(camera.Body.Position, rayDir).NumSteps)
+					}
+				}
+			}
+			b.ReportMetric(float64(numSteps)/float64(b.N)/numRays, "steps/ray")
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N)/numRays, "ns/ray")
+		})
+
+		b.Run(fmt.Sprintf("packet/%dx%d", res.X, res.Y), func(b *testing.B) {
+			var packet RayPacket
+			numSteps := 0
+			for i := 0; i < b.N; i++ {
+				plane := camera.Plane()
+				for y := int32(0); y < res.Y; y += PACKET_SIZE {
+					for x := int32(0); x < res.X; x += PACKET_SIZE {
+						camera.Packet(&plane, x, y, res.X, res.Y, &packet)
+						grid.RaycastPacket(&packet)
+						numSteps += int(packet.NumSteps)
+					}
+				}
+			}
+			b.ReportMetric(float64(numSteps)/float64(b.N)/numRays, "steps/ray")
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N)/numRays, "ns/ray")
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package voxel
+
+import (
+	"io"
+	"slices"
+	"sync/atomic"
+)
+
+// PAGE_SIZE is how many entries of a grid's storage are kept together.
+// snapshots share pages with the grid, and an edit only copies the pages it
+// writes to that a snapshot is still using
+const PAGE_SIZE = 4096
+
+type page[T any] struct {
+	data [PAGE_SIZE]T
+	refs atomic.Int32 // number of snapshots using the page
+}
+
+// pages is an array kept in pages of PAGE_SIZE entries so that snapshots can
+// share the parts of it that haven't changed
+type pages[T any] struct {
+	table []*page[T]
+	n     int32
+}
+
+func newPages[T any](n int32) pages[T] {
+	p := pages[T]{table: make([]*page[T], (n+PAGE_SIZE-1)/PAGE_SIZE), n: n}
+	for i := range p.table {
+		p.table[i] = new(page[T])
+	}
+	return p
+}
+
+// len is how many entries there are
+func (p *pages[T]) len() int32 {
+	return p.n
+}
+
+func (p *pages[T]) get(i int32) T {
+	return p.table[uint32(i)/PAGE_SIZE].data[uint32(i)%PAGE_SIZE]
+}
+
+// set writes entry i, its page is copied first if a snapshot is using it
+func (p *pages[T]) set(i int32, v T) {
+	pg := p.table[uint32(i)/PAGE_SIZE]
+	if pg.refs.Load() > 0 {
+		pg = &page[T]{data: pg.data}
+		p.table[uint32(i)/PAGE_SIZE] = pg
+	}
+	pg.data[uint32(i)%PAGE_SIZE] = v
+}
+
+// append adds v to the end
+func (p *pages[T]) append(v T) int32 {
+	if p.n%PAGE_SIZE == 0 {
+		p.table = append(p.table, new(page[T]))
+	}
+	p.n++
+	p.set(p.n-1, v)
+	return p.n - 1
+}
+
+// clear sets every entry to zero, pages that snapshots are using are
+// replaced rather than written
+func (p *pages[T]) clear() {
+	for i, pg := range p.table {
+		if pg.refs.Load() > 0 {
+			p.table[i] = new(page[T])
+		} else {
+			pg.data = [PAGE_SIZE]T{}
+		}
+	}
+}
+
+// share returns a copy of the array for a snapshot, it uses the same pages
+// until they are written
+func (p *pages[T]) share() pages[T] {
+	for _, pg := range p.table {
+		pg.refs.Add(1)
+	}
+	return pages[T]{table: slices.Clone(p.table), n: p.n}
+}
+
+// release is called when the snapshot a copy was shared for is done with it
+func (p *pages[T]) release() {
+	for _, pg := range p.table {
+		pg.refs.Add(-1)
+	}
+	p.table = nil
+}
+
+// slice returns every entry in order
+func (p *pages[T]) slice() []T {
+	s := make([]T, 0, p.n)
+	for _, pg := range p.table {
+		s = append(s, pg.data[:min(PAGE_SIZE, p.n-int32(len(s)))]...)
+	}
+	return s
+}
+
+// readPages reads n bytes a page at a time, so nothing much is allocated
+// before the data turns out to be short
+func readPages(r io.Reader, n int32) (pages[uint8], error) {
+	p := pages[uint8]{n: n}
+	for start := int32(0); start < n; start += PAGE_SIZE {
+		pg := new(page[uint8])
+		if _, err := io.ReadFull(r, pg.data[:min(PAGE_SIZE, n-start)]); err != nil {
+			return pages[uint8]{}, err
+		}
+		p.table = append(p.table, pg)
+	}
+	return p, nil
+}
+
+// writePages writes the bytes a page at a time
+func writePages(w io.Writer, p pages[uint8]) error {
+	for i, pg := range p.table {
+		if _, err := w.Write(pg.data[:min(PAGE_SIZE, p.n-int32(i)*PAGE_SIZE)]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pagesOf copies s into pages
+func pagesOf[T any](s []T) pages[T] {
+	p := newPages[T](int32(len(s)))
+	for i, pg := range p.table {
+		copy(pg.data[:], s[i*PAGE_SIZE:])
+	}
+	return p
+}
@@ -0,0 +1,56 @@
+package voxel
+
+import (
+	"sync"
+)
+
+// EditQueue collects edits from any goroutine so they can be made to a grid
+// at a point where nothing is reading it, normally between frames. the zero
+// value is an empty queue ready to use
+type EditQueue struct {
+	mu    sync.Mutex
+	edits []func(grid *VoxelGrid)
+}
+
+// Push adds an edit to be made the next time the queue is applied
+func (queue *EditQueue) Push(edit func(grid *VoxelGrid)) {
+	queue.mu.Lock()
+	queue.edits = append(queue.edits, edit)
+	queue.mu.Unlock()
+}
+
+func (queue *EditQueue) SetVoxel(x, y, z int32, set bool) {
+	queue.Push(func(grid *VoxelGrid) {
+		grid.SetVoxel(x, y, z, set)
+	})
+}
+
+func (queue *EditQueue) SetMaterial(x, y, z int32, m Material) {
+	queue.Push(func(grid *VoxelGrid) {
+		grid.SetMaterial(x, y, z, m)
+	})
+}
+
+// Len returns the number of edits waiting to be applied
+func (queue *EditQueue) Len() int {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	return len(queue.edits)
+}
+
+// Apply makes the queued edits to the grid in the order they were pushed and
+// returns how many there were. it must be called by the goroutine that owns
+// the grid while nothing else is reading it. edits pushed while it runs are
+// left for the next call
+func (queue *EditQueue) Apply(grid *VoxelGrid) int {
+	queue.mu.Lock()
+	edits := queue.edits
+	queue.edits = nil
+	queue.mu.Unlock()
+
+	for _, edit := range edits {
+		edit(grid)
+	}
+
+	return len(edits)
+}
@@ -0,0 +1,127 @@
+package voxel
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+// renderFrame traces a fan of rays across the grid from several goroutines
+// the same way the scenes do, returning what each ray hit
+func renderFrame(grid *VoxelGrid, width, height int) []Vector3i {
+	hits := make([]Vector3i, width*height)
+	rayPos := Vector3f{X: -4, Y: float32(grid.NumVoxelsY) * float32(grid.VoxelSize) / 2, Z: -4}
+
+	var wait sync.WaitGroup
+	for t := 0; t < 4; t++ {
+		wait.Add(1)
+		go func(t int) {
+			defer wait.Done()
+			for y := t; y < height; y += 4 {
+				for x := 0; x < width; x++ {
+					rayDir := Vector3f{X: 1, Y: float32(y)/float32(height) - 0.5, Z: float32(x) / float32(width)}.Normalize()
+					if hit := grid.RaycastRecursive(rayPos, rayDir); hit.Hit() {
+						hits[x+y*width] = hit.MapPos
+					}
+				}
+			}
+		}(t)
+	}
+	wait.Wait()
+
+	return hits
+}
+
+func editsGrid(n int32) *VoxelGrid {
+	grid := NewVoxelGrid(n, n, n, 1)
+	for z := int32(0); z < n; z++ {
+		for x := int32(0); x < n; x++ {
+			grid.SetVoxel(x, 0, z, true)
+		}
+	}
+
+	lowest := grid
+	for lowest.NumVoxelsY > 2 {
+		lowest = lowest.Compress()
+	}
+	return lowest
+}
+
+func TestEditQueueRenderWhileEditing(t *testing.T) {
+	const n = 32
+	voxels := editsGrid(n)
+	grid := voxels
+	for grid.Parent != nil {
+		grid = grid.Parent
+	}
+
+	var queue EditQueue
+
+	// edits come in from another goroutine while frames are rendered
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r := rand.New(rand.NewSource(1))
+		for i := 0; i < 5000; i++ {
+			queue.SetMaterial(r.Int31n(n), r.Int31n(n), r.Int31n(n), Material(r.Intn(4)+1))
+			queue.SetVoxel(r.Int31n(n), r.Int31n(n), r.Int31n(n), false)
+		}
+	}()
+
+	applied := 0
+	for {
+		select {
+		case <-done:
+			applied += queue.Apply(grid)
+			if applied != 10000 || queue.Len() != 0 {
+				t.Fatalf("Edits not applied: %d %d\n", applied, queue.Len())
+			}
+			return
+		default:
+		}
+		applied += queue.Apply(grid)
+		renderFrame(voxels, 32, 32)
+	}
+}
+
+func TestSnapshotRenderWhileEditing(t *testing.T) {
+	const n = 32
+	grid := editsGrid(n)
+	for grid.Parent != nil {
+		grid = grid.Parent
+	}
+
+	r := rand.New(rand.NewSource(2))
+
+	for frame := 0; frame < 10; frame++ {
+		snapshot := grid.Snapshot()
+		voxels := snapshot
+		for voxels.Child != nil {
+			voxels = voxels.Child
+		}
+
+		// the owner keeps editing while the snapshot is rendered twice
+		var wait sync.WaitGroup
+		var first, second []Vector3i
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			first = renderFrame(voxels, 32, 32)
+			second = renderFrame(voxels, 32, 32)
+		}()
+
+		for i := 0; i < 500; i++ {
+			grid.SetVoxel(r.Int31n(n), r.Int31n(n), r.Int31n(n), r.Intn(2) == 0)
+		}
+
+		wait.Wait()
+		snapshot.Release()
+
+		// edits must not show up part way through
+		for i := range first {
+			if !first[i].Equals(second[i]) {
+				t.Fatalf("Snapshot changed during frame %d\n", frame)
+			}
+		}
+	}
+}
@@ -1,5 +1,12 @@
 package voxel
 
+import (
+	"math"
+)
+
+// RaycastResult is why a ray stopped. while stepping RAYCAST_MISS means
+// there is nothing in the current voxel, as a RaycastHit Status it means the
+// ray never went into the grid at all
 type RaycastResult int
 
 const (
@@ -7,6 +14,8 @@ const (
 	RAYCAST_MISS
 	RAYCAST_OUT_OF_BOUNDS
 	RAYCAST_MAX_STEPS
+	RAYCAST_STARTED_INSIDE // the voxel the ray started in is set
+	RAYCAST_UNLOADED       // a StreamingWorld chunk that isn't loaded yet
 )
 
 type RaycastCallback func(grid *VoxelGrid, mapPos Vector3i)
@@ -73,30 +82,99 @@ func calcSideDist(rayPos Vector3f, rayDir Vector3f, deltaDist Vector3f, mapPos V
 	return sideDist
 }
 
-func (grid *VoxelGrid) Raycast(rayPos Vector3f, rayDir Vector3f) (int32, Vector3f, Vector3i) {
+// clipRay finds where a ray starting outside a box of count voxels enters it,
+// so the DDA can start there instead of walking empty cells to reach it.
+// rayPos is in voxels. it returns how far along the ray the entry is, the
+// voxel entered, the face it was entered through and false if the ray misses
+// the box. rays starting inside are left where they are with FACE_NONE
+func clipRay(rayPos Vector3f, rayDir Vector3f, count Vector3i) (float32, Vector3i, Face, bool) {
+	tNear, tFar := float32(math.Inf(-1)), float32(math.Inf(1))
+	axis := 0
+
+	pos, dir, hi := [3]float32{rayPos.X, rayPos.Y, rayPos.Z}, [3]float32{rayDir.X, rayDir.Y, rayDir.Z}, [3]int32{count.X, count.Y, count.Z}
+	for i := range pos {
+		if dir[i] == 0 {
+			if pos[i] < 0 || pos[i] >= float32(hi[i]) {
+				return 0, Vector3i{}, FACE_NONE, false
+			}
+			continue
+		}
+
+		t0, t1 := -pos[i]/dir[i], (float32(hi[i])-pos[i])/dir[i]
+		if t0 > t1 {
+			t0, t1 = t1, t0
+		}
+		if t0 > tNear {
+			tNear, axis = t0, i
+		}
+		tFar = min(tFar, t1)
+	}
+
+	if tNear > tFar || tFar <= 0 {
+		return 0, Vector3i{}, FACE_NONE, false
+	}
+	if tNear <= 0 {
+		return 0, rayPos.Floor().ToVector3i(), FACE_NONE, true
+	}
+
+	// the voxel the entry point is in, kept inside the box in case of
+	// rounding and on the face we came through
+	entry := [3]int32{}
+	for i := range entry {
+		entry[i] = max(0, min(hi[i]-1, int32(math.Floor(float64(pos[i]+dir[i]*tNear)))))
+	}
+	step := int32(1)
+	if dir[axis] > 0 {
+		entry[axis] = 0
+	} else {
+		entry[axis] = hi[axis] - 1
+		step = -1
+	}
+
+	return tNear, Vector3i{X: entry[0], Y: entry[1], Z: entry[2]}, stepFace(axis, step), true
+}
+
+// level is how many times the grid has been compressed from full res
+func (grid *VoxelGrid) level() int32 {
+	level := int32(0)
+	for g := grid.Parent; g != nil; g = g.Parent {
+		level++
+	}
+	return level
+}
+
+func (grid *VoxelGrid) Raycast(rayPos Vector3f, rayDir Vector3f) RaycastHit {
 	return grid.RaycastC(rayPos, rayDir, nil)
 }
 
-func (grid *VoxelGrid) RaycastC(rayPos Vector3f, rayDir Vector3f, callback RaycastCallback) (int32, Vector3f, Vector3i) {
-	// convert rayPos to voxel space
-	rayPos = rayPos.DivScalar(grid.VoxelSize)
+func (grid *VoxelGrid) RaycastC(rayPos Vector3f, rayDir Vector3f, callback RaycastCallback) RaycastHit {
+	return grid.raycast(rayPos, rayDir, rayDir.Inverse().Abs(), rayDir.Sign().ToVector3i(), grid.level(), callback)
+}
 
-	// which box of the map we're in
-	mapPos := rayPos.ToVector3i()
+// raycast is RaycastC with the parts that only depend on rayDir worked out
+// by the caller, so rays traced through several levels only do them once
+func (grid *VoxelGrid) raycast(rayPos Vector3f, rayDir Vector3f, deltaDist Vector3f, step Vector3i, level int32, callback RaycastCallback) RaycastHit {
+	hit := RaycastHit{Level: level}
+	start := rayPos
 
-	// length of ray from one xyz side to next
-	deltaDist := rayDir.Inverse().Abs()
+	// convert rayPos to voxel space
+	rayPos = rayPos.DivScalar(grid.VoxelSize)
 
-	// what direction to step in x or y-direction (either +1 or -1)
-	step := rayDir.Sign().ToVector3i()
+	// skip straight to where the ray enters the grid, which box of the map
+	// that is and which face it came in through
+	dist, mapPos, face, ok := clipRay(rayPos, rayDir, grid.Count())
+	if !ok {
+		hit.Status = RAYCAST_MISS
+		hit.HitPos, hit.MapPos = start, rayPos.Floor().ToVector3i()
+		return hit
+	}
 
 	// length of ray from current position to next x or y-side
-	sideDist := calcSideDist(rayPos, rayDir, deltaDist, mapPos)
+	firstSide := calcSideDist(rayPos, rayDir, deltaDist, mapPos)
+	sideDist := firstSide
+	var numSides Vector3i
 
-	hit, side := int32(0), int32(4)
-	dist := float32(0.0)
-
-	for hit == 0 {
+	for {
 		// call optional callback
 		if callback != nil {
 			callback(grid, mapPos)
@@ -104,75 +182,92 @@ func (grid *VoxelGrid) RaycastC(rayPos Vector3f, rayDir Vector3f, callback Rayca
 
 		// check if we have hit anything
 		result := grid.checkHit(mapPos, rayDir)
+		hit.NumSteps++
 
 		// no point proceeding if OOB
 		if result == RAYCAST_OUT_OF_BOUNDS {
-			hit = 0
+			hit.Status = RAYCAST_OUT_OF_BOUNDS
 			break
 		}
 
 		// we hit something
 		if result == RAYCAST_HIT {
-			hit = side
+			hit.Status = RAYCAST_HIT
+			if face == FACE_NONE {
+				hit.Status = RAYCAST_STARTED_INSIDE
+			}
 			break
 		}
 
 		// jump to next map square, either in x, y or z direction
 		if sideDist.X <= sideDist.Y && sideDist.X <= sideDist.Z {
 			dist = sideDist.X
-			sideDist.X += deltaDist.X
+			numSides.X++
+			sideDist.X = sideDistAt(firstSide.X, deltaDist.X, numSides.X)
 			mapPos.X += step.X
-			side = 1 * step.X
+			face = stepFace(0, step.X)
 		} else if sideDist.Y <= sideDist.X && sideDist.Y <= sideDist.Z {
 			dist = sideDist.Y
-			sideDist.Y += deltaDist.Y
+			numSides.Y++
+			sideDist.Y = sideDistAt(firstSide.Y, deltaDist.Y, numSides.Y)
 			mapPos.Y += step.Y
-			side = 2 * step.Y
+			face = stepFace(1, step.Y)
 		} else {
 			dist = sideDist.Z
-			sideDist.Z += deltaDist.Z
+			numSides.Z++
+			sideDist.Z = sideDistAt(firstSide.Z, deltaDist.Z, numSides.Z)
 			mapPos.Z += step.Z
-			side = 3 * step.Z
+			face = stepFace(2, step.Z)
 		}
 	}
 
-	hitPos := rayPos.Plus(rayDir.MulScalar(dist)).MulScalar(grid.VoxelSize)
+	hit.Face, hit.Normal = face, face.Normal()
+	hit.T = dist * grid.VoxelSize
+	hit.HitPos = rayPos.Plus(rayDir.MulScalar(dist)).MulScalar(grid.VoxelSize)
+	hit.MapPos = mapPos
+
+	return hit
+}
 
-	return hit, hitPos, mapPos
+// sideDistAt is how far along a ray its side on an axis is after n steps
+// along it. the conversion stops the multiply and add being fused, so a side
+// is exactly the same distance whether the ray stepped there or seeked
+func sideDistAt(firstSide float32, deltaDist float32, n int32) float32 {
+	return firstSide + float32(float32(n)*deltaDist)
 }
 
-func (grid *VoxelGrid) RaycastRecursive(rayPos Vector3f, rayDir Vector3f) (int32, Vector3f, Vector3i) {
+func (grid *VoxelGrid) RaycastRecursive(rayPos Vector3f, rayDir Vector3f) RaycastHit {
 	return grid.RaycastRecursiveC(rayPos, rayDir, nil)
 }
 
-func (grid *VoxelGrid) RaycastRecursiveC(rayPos Vector3f, rayDir Vector3f, callback RaycastCallback) (int32, Vector3f, Vector3i) {
+// RaycastRecursiveC starts at a low res grid and moves up to a higher res one
+// each time something is hit, the result is from the full res grid unless
+// nothing was hit
+func (grid *VoxelGrid) RaycastRecursiveC(rayPos Vector3f, rayDir Vector3f, callback RaycastCallback) RaycastHit {
+	return grid.raycastRecursive(rayPos, rayDir, 0, 0, callback)
+}
+
+// t and numSteps are how far the ray has come and how many steps it took
+// at lower res
+func (grid *VoxelGrid) raycastRecursive(rayPos Vector3f, rayDir Vector3f, t float32, numSteps int32, callback RaycastCallback) RaycastHit {
 	// for the max resolution grid we move rayPos back slightly
 	// as this reduces the chances of it starting inside a voxel
 	if grid.Parent == nil {
 		rayPos = rayPos.Sub(rayDir)
+		t--
 	}
 
 	// perform the DDA
-	hit, hitPos, mapPos := grid.RaycastC(rayPos, rayDir, callback)
-
-	/*
-		if hit == 5 {
-			// nothing hit because we reached max steps
-			// proceed using a lower res grid
-			if grid.Child != nil {
-				return grid.Child.RaycastRecursive(hitPos, rayDir, callback)
-			} else {
-				return grid.RaycastRecursive(hitPos, rayDir, callback)
-			}
-		}
-	*/
+	hit := grid.RaycastC(rayPos, rayDir, callback)
+	hit.T += t
+	hit.NumSteps += numSteps
 
 	// nothing was hit or there is no parent so return immediately
-	if hit == 0 || grid.Parent == nil {
-		return hit, hitPos, mapPos
+	if !hit.Hit() || grid.Parent == nil {
+		return hit
 	}
 
 	// something was hit
 	// proceed using a high res grid
-	return grid.Parent.RaycastRecursiveC(hitPos, rayDir, callback)
+	return grid.Parent.raycastRecursive(hit.HitPos, rayDir, hit.T, hit.NumSteps, callback)
 }
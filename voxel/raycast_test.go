@@ -0,0 +1,118 @@
+package voxel
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestTraceFromOutside(t *testing.T) {
+	voxels := NewTestVoxels(16, 16, 16, 1)
+	voxels.Set(8, 8, 8, true)
+
+	grid := NewVoxelGrid(16, 16, 16, 1)
+	grid.SetVoxel(8, 8, 8, true)
+
+	// from all around the grid, rays go straight to where they enter it
+	target := Vector3f{X: 8.5, Y: 8.5, Z: 8.5}
+	for i := 0; i < 500; i++ {
+		a, b := float64(i)*0.37, float64(i)*0.11
+		start := target.Plus(Vector3f{X: float32(math.Cos(a) * math.Cos(b)), Y: float32(math.Sin(b)), Z: float32(math.Sin(a) * math.Cos(b))}.MulScalar(40))
+		rayDir := Direction(target, start)
+
+		result := Trace(&voxels, TraceParams{RayStart: start, RayDir: rayDir})
+		if !result.Hit() || !result.MapPos.Equals(Vector3i{X: 8, Y: 8, Z: 8}) || result.NumSteps > 30 {
+			t.Fatalf("Incorrect trace from %v: %+v\n", start, result)
+		}
+
+		hit := grid.RaycastC(start, rayDir, nil)
+		if hit.Face != result.Face || !hit.MapPos.Equals(result.MapPos) || Distance(hit.HitPos, result.HitPos) > 0.001 {
+			t.Fatalf("Incorrect raycast from %v: %+v, expected %+v\n", start, hit, result)
+		}
+
+		// T is measured from where the ray started, not where it entered
+		if math.Abs(float64(Distance(start, hit.HitPos)-hit.T)) > 0.001 {
+			t.Fatalf("Incorrect t from %v: %+v\n", start, hit)
+		}
+	}
+
+	// a voxel on the edge is hit on the face the ray comes in through
+	voxels.Set(0, 5, 5, true)
+	grid.SetVoxel(0, 5, 5, true)
+	result := Trace(&voxels, TraceParams{RayStart: Vector3f{X: -10, Y: 5.5, Z: 5.2}, RayDir: Vector3f{X: 1, Y: 0.01}.Normalize()})
+	if !result.Hit() || result.Face != FACE_NEG_X || result.Normal != (Vector3f{X: -1}) || result.NumSteps != 1 || result.HitPos.X != 0 {
+		t.Fatalf("Incorrect trace into the edge: %+v\n", result)
+	}
+	if hit := grid.Raycast(Vector3f{X: -10, Y: 5.5, Z: 5.2}, Vector3f{X: 1, Y: 0.01}.Normalize()); hit.Face != FACE_NEG_X || hit.HitPos.X != 0 {
+		t.Fatalf("Incorrect raycast into the edge: %+v\n", hit)
+	}
+
+	// rays that miss the grid don't step at all
+	misses := []TraceParams{
+		{RayStart: Vector3f{X: -10, Y: 8, Z: 8}, RayDir: Vector3f{X: -1}},
+		{RayStart: Vector3f{X: -10, Y: 8, Z: 8}, RayDir: Vector3f{X: 1, Y: 2}.Normalize()},
+		{RayStart: Vector3f{X: 8, Y: 20, Z: 8}, RayDir: Vector3f{X: 1}},
+	}
+	for _, params := range misses {
+		calls := 0
+		params.Callback = func(voxels *Voxels, mapPos Vector3i) { calls++ }
+		if result := Trace(&voxels, params); result.Status != RAYCAST_MISS || result.NumSteps != 0 || calls != 0 {
+			t.Fatalf("Incorrect miss: %+v\n", result)
+		}
+
+		hit := grid.RaycastC(params.RayStart, params.RayDir, func(grid *VoxelGrid, mapPos Vector3i) { calls++ })
+		if hit.Status != RAYCAST_MISS || calls != 0 {
+			t.Fatalf("Raycast stepped for a miss: %+v\n", params)
+		}
+	}
+}
+
+// sunRays start well outside the grid, like the shadow rays fired from
+// RaycastingScene.SunPos, and head for a point inside it
+func sunRays(n int) []TraceParams {
+	r := rand.New(rand.NewSource(1))
+	sun := Vector3f{X: -200, Y: 400, Z: -100}
+	rays := make([]TraceParams, n)
+	for i := range rays {
+		target := Vector3f{X: r.Float32() * benchWidth, Y: r.Float32() * benchHeight / 2, Z: r.Float32() * benchWidth}
+		rays[i].RayStart = sun
+		rays[i].RayDir = Direction(target, sun)
+	}
+	return rays
+}
+
+func BenchmarkTraceFromOutside(b *testing.B) {
+	var voxels Voxels = NewTestVoxels(benchWidth, benchHeight, benchWidth, 1)
+	benchHeightfield(func(x, y, z int32) { voxels.Set(x, y, z, true) })
+
+	rays := sunRays(1024)
+	numSteps := 0
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		numSteps += int(Trace(&voxels, rays[i%len(rays)]).NumSteps)
+	}
+
+	b.ReportMetric(float64(numSteps)/float64(b.N), "steps/ray")
+}
+
+func BenchmarkRaycastFromOutside(b *testing.B) {
+	grid := NewVoxelGrid(benchWidth, benchHeight, benchWidth, 1)
+	benchHeightfield(func(x, y, z int32) { grid.SetVoxel(x, y, z, true) })
+
+	// count the voxels each ray visits
+	numSteps := 0
+	count := func(grid *VoxelGrid, mapPos Vector3i) {
+		numSteps++
+	}
+
+	rays := sunRays(1024)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		ray := rays[i%len(rays)]
+		grid.RaycastC(ray.RayStart, ray.RayDir, count)
+	}
+
+	b.ReportMetric(float64(numSteps)/float64(b.N), "steps/ray")
+}
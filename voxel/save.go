@@ -0,0 +1,341 @@
+package voxel
+
+// Grids are saved in the following format, all values are little endian
+//
+//	magic    [4]byte   "VOXG"
+//	version  uint16    currently 1
+//	flags    uint16    SAVE_MATERIALS if material data follows the levels
+//	levels   uint16    the grid followed by this many - 1 Child levels
+//
+// everything after the header is zlib compressed. first comes each level
+// from highest to lowest resolution
+//
+//	count    3*int32   NumVoxelsX, NumVoxelsY, NumVoxelsZ
+//	size     float32   VoxelSize
+//	voxels   []uint8   packed bricks, padded as NewVoxelGrid does
+//
+// then the palette
+//
+//	count    uint32
+//	colors   count*[4]uint8  r, g, b, a
+//
+// and if SAVE_MATERIALS is set the materials of the highest resolution level
+//
+//	entries  []uint32  one per brick, see mixedBrick
+//	count    uint32    number of brick palettes
+//	palettes count*(n uint8, n*uint16 materials, [8]uint8 indices)
+
+import (
+	"bufio"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+)
+
+const SAVE_MAGIC = "VOXG"
+
+const SAVE_VERSION = 1
+
+const (
+	SAVE_MATERIALS = 1 << iota
+)
+
+// the most bricks a level can have, a 2048x2048x2048 grid. anything bigger
+// is taken to be a corrupt file rather than allocated
+const MAX_LOAD_BRICKS = 1 << 30
+
+type saveHeader struct {
+	Magic   [4]byte
+	Version uint16
+	Flags   uint16
+	Levels  uint16
+}
+
+type saveLevel struct {
+	NumVoxelsX int32
+	NumVoxelsY int32
+	NumVoxelsZ int32
+	VoxelSize  float32
+}
+
+// Save writes the grid and all of its lower res Child levels
+func (grid *VoxelGrid) Save(w io.Writer) error {
+	header := saveHeader{Version: SAVE_VERSION}
+	copy(header.Magic[:], SAVE_MAGIC)
+
+	var levels []*VoxelGrid
+	for level := grid; level != nil; level = level.Child {
+		levels = append(levels, level)
+		header.Levels++
+	}
+
+	if levels[0].materials.len() != 0 {
+		header.Flags |= SAVE_MATERIALS
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, &header); err != nil {
+		return err
+	}
+
+	zw := zlib.NewWriter(w)
+	bw := bufio.NewWriter(zw)
+
+	if err := saveData(bw, levels); err != nil {
+		zw.Close()
+		return err
+	}
+
+	if err := bw.Flush(); err != nil {
+		zw.Close()
+		return err
+	}
+
+	return zw.Close()
+}
+
+func saveData(w io.Writer, levels []*VoxelGrid) error {
+	grid := levels[0]
+
+	for _, level := range levels {
+		info := saveLevel{level.NumVoxelsX, level.NumVoxelsY, level.NumVoxelsZ, level.VoxelSize}
+		if err := binary.Write(w, binary.LittleEndian, &info); err != nil {
+			return err
+		}
+		if err := writePages(w, level.voxels); err != nil {
+			return err
+		}
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, uint32(len(grid.Palette))); err != nil {
+		return err
+	}
+	for _, c := range grid.Palette {
+		if _, err := w.Write([]uint8{c.R, c.G, c.B, c.A}); err != nil {
+			return err
+		}
+	}
+
+	if grid.materials.len() == 0 {
+		return nil
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, grid.materials.slice()); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, uint32(grid.palettes.len())); err != nil {
+		return err
+	}
+	for _, palette := range grid.palettes.slice() {
+		if err := binary.Write(w, binary.LittleEndian, uint8(len(palette.materials))); err != nil {
+			return err
+		}
+		if err := binary.Write(w, binary.LittleEndian, palette.materials); err != nil {
+			return err
+		}
+		if _, err := w.Write(palette.indices[:]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Load reads a grid written by Save, the grid is returned with its Child levels
+// already linked up
+func Load(r io.Reader) (*VoxelGrid, error) {
+	var header saveHeader
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, fmt.Errorf("Load: reading header: %w", err)
+	}
+
+	if string(header.Magic[:]) != SAVE_MAGIC {
+		return nil, fmt.Errorf("Load: not a voxel grid")
+	}
+
+	if header.Version != SAVE_VERSION {
+		return nil, fmt.Errorf("Load: unsupported version %d", header.Version)
+	}
+
+	if header.Levels == 0 {
+		return nil, fmt.Errorf("Load: no levels")
+	}
+
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("Load: %w", err)
+	}
+	defer zr.Close()
+
+	br := bufio.NewReader(zr)
+	grid, err := loadData(br, header)
+	if err != nil {
+		return nil, fmt.Errorf("Load: %w", err)
+	}
+
+	// reading to the end checks the data wasn't corrupted
+	if n, err := io.Copy(io.Discard, br); err != nil || n != 0 {
+		return nil, fmt.Errorf("Load: unexpected data at end, %d bytes, %v", n, err)
+	}
+
+	return grid, nil
+}
+
+func loadData(r io.Reader, header saveHeader) (*VoxelGrid, error) {
+	var grid, prev *VoxelGrid
+
+	for i := uint16(0); i < header.Levels; i++ {
+		var info saveLevel
+		if err := binary.Read(r, binary.LittleEndian, &info); err != nil {
+			return nil, err
+		}
+
+		if info.NumVoxelsX <= 0 || info.NumVoxelsY <= 0 || info.NumVoxelsZ <= 0 {
+			return nil, fmt.Errorf("invalid size %d, %d, %d", info.NumVoxelsX, info.NumVoxelsY, info.NumVoxelsZ)
+		}
+
+		// lower levels must be exactly what Compress would have made
+		if prev != nil && (info.NumVoxelsX != halfCount(prev.NumVoxelsX) ||
+			info.NumVoxelsY != halfCount(prev.NumVoxelsY) ||
+			info.NumVoxelsZ != halfCount(prev.NumVoxelsZ)) {
+			return nil, fmt.Errorf("invalid level size %d, %d, %d", info.NumVoxelsX, info.NumVoxelsY, info.NumVoxelsZ)
+		}
+
+		if !(info.VoxelSize > 0) || math.IsInf(float64(info.VoxelSize), 1) {
+			return nil, fmt.Errorf("invalid voxel size %v", info.VoxelSize)
+		}
+		if prev != nil && info.VoxelSize != prev.VoxelSize*2 {
+			return nil, fmt.Errorf("invalid level voxel size %v", info.VoxelSize)
+		}
+
+		// worked out the same as NewVoxelGrid but without overflowing
+		numBricks := (int64(info.NumVoxelsX) + 1) / 2 * ((int64(info.NumVoxelsY) + 1) / 2) * ((int64(info.NumVoxelsZ) + 1) / 2)
+		if numBricks > MAX_LOAD_BRICKS {
+			return nil, fmt.Errorf("size too big %d, %d, %d", info.NumVoxelsX, info.NumVoxelsY, info.NumVoxelsZ)
+		}
+
+		voxels, err := readPages(r, int32((numBricks+3)/4*4))
+		if err != nil {
+			return nil, err
+		}
+
+		level := &VoxelGrid{
+			NumVoxelsX: info.NumVoxelsX,
+			NumVoxelsY: info.NumVoxelsY,
+			NumVoxelsZ: info.NumVoxelsZ,
+			VoxelSize:  info.VoxelSize,
+			voxels:     voxels,
+		}
+
+		if prev == nil {
+			grid = level
+		} else {
+			if err := checkCompressed(prev, level); err != nil {
+				return nil, err
+			}
+			prev.Child = level
+			level.Parent = prev
+		}
+		prev = level
+	}
+
+	var numColors uint32
+	if err := binary.Read(r, binary.LittleEndian, &numColors); err != nil {
+		return nil, err
+	}
+	if numColors > 1<<16 {
+		return nil, fmt.Errorf("invalid palette size %d", numColors)
+	}
+
+	if numColors > 0 {
+		rgba := make([]uint8, numColors*4)
+		if _, err := io.ReadFull(r, rgba); err != nil {
+			return nil, err
+		}
+		grid.Palette = make([]color.RGBA, numColors)
+		for i := range grid.Palette {
+			grid.Palette[i] = color.RGBA{R: rgba[i*4], G: rgba[i*4+1], B: rgba[i*4+2], A: rgba[i*4+3]}
+		}
+		for level := grid.Child; level != nil; level = level.Child {
+			level.Palette = grid.Palette
+		}
+	}
+
+	if header.Flags&SAVE_MATERIALS == 0 {
+		return grid, nil
+	}
+
+	materials := make([]uint32, grid.voxels.len())
+	if err := binary.Read(r, binary.LittleEndian, materials); err != nil {
+		return nil, err
+	}
+
+	var numPalettes uint32
+	if err := binary.Read(r, binary.LittleEndian, &numPalettes); err != nil {
+		return nil, err
+	}
+	if numPalettes > uint32(grid.voxels.len()) {
+		return nil, fmt.Errorf("invalid number of brick palettes %d", numPalettes)
+	}
+
+	palettes := make([]brickPalette, numPalettes)
+	for i := range palettes {
+		palette := &palettes[i]
+
+		var n uint8
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+			return nil, err
+		}
+		if n > 8 {
+			return nil, fmt.Errorf("invalid brick palette size %d", n)
+		}
+
+		palette.materials = make([]Material, n)
+		if err := binary.Read(r, binary.LittleEndian, palette.materials); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(r, palette.indices[:]); err != nil {
+			return nil, err
+		}
+
+		// empty palettes are ones that were free when saved
+		if n == 0 {
+			palette.materials = nil
+			grid.freePalettes = append(grid.freePalettes, uint32(i))
+			continue
+		}
+
+		for _, index := range palette.indices {
+			if int(index) >= len(palette.materials) {
+				return nil, fmt.Errorf("invalid brick palette index %d", index)
+			}
+		}
+	}
+
+	for _, entry := range materials {
+		if entry&mixedBrick != 0 && (entry&^mixedBrick >= numPalettes || palettes[entry&^mixedBrick].materials == nil) {
+			return nil, fmt.Errorf("invalid brick palette %d", entry&^mixedBrick)
+		}
+	}
+
+	grid.materials, grid.palettes = pagesOf(materials), pagesOf(palettes)
+	return grid, nil
+}
+
+// checkCompressed checks child is what Compress makes from grid, each voxel is
+// set if anything in the brick it was made from is
+func checkCompressed(grid, child *VoxelGrid) error {
+	for y := int32(0); y < child.NumVoxelsY; y++ {
+		for z := int32(0); z < child.NumVoxelsZ; z++ {
+			for x := int32(0); x < child.NumVoxelsX; x++ {
+				if child.GetVoxel(x, y, z) != (grid.voxels.get(grid.VoxelIndex(x*2, y*2, z*2)) != 0) {
+					return fmt.Errorf("level doesn't match the one above it at %d, %d, %d", x, y, z)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package voxel
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func checkSameGrid(t *testing.T, expected, loaded *VoxelGrid) {
+	for ; expected != nil; expected, loaded = expected.Child, loaded.Child {
+		if loaded == nil {
+			t.Fatalf("Missing level: %+v\n", expected.Count())
+		}
+
+		if !loaded.Count().Equals(expected.Count()) || loaded.VoxelSize != expected.VoxelSize {
+			t.Fatalf("Incorrect level: %+v %f\n", loaded.Count(), loaded.VoxelSize)
+		}
+
+		if !bytes.Equal(loaded.Bricks(), expected.Bricks()) {
+			t.Fatalf("Incorrect voxels: %+v\n", loaded.Count())
+		}
+
+		if loaded.Child != nil && loaded.Child.Parent != loaded {
+			t.Fatalf("Levels not linked: %+v\n", loaded.Count())
+		}
+	}
+
+	if loaded != nil {
+		t.Fatalf("Unexpected level: %+v\n", loaded.Count())
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	grid := NewVoxelGrid(9, 5, 12, 0.5)
+	grid.Palette = []color.RGBA{{}, {R: 255, A: 255}, {G: 255, A: 255}}
+	grid.SetVoxel(0, 0, 0, true)
+	grid.SetMaterial(8, 4, 11, 1)
+	grid.SetMaterial(1, 1, 1, 1)
+	grid.SetMaterial(0, 1, 1, 2)
+	grid.SetMaterial(6, 2, 3, 2)
+	grid.SetMaterial(7, 2, 3, 1)
+	grid.SetVoxel(7, 2, 3, false) // leaves a free brick palette
+
+	var buf bytes.Buffer
+	if err := grid.Save(&buf); err != nil {
+		t.Fatalf("Save failed: %v\n", err)
+	}
+
+	loaded, err := Load(&buf)
+	if err != nil {
+		t.Fatalf("Load failed: %v\n", err)
+	}
+
+	checkSameGrid(t, grid, loaded)
+
+	if len(loaded.Palette) != 3 || loaded.Palette[2] != grid.Palette[2] {
+		t.Fatalf("Incorrect palette: %+v\n", loaded.Palette)
+	}
+
+	for y := int32(0); y < grid.NumVoxelsY; y++ {
+		for z := int32(0); z < grid.NumVoxelsZ; z++ {
+			for x := int32(0); x < grid.NumVoxelsX; x++ {
+				if loaded.GetMaterial(x, y, z) != grid.GetMaterial(x, y, z) {
+					t.Fatalf("Incorrect material: %d %d %d\n", x, y, z)
+				}
+			}
+		}
+	}
+
+	// loaded materials can still be edited
+	loaded.SetMaterial(7, 2, 3, 1)
+	if loaded.GetMaterial(7, 2, 3) != 1 || loaded.GetMaterial(6, 2, 3) != 2 || len(loaded.freePalettes) != 0 {
+		t.Fatalf("Incorrect material after edit\n")
+	}
+}
+
+func TestSaveLoadMipChain(t *testing.T) {
+	grid := NewVoxelGrid(32, 16, 32, 1)
+	grid.SetVoxel(5, 6, 7, true)
+	grid.SetVoxel(31, 15, 0, true)
+
+	for lowest := grid; lowest.NumVoxelsY > 2; {
+		lowest = lowest.Compress()
+	}
+
+	var buf bytes.Buffer
+	if err := grid.Save(&buf); err != nil {
+		t.Fatalf("Save failed: %v\n", err)
+	}
+
+	loaded, err := Load(&buf)
+	if err != nil {
+		t.Fatalf("Load failed: %v\n", err)
+	}
+
+	checkSameGrid(t, grid, loaded)
+
+	if loaded.materials.len() != 0 || loaded.Palette != nil {
+		t.Fatalf("Unexpected materials\n")
+	}
+
+	// edits still find their way down the loaded chain
+	loaded.SetVoxel(5, 6, 7, false)
+	if loaded.Child.GetVoxel(2, 3, 3) {
+		t.Fatalf("Loaded chain not updated\n")
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewVoxelGrid(4, 4, 4, 1).Save(&buf); err != nil {
+		t.Fatalf("Save failed: %v\n", err)
+	}
+	saved := buf.Bytes()
+
+	// wrong magic
+	bad := bytes.Clone(saved)
+	bad[0] = 'X'
+	if _, err := Load(bytes.NewReader(bad)); err == nil {
+		t.Fatalf("Expected magic error\n")
+	}
+
+	// unknown version
+	bad = bytes.Clone(saved)
+	bad[4] = 99
+	if _, err := Load(bytes.NewReader(bad)); err == nil {
+		t.Fatalf("Expected version error\n")
+	}
+
+	// truncated
+	if _, err := Load(bytes.NewReader(saved[:len(saved)-4])); err == nil {
+		t.Fatalf("Expected truncation error\n")
+	}
+
+	// sizes that would overflow, are too big or are bigger than the data
+	// that follows have to fail without allocating them
+	for _, size := range [][3]int32{{math.MaxInt32, math.MaxInt32, 2}, {4096, 4096, 4096}, {2048, 2048, 2048}} {
+		var buf bytes.Buffer
+		binary.Write(&buf, binary.LittleEndian, saveHeader{Magic: [4]byte{'V', 'O', 'X', 'G'}, Version: SAVE_VERSION, Levels: 1})
+		zw := zlib.NewWriter(&buf)
+		binary.Write(zw, binary.LittleEndian, saveLevel{size[0], size[1], size[2], 1})
+		zw.Write(make([]uint8, 1024))
+		zw.Close()
+
+		if _, err := Load(&buf); err == nil {
+			t.Fatalf("Expected size error: %v\n", size)
+		}
+	}
+
+	// voxel sizes that aren't usable
+	for _, size := range []float32{0, -1, float32(math.NaN()), float32(math.Inf(1))} {
+		var buf bytes.Buffer
+		if err := NewVoxelGrid(4, 4, 4, size).Save(&buf); err != nil {
+			t.Fatalf("Save failed: %v\n", err)
+		}
+		if _, err := Load(&buf); err == nil {
+			t.Fatalf("Expected voxel size error: %v\n", size)
+		}
+	}
+
+	// lower levels that aren't what Compress would have made from the level
+	// above them
+	for _, corrupt := range []func(child *VoxelGrid){
+		func(child *VoxelGrid) { child.VoxelSize = 3 },
+		func(child *VoxelGrid) { child.SetVoxel(3, 0, 1, true) },
+		func(child *VoxelGrid) { child.SetVoxel(1, 1, 2, false) },
+	} {
+		grid := NewVoxelGrid(8, 8, 8, 1)
+		grid.SetVoxel(2, 3, 4, true)
+		grid.Compress()
+		corrupt(grid.Child)
+
+		var buf bytes.Buffer
+		if err := grid.Save(&buf); err != nil {
+			t.Fatalf("Save failed: %v\n", err)
+		}
+		if _, err := Load(&buf); err == nil {
+			t.Fatalf("Expected level mismatch error\n")
+		}
+	}
+}
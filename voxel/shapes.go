@@ -0,0 +1,331 @@
+package voxel
+
+import (
+	"fmt"
+	"math"
+)
+
+// Shape is a volume in voxel coordinates, a voxel is inside the shape if its
+// center is
+type Shape interface {
+	Contains(p Vector3f) bool
+
+	// Distance returns how far p is from the surface, negative inside. it can
+	// be less than the real distance but never more, Fill uses it to find
+	// blocks of voxels that are all inside or all outside without testing
+	// each one
+	Distance(p Vector3f) float32
+
+	// Bounds returns the voxels the shape could cover, min inclusive and max
+	// exclusive
+	Bounds() (Vector3i, Vector3i)
+}
+
+type FillMode int
+
+const (
+	FILL_UNION     FillMode = iota // set the voxels inside the shape
+	FILL_SUBTRACT                  // clear the voxels inside the shape
+	FILL_INTERSECT                 // clear the voxels outside the shape
+)
+
+// Box covers voxels from Min up to but not including Max
+type Box struct {
+	Min Vector3f
+	Max Vector3f
+}
+
+func (box Box) Contains(p Vector3f) bool {
+	return p.X >= box.Min.X && p.Y >= box.Min.Y && p.Z >= box.Min.Z &&
+		p.X < box.Max.X && p.Y < box.Max.Y && p.Z < box.Max.Z
+}
+
+func (box Box) Distance(p Vector3f) float32 {
+	half := box.Max.Sub(box.Min).MulScalar(0.5)
+	q := p.Sub(box.Min.Plus(half)).Abs().Sub(half)
+	outside := q.Max(Vector3f{}).Length()
+	return outside + min(max(q.X, q.Y, q.Z), 0)
+}
+
+func (box Box) Bounds() (Vector3i, Vector3i) {
+	return shapeBounds(box.Min, box.Max)
+}
+
+type Sphere struct {
+	Center Vector3f
+	Radius float32
+}
+
+func (sphere Sphere) Contains(p Vector3f) bool {
+	d := p.Sub(sphere.Center)
+	return d.DotProduct(d) <= sphere.Radius*sphere.Radius
+}
+
+func (sphere Sphere) Distance(p Vector3f) float32 {
+	return p.Sub(sphere.Center).Length() - sphere.Radius
+}
+
+func (sphere Sphere) Bounds() (Vector3i, Vector3i) {
+	return shapeBounds(sphere.Center.SubScalar(sphere.Radius), sphere.Center.PlusScalar(sphere.Radius))
+}
+
+// Cylinder runs from Start to End with flat ends
+type Cylinder struct {
+	Start  Vector3f
+	End    Vector3f
+	Radius float32
+}
+
+func (cylinder Cylinder) Contains(p Vector3f) bool {
+	t, d2 := segmentDistance(cylinder.Start, cylinder.End, p)
+	return t >= 0 && t <= 1 && d2 <= cylinder.Radius*cylinder.Radius
+}
+
+func (cylinder Cylinder) Distance(p Vector3f) float32 {
+	t, d2 := segmentDistance(cylinder.Start, cylinder.End, p)
+	length := cylinder.End.Sub(cylinder.Start).Length()
+
+	// the distance to a rectangle across the axis and along it
+	dr := float32(math.Sqrt(float64(d2))) - cylinder.Radius
+	dh := max(-t, t-1) * length
+	if dr <= 0 && dh <= 0 {
+		return max(dr, dh)
+	}
+	return Vector3f{X: max(dr, 0), Y: max(dh, 0)}.Length()
+}
+
+func (cylinder Cylinder) Bounds() (Vector3i, Vector3i) {
+	return segmentBounds(cylinder.Start, cylinder.End, cylinder.Radius)
+}
+
+// Capsule runs from Start to End with rounded ends
+type Capsule struct {
+	Start  Vector3f
+	End    Vector3f
+	Radius float32
+}
+
+func (capsule Capsule) Contains(p Vector3f) bool {
+	t, _ := segmentDistance(capsule.Start, capsule.End, p)
+	closest := capsule.Start.Plus(capsule.End.Sub(capsule.Start).MulScalar(min(max(t, 0), 1)))
+	d := p.Sub(closest)
+	return d.DotProduct(d) <= capsule.Radius*capsule.Radius
+}
+
+func (capsule Capsule) Distance(p Vector3f) float32 {
+	t, _ := segmentDistance(capsule.Start, capsule.End, p)
+	closest := capsule.Start.Plus(capsule.End.Sub(capsule.Start).MulScalar(min(max(t, 0), 1)))
+	return p.Sub(closest).Length() - capsule.Radius
+}
+
+func (capsule Capsule) Bounds() (Vector3i, Vector3i) {
+	return segmentBounds(capsule.Start, capsule.End, capsule.Radius)
+}
+
+// Cone has a flat base of Radius narrowing to a point at Tip
+type Cone struct {
+	Base   Vector3f
+	Tip    Vector3f
+	Radius float32
+}
+
+func (cone Cone) Contains(p Vector3f) bool {
+	t, d2 := segmentDistance(cone.Base, cone.Tip, p)
+	r := cone.Radius * (1 - t)
+	return t >= 0 && t <= 1 && d2 <= r*r
+}
+
+func (cone Cone) Distance(p Vector3f) float32 {
+	t, d2 := segmentDistance(cone.Base, cone.Tip, p)
+	length := cone.Tip.Sub(cone.Base).Length()
+
+	// the furthest of the base, top and sloped side, which is never more than
+	// the real distance
+	r := float32(math.Sqrt(float64(d2)))
+	h := t * length
+	side := (r*length + h*cone.Radius - cone.Radius*length) / float32(math.Hypot(float64(length), float64(cone.Radius)))
+	return max(-h, h-length, side)
+}
+
+func (cone Cone) Bounds() (Vector3i, Vector3i) {
+	return segmentBounds(cone.Base, cone.Tip, cone.Radius)
+}
+
+func shapeBounds(min, max Vector3f) (Vector3i, Vector3i) {
+	floor := func(f float32) int32 { return int32(math.Floor(float64(f))) }
+	ceil := func(f float32) int32 { return int32(math.Ceil(float64(f))) }
+	return Vector3i{X: floor(min.X), Y: floor(min.Y), Z: floor(min.Z)},
+		Vector3i{X: ceil(max.X), Y: ceil(max.Y), Z: ceil(max.Z)}
+}
+
+func segmentBounds(a, b Vector3f, radius float32) (Vector3i, Vector3i) {
+	return shapeBounds(a.Min(b).SubScalar(radius), a.Max(b).PlusScalar(radius))
+}
+
+// segmentDistance returns how far along a to b the closest point to p is, as a
+// fraction of the length, and the squared distance from the line to p
+func segmentDistance(a, b, p Vector3f) (float32, float32) {
+	ab := b.Sub(a)
+	ap := p.Sub(a)
+
+	length2 := ab.DotProduct(ab)
+	if length2 == 0 {
+		return 0, ap.DotProduct(ap)
+	}
+
+	t := ap.DotProduct(ab) / length2
+	d := ap.Sub(ab.MulScalar(t))
+	return t, d.DotProduct(d)
+}
+
+// Fill sets, clears or intersects every voxel whose center is inside the shape
+// in one go. voxels that are set are given material m. bricks are written a
+// whole byte at a time and blocks of bricks that are completely inside or
+// outside the shape don't test their voxels at all
+func (grid *VoxelGrid) Fill(shape Shape, mode FillMode, m Material) {
+	if grid.readOnly {
+		fmt.Printf("Fill: Snapshots are read only\n")
+		return
+	}
+
+	boundsMin, boundsMax := shape.Bounds()
+	boundsMin = Vector3i{X: max(boundsMin.X, 0), Y: max(boundsMin.Y, 0), Z: max(boundsMin.Z, 0)}
+	boundsMax = Vector3i{X: min(boundsMax.X, grid.NumVoxelsX), Y: min(boundsMax.Y, grid.NumVoxelsY), Z: min(boundsMax.Z, grid.NumVoxelsZ)}
+
+	// intersecting also clears everything outside the shape's bounds
+	brickMin := Vector3i{X: boundsMin.X / 2, Y: boundsMin.Y / 2, Z: boundsMin.Z / 2}
+	brickMax := Vector3i{X: halfCount(boundsMax.X), Y: halfCount(boundsMax.Y), Z: halfCount(boundsMax.Z)}
+	if mode == FILL_INTERSECT {
+		brickMin = Vector3i{}
+		brickMax = Vector3i{X: halfCount(grid.NumVoxelsX), Y: halfCount(grid.NumVoxelsY), Z: halfCount(grid.NumVoxelsZ)}
+	}
+
+	if brickMin.X >= brickMax.X || brickMin.Y >= brickMax.Y || brickMin.Z >= brickMax.Z {
+		return
+	}
+
+	fill := shapeFill{grid: grid, shape: shape, mode: mode, material: m, boundsMin: boundsMin, boundsMax: boundsMax}
+	fill.block(brickMin, brickMax)
+}
+
+type shapeFill struct {
+	grid      *VoxelGrid
+	shape     Shape
+	mode      FillMode
+	material  Material
+	boundsMin Vector3i
+	boundsMax Vector3i
+}
+
+// block fills the bricks from min to max, splitting it in 8 until each part is
+// either all inside, all outside or a single brick
+func (fill *shapeFill) block(brickMin, brickMax Vector3i) {
+	grid := fill.grid
+	inside, outside := grid.blockDistance(fill.shape, brickMin, brickMax)
+
+	if outside && fill.mode != FILL_INTERSECT {
+		return
+	}
+
+	size := Vector3i{X: brickMax.X - brickMin.X, Y: brickMax.Y - brickMin.Y, Z: brickMax.Z - brickMin.Z}
+	if !inside && !outside && (size.X > 1 || size.Y > 1 || size.Z > 1) {
+		half := Vector3i{X: (size.X + 1) / 2, Y: (size.Y + 1) / 2, Z: (size.Z + 1) / 2}
+		for c := int32(0); c < 8; c++ {
+			childMin := Vector3i{X: brickMin.X + (c&1)*half.X, Y: brickMin.Y + (c>>2)*half.Y, Z: brickMin.Z + ((c>>1)&1)*half.Z}
+			childMax := Vector3i{X: min(childMin.X+half.X, brickMax.X), Y: min(childMin.Y+half.Y, brickMax.Y), Z: min(childMin.Z+half.Z, brickMax.Z)}
+			if childMin.X < childMax.X && childMin.Y < childMax.Y && childMin.Z < childMax.Z {
+				fill.block(childMin, childMax)
+			}
+		}
+		return
+	}
+
+	for y := brickMin.Y; y < brickMax.Y; y++ {
+		for z := brickMin.Z; z < brickMax.Z; z++ {
+			i := grid.VoxelIndex(brickMin.X*2, y*2, z*2)
+			for x := brickMin.X; x < brickMax.X; x++ {
+				var mask uint8
+				if inside {
+					mask = grid.brickMask(x, y, z)
+				} else if !outside {
+					mask = grid.brickInside(fill.shape, x, y, z, fill.boundsMin, fill.boundsMax)
+				}
+				grid.fillBrick(i, mask, fill.mode, fill.material)
+				i++
+			}
+		}
+	}
+}
+
+// blockDistance returns whether the voxels in the bricks from min to max are
+// all inside or all outside the shape. it can be neither if the surface is
+// nearby
+func (grid *VoxelGrid) blockDistance(shape Shape, brickMin, brickMax Vector3i) (bool, bool) {
+	first := voxelCenter(Vector3i{X: brickMin.X * 2, Y: brickMin.Y * 2, Z: brickMin.Z * 2})
+	last := voxelCenter(Vector3i{
+		X: min(brickMax.X*2, grid.NumVoxelsX) - 1,
+		Y: min(brickMax.Y*2, grid.NumVoxelsY) - 1,
+		Z: min(brickMax.Z*2, grid.NumVoxelsZ) - 1,
+	})
+
+	// every voxel center is within radius of the middle
+	radius := last.Sub(first).Length() / 2
+	d := shape.Distance(first.Plus(last).MulScalar(0.5))
+	return d < -radius, d > radius
+}
+
+// brickMask returns the voxels of brick x, y, z that are inside the grid,
+// only bricks on the far side of odd sized grids are partly outside
+func (grid *VoxelGrid) brickMask(x, y, z int32) uint8 {
+	mask := uint8(255)
+	if x*2+1 >= grid.NumVoxelsX {
+		mask &= 0b01010101
+	}
+	if z*2+1 >= grid.NumVoxelsZ {
+		mask &= 0b00110011
+	}
+	if y*2+1 >= grid.NumVoxelsY {
+		mask &= 0b00001111
+	}
+	return mask
+}
+
+// brickInside returns the voxels of brick x, y, z that are inside the shape
+func (grid *VoxelGrid) brickInside(shape Shape, x, y, z int32, boundsMin, boundsMax Vector3i) uint8 {
+	var mask uint8
+	for bit := int32(0); bit < 8; bit++ {
+		pos := Vector3i{X: x*2 + bit&1, Y: y*2 + bit>>2, Z: z*2 + (bit>>1)&1}
+		if pos.X < boundsMin.X || pos.Y < boundsMin.Y || pos.Z < boundsMin.Z ||
+			pos.X >= boundsMax.X || pos.Y >= boundsMax.Y || pos.Z >= boundsMax.Z {
+			continue
+		}
+		if shape.Contains(voxelCenter(pos)) {
+			mask |= uint8(1) << bit
+		}
+	}
+	return mask
+}
+
+func (grid *VoxelGrid) fillBrick(i int32, inside uint8, mode FillMode, m Material) {
+	curr := grid.voxels.get(i)
+
+	switch mode {
+	case FILL_UNION:
+		// voxels that are already set are repainted with the new material
+		if inside != 0 && (curr|inside != curr || m != 0 || grid.materials.len() != 0) {
+			grid.setBrick(i, curr|inside, inside, m)
+		}
+	case FILL_SUBTRACT:
+		if curr&^inside != curr {
+			grid.setBrick(i, curr&^inside, 0, 0)
+		}
+	case FILL_INTERSECT:
+		if curr&inside != curr {
+			grid.setBrick(i, curr&inside, 0, 0)
+		}
+	}
+}
+
+func voxelCenter(pos Vector3i) Vector3f {
+	return Vector3f{X: float32(pos.X) + 0.5, Y: float32(pos.Y) + 0.5, Z: float32(pos.Z) + 0.5}
+}
@@ -0,0 +1,112 @@
+package voxel
+
+import (
+	"math/rand"
+	"testing"
+)
+
+var testShapes = []Shape{
+	Box{Min: Vector3f{X: 2, Y: 1, Z: 3}, Max: Vector3f{X: 17, Y: 9.5, Z: 12}},
+	Sphere{Center: Vector3f{X: 10, Y: 8, Z: 9}, Radius: 7.5},
+	Cylinder{Start: Vector3f{X: 3, Y: 2, Z: 4}, End: Vector3f{X: 16, Y: 15, Z: 10}, Radius: 3},
+	Capsule{Start: Vector3f{X: -2, Y: 5, Z: 5}, End: Vector3f{X: 12, Y: 5, Z: 14}, Radius: 4},
+	Cone{Base: Vector3f{X: 9, Y: 0, Z: 9}, Tip: Vector3f{X: 9, Y: 16, Z: 9}, Radius: 8},
+}
+
+// fillOneByOne does what Fill should, a voxel at a time
+func fillOneByOne(grid *VoxelGrid, shape Shape, mode FillMode, m Material) {
+	for y := int32(0); y < grid.NumVoxelsY; y++ {
+		for z := int32(0); z < grid.NumVoxelsZ; z++ {
+			for x := int32(0); x < grid.NumVoxelsX; x++ {
+				inside := shape.Contains(voxelCenter(Vector3i{X: x, Y: y, Z: z}))
+				switch {
+				case mode == FILL_UNION && inside:
+					grid.SetMaterial(x, y, z, m)
+				case mode == FILL_SUBTRACT && inside, mode == FILL_INTERSECT && !inside:
+					grid.SetVoxel(x, y, z, false)
+				}
+			}
+		}
+	}
+}
+
+func randomGrid(nx, ny, nz int32, seed int64) *VoxelGrid {
+	r := rand.New(rand.NewSource(seed))
+	grid := NewVoxelGrid(nx, ny, nz, 1)
+	for i := 0; i < int(nx*ny*nz)/3; i++ {
+		grid.SetMaterial(r.Int31n(nx), r.Int31n(ny), r.Int31n(nz), Material(r.Intn(3)+1))
+	}
+	grid.Compress()
+	return grid
+}
+
+func TestFill(t *testing.T) {
+	for s, shape := range testShapes {
+		for _, mode := range []FillMode{FILL_UNION, FILL_SUBTRACT, FILL_INTERSECT} {
+			grid := randomGrid(19, 17, 15, int64(s))
+			expected := randomGrid(19, 17, 15, int64(s))
+
+			grid.Fill(shape, mode, 5)
+			fillOneByOne(expected, shape, mode, 5)
+
+			for y := int32(0); y < grid.NumVoxelsY; y++ {
+				for z := int32(0); z < grid.NumVoxelsZ; z++ {
+					for x := int32(0); x < grid.NumVoxelsX; x++ {
+						if grid.GetVoxel(x, y, z) != expected.GetVoxel(x, y, z) || grid.GetMaterial(x, y, z) != expected.GetMaterial(x, y, z) {
+							t.Fatalf("Shape %d mode %d differs at %d, %d, %d\n", s, mode, x, y, z)
+						}
+					}
+				}
+			}
+
+			// the mip level has to follow along too
+			for i := range grid.Child.voxels.len() {
+				if grid.Child.voxels.get(i) != expected.Child.voxels.get(i) {
+					t.Fatalf("Shape %d mode %d mip differs at %d\n", s, mode, i)
+				}
+			}
+		}
+	}
+}
+
+func TestFillWholeBricks(t *testing.T) {
+	grid := NewVoxelGrid(16, 16, 16, 1)
+	grid.Fill(Box{Max: Vector3f{X: 16, Y: 16, Z: 16}}, FILL_UNION, 0)
+
+	for i := range grid.voxels.len() {
+		if grid.voxels.get(i) != 255 {
+			t.Fatalf("Brick %d not full: %d\n", i, grid.voxels.get(i))
+		}
+	}
+
+	if grid.materials.len() != 0 {
+		t.Fatalf("Materials allocated without a material\n")
+	}
+
+	grid.Fill(Sphere{Center: Vector3f{X: 8, Y: 8, Z: 8}, Radius: 4}, FILL_SUBTRACT, 0)
+	if grid.GetVoxel(8, 8, 8) || !grid.GetVoxel(0, 0, 0) {
+		t.Fatalf("Subtract failed\n")
+	}
+}
+
+func BenchmarkFillSphere(b *testing.B) {
+	grid := NewVoxelGrid(256, 256, 256, 1)
+	sphere := Sphere{Center: Vector3f{X: 128, Y: 128, Z: 128}, Radius: 120}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		grid.Fill(sphere, FILL_UNION, 0)
+		grid.Fill(sphere, FILL_SUBTRACT, 0)
+	}
+}
+
+func BenchmarkFillSphereOneByOne(b *testing.B) {
+	grid := NewVoxelGrid(256, 256, 256, 1)
+	sphere := Sphere{Center: Vector3f{X: 128, Y: 128, Z: 128}, Radius: 120}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fillOneByOne(grid, sphere, FILL_UNION, 0)
+		fillOneByOne(grid, sphere, FILL_SUBTRACT, 0)
+	}
+}
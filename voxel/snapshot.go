@@ -0,0 +1,48 @@
+package voxel
+
+// Snapshot returns a read only copy of the grid and its lower res levels
+// which can be traced by other goroutines while the grid is edited. only the
+// page tables are copied, the snapshot shares the grid's pages and an edit to
+// a page while any snapshot is using it gives the grid a copy of just that
+// page, leaving the old one to the snapshots. Snapshots should be taken on
+// the goroutine that edits the grid and passed on from there
+func (grid *VoxelGrid) Snapshot() *VoxelGrid {
+	var snapshot, prev *VoxelGrid
+
+	for level := grid; level != nil; level = level.Child {
+		s := &VoxelGrid{
+			Parent:     prev,
+			NumVoxelsX: level.NumVoxelsX,
+			NumVoxelsY: level.NumVoxelsY,
+			NumVoxelsZ: level.NumVoxelsZ,
+			VoxelSize:  level.VoxelSize,
+			Palette:    level.Palette,
+			voxels:     level.voxels.share(),
+			materials:  level.materials.share(),
+			palettes:   level.palettes.share(),
+			readOnly:   true,
+		}
+
+		if prev == nil {
+			snapshot = s
+		} else {
+			prev.Child = s
+		}
+		prev = s
+	}
+
+	return snapshot
+}
+
+// Release tells the grid a snapshot is no longer in use, the snapshot must
+// not be used afterwards. pages that no snapshot is using any more can be
+// edited by the grid without being copied
+func (snapshot *VoxelGrid) Release() {
+	for level := snapshot; level != nil; level = level.Child {
+		if level.readOnly {
+			level.voxels.release()
+			level.materials.release()
+			level.palettes.release()
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package voxel
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	grid := NewVoxelGrid(8, 8, 8, 1)
+	grid.SetMaterial(1, 1, 1, 3)
+	grid.Compress()
+
+	snapshot := grid.Snapshot()
+
+	// the first edit gives the grid its own page and later ones use it
+	grid.SetVoxel(1, 1, 1, false)
+	page := grid.voxels.table[0]
+	if page == snapshot.voxels.table[0] {
+		t.Fatalf("Page not copied on write\n")
+	}
+	grid.SetMaterial(6, 6, 6, 5)
+	if page != grid.voxels.table[0] {
+		t.Fatalf("Page copied more than once\n")
+	}
+
+	// the snapshot keeps what was there when it was taken
+	if !snapshot.GetVoxel(1, 1, 1) || snapshot.GetMaterial(1, 1, 1) != 3 || snapshot.GetVoxel(6, 6, 6) {
+		t.Fatalf("Snapshot changed by edits\n")
+	}
+	if !snapshot.Child.GetVoxel(0, 0, 0) || snapshot.Child.GetVoxel(3, 3, 3) {
+		t.Fatalf("Snapshot mip changed by edits\n")
+	}
+
+	// while the grid sees its edits straight away
+	if grid.GetVoxel(1, 1, 1) || grid.GetMaterial(6, 6, 6) != 5 {
+		t.Fatalf("Edits not visible in grid\n")
+	}
+	if grid.Child.GetVoxel(0, 0, 0) || !grid.Child.GetVoxel(3, 3, 3) {
+		t.Fatalf("Edits not visible in grid mip\n")
+	}
+
+	// a second snapshot includes the edits made so far
+	second := grid.Snapshot()
+	grid.SetVoxel(0, 7, 0, true)
+	snapshot.Release()
+
+	if second.GetVoxel(1, 1, 1) || second.GetMaterial(6, 6, 6) != 5 || second.GetVoxel(0, 7, 0) {
+		t.Fatalf("Second snapshot incorrect\n")
+	}
+
+	// snapshots can't be edited
+	second.SetVoxel(2, 2, 2, true)
+	if second.GetVoxel(2, 2, 2) || grid.GetVoxel(2, 2, 2) {
+		t.Fatalf("Snapshot was edited\n")
+	}
+
+	second.Release()
+
+	// nothing needs copying for a snapshot released before the next edit
+	page = grid.voxels.table[0]
+	grid.Snapshot().Release()
+	grid.SetVoxel(4, 4, 4, true)
+	if page != grid.voxels.table[0] {
+		t.Fatalf("Page copied after release\n")
+	}
+	if grid.GetVoxel(1, 1, 1) || grid.GetMaterial(6, 6, 6) != 5 || !grid.GetVoxel(0, 7, 0) || !grid.GetVoxel(4, 4, 4) {
+		t.Fatalf("Grid incorrect\n")
+	}
+}
+
+// an edit only copies the pages it writes to, however big the grid is
+func TestSnapshotPages(t *testing.T) {
+	grid := NewVoxelGrid(64, 64, 64, 1)
+	grid.SetMaterial(0, 0, 0, 1)
+	grid.Compress()
+
+	numPages := len(grid.voxels.table)
+	if numPages < 8 {
+		t.Fatalf("Too few pages to test: %d\n", numPages)
+	}
+
+	copied := func(before, after pages[uint8]) int {
+		n := 0
+		for i := range before.table {
+			if before.table[i] != after.table[i] {
+				n++
+			}
+		}
+		return n
+	}
+
+	first := grid.Snapshot()
+	grid.SetMaterial(63, 63, 63, 2)
+	if n := copied(first.voxels, grid.voxels); n != 1 {
+		t.Fatalf("Incorrect number of pages copied: %d of %d\n", n, numPages)
+	}
+	if n := copied(first.Child.voxels, grid.Child.voxels); n != 1 {
+		t.Fatalf("Incorrect number of mip pages copied: %d\n", n)
+	}
+	if len(first.materials.table) != len(grid.materials.table) || first.materials.table[0] != grid.materials.table[0] {
+		t.Fatalf("Untouched material page copied\n")
+	}
+
+	// a page written since the first snapshot isn't copied again for it,
+	// only for snapshots still using the page
+	second := grid.Snapshot()
+	second.Release()
+	page := grid.voxels.table[numPages-1]
+	grid.SetVoxel(62, 63, 63, true)
+	if page != grid.voxels.table[numPages-1] {
+		t.Fatalf("Page copied for a released snapshot\n")
+	}
+
+	if first.GetVoxel(63, 63, 63) || first.GetVoxel(62, 63, 63) || first.GetMaterial(0, 0, 0) != 1 {
+		t.Fatalf("Snapshot changed by edits\n")
+	}
+	first.Release()
+}
+
+func TestSnapshotSave(t *testing.T) {
+	grid := NewVoxelGrid(6, 6, 6, 1)
+	grid.Compress()
+
+	snapshot := grid.Snapshot()
+	defer snapshot.Release()
+
+	grid.SetMaterial(2, 3, 4, 9)
+
+	var buf bytes.Buffer
+	if err := grid.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.GetMaterial(2, 3, 4) != 9 || !loaded.Child.GetVoxel(1, 1, 2) {
+		t.Fatalf("Edits not saved\n")
+	}
+
+	// saving must not disturb the snapshot
+	if snapshot.GetVoxel(2, 3, 4) {
+		t.Fatalf("Snapshot changed by save\n")
+	}
+}
@@ -0,0 +1,147 @@
+package voxel
+
+type StampMode int
+
+const (
+	STAMP_OVERWRITE  StampMode = iota // set the source's voxels, replacing their materials
+	STAMP_ONLY_EMPTY                  // only set the source's voxels where the grid is empty
+	STAMP_SUBTRACT                    // clear the voxels the source has set
+)
+
+// StampOptions say where and how a source is stamped into a grid. the source
+// is mirrored first, then turned a quarter turn at a time about x, y and z in
+// that order. the corner of the result closest to the origin ends up at
+// Offset, so turning a source never moves it out of place
+type StampOptions struct {
+	Offset  Vector3i
+	RotateX int32 // quarter turns, positive is anticlockwise looking down the axis
+	RotateY int32
+	RotateZ int32
+	MirrorX bool
+	MirrorY bool
+	MirrorZ bool
+	Mode    StampMode
+}
+
+// Stamp copies the set voxels of source into the grid, anything that lands
+// outside the grid is dropped
+func (grid *VoxelGrid) Stamp(source Voxels, options StampOptions) {
+	grid.stamp(source.Count(), options, func(x, y, z int32) (bool, Material) {
+		return source.Get(x, y, z), 0
+	})
+}
+
+// StampGrid copies the set voxels of source into the grid along with their
+// materials. materials are copied as they are so both grids should use the
+// same Palette
+func (grid *VoxelGrid) StampGrid(source *VoxelGrid, options StampOptions) {
+	grid.stamp(source.Count(), options, func(x, y, z int32) (bool, Material) {
+		if !source.GetVoxel(x, y, z) {
+			return false, 0
+		}
+		return true, source.GetMaterial(x, y, z)
+	})
+}
+
+func (grid *VoxelGrid) stamp(count Vector3i, options StampOptions, get func(x, y, z int32) (bool, Material)) {
+	transform := options.transform()
+
+	// move the transformed source back so its lowest corner is at the offset
+	corner := transform.apply(Vector3i{X: count.X - 1, Y: count.Y - 1, Z: count.Z - 1})
+	origin := transform.apply(Vector3i{})
+	shift := Vector3i{
+		X: options.Offset.X - min(corner.X, origin.X),
+		Y: options.Offset.Y - min(corner.Y, origin.Y),
+		Z: options.Offset.Z - min(corner.Z, origin.Z),
+	}
+
+	for y := int32(0); y < count.Y; y++ {
+		for z := int32(0); z < count.Z; z++ {
+			for x := int32(0); x < count.X; x++ {
+				set, m := get(x, y, z)
+				if !set {
+					continue
+				}
+
+				pos := transform.apply(Vector3i{X: x, Y: y, Z: z})
+				pos = Vector3i{X: pos.X + shift.X, Y: pos.Y + shift.Y, Z: pos.Z + shift.Z}
+				if !grid.Contains(pos.X, pos.Y, pos.Z) {
+					continue
+				}
+
+				switch options.Mode {
+				case STAMP_ONLY_EMPTY:
+					if grid.GetVoxel(pos.X, pos.Y, pos.Z) {
+						continue
+					}
+					fallthrough
+				case STAMP_OVERWRITE:
+					if m != 0 {
+						grid.SetMaterial(pos.X, pos.Y, pos.Z, m)
+					} else {
+						grid.SetVoxel(pos.X, pos.Y, pos.Z, true)
+					}
+				case STAMP_SUBTRACT:
+					grid.SetVoxel(pos.X, pos.Y, pos.Z, false)
+				}
+			}
+		}
+	}
+}
+
+// stampTransform is a 3x3 matrix made of quarter turns and mirrors, so every
+// entry is -1, 0 or 1
+type stampTransform [3][3]int32
+
+func identityTransform() stampTransform {
+	return stampTransform{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+}
+
+func (options StampOptions) transform() stampTransform {
+	t := identityTransform()
+
+	mirror := func(axis int, on bool) {
+		if on {
+			m := identityTransform()
+			m[axis][axis] = -1
+			t = m.mul(t)
+		}
+	}
+	mirror(0, options.MirrorX)
+	mirror(1, options.MirrorY)
+	mirror(2, options.MirrorZ)
+
+	// a quarter turn about each axis
+	turns := [3]stampTransform{
+		{{1, 0, 0}, {0, 0, -1}, {0, 1, 0}},
+		{{0, 0, 1}, {0, 1, 0}, {-1, 0, 0}},
+		{{0, -1, 0}, {1, 0, 0}, {0, 0, 1}},
+	}
+	for axis, n := range [3]int32{options.RotateX, options.RotateY, options.RotateZ} {
+		for i := int32(0); i < (n%4+4)%4; i++ {
+			t = turns[axis].mul(t)
+		}
+	}
+
+	return t
+}
+
+func (a stampTransform) mul(b stampTransform) stampTransform {
+	var c stampTransform
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				c[i][j] += a[i][k] * b[k][j]
+			}
+		}
+	}
+	return c
+}
+
+func (t stampTransform) apply(v Vector3i) Vector3i {
+	return Vector3i{
+		X: t[0][0]*v.X + t[0][1]*v.Y + t[0][2]*v.Z,
+		Y: t[1][0]*v.X + t[1][1]*v.Y + t[1][2]*v.Z,
+		Z: t[2][0]*v.X + t[2][1]*v.Y + t[2][2]*v.Z,
+	}
+}
@@ -0,0 +1,108 @@
+package voxel
+
+import (
+	"testing"
+)
+
+// an L shape with a different material on each arm so mistakes show up
+func stampSource() *VoxelGrid {
+	source := NewVoxelGrid(3, 2, 4, 1)
+	source.SetMaterial(0, 0, 0, 1)
+	source.SetMaterial(1, 0, 0, 2)
+	source.SetMaterial(2, 0, 0, 2)
+	source.SetMaterial(0, 1, 0, 3)
+	source.SetMaterial(0, 0, 3, 4)
+	return source
+}
+
+func TestStamp(t *testing.T) {
+	grid := NewVoxelGrid(10, 10, 10, 1)
+	grid.StampGrid(stampSource(), StampOptions{Offset: Vector3i{X: 2, Y: 3, Z: 4}})
+
+	expected := map[Vector3i]Material{
+		{X: 2, Y: 3, Z: 4}: 1,
+		{X: 3, Y: 3, Z: 4}: 2,
+		{X: 4, Y: 3, Z: 4}: 2,
+		{X: 2, Y: 4, Z: 4}: 3,
+		{X: 2, Y: 3, Z: 7}: 4,
+	}
+	checkStamp(t, grid, expected)
+}
+
+func TestStampTransform(t *testing.T) {
+	// swapping y and z, as .vox files need, is a mirror then a turn about x
+	grid := NewVoxelGrid(10, 10, 10, 1)
+	grid.StampGrid(stampSource(), StampOptions{MirrorZ: true, RotateX: 1})
+
+	checkStamp(t, grid, map[Vector3i]Material{
+		{X: 0, Y: 0, Z: 0}: 1,
+		{X: 1, Y: 0, Z: 0}: 2,
+		{X: 2, Y: 0, Z: 0}: 2,
+		{X: 0, Y: 0, Z: 1}: 3,
+		{X: 0, Y: 3, Z: 0}: 4,
+	})
+
+	// a quarter turn about y takes x to -z, the result is shifted back to 0
+	grid = NewVoxelGrid(10, 10, 10, 1)
+	grid.StampGrid(stampSource(), StampOptions{RotateY: 1})
+
+	checkStamp(t, grid, map[Vector3i]Material{
+		{X: 0, Y: 0, Z: 2}: 1,
+		{X: 0, Y: 0, Z: 1}: 2,
+		{X: 0, Y: 0, Z: 0}: 2,
+		{X: 0, Y: 1, Z: 2}: 3,
+		{X: 3, Y: 0, Z: 2}: 4,
+	})
+
+	// four turns and two mirrors end up back where they started
+	grid = NewVoxelGrid(10, 10, 10, 1)
+	grid.StampGrid(stampSource(), StampOptions{RotateZ: 4, MirrorX: true, RotateY: 2, MirrorZ: true})
+
+	checkStamp(t, grid, map[Vector3i]Material{
+		{X: 0, Y: 0, Z: 0}: 1,
+		{X: 1, Y: 0, Z: 0}: 2,
+		{X: 2, Y: 0, Z: 0}: 2,
+		{X: 0, Y: 1, Z: 0}: 3,
+		{X: 0, Y: 0, Z: 3}: 4,
+	})
+}
+
+func TestStampModes(t *testing.T) {
+	grid := NewVoxelGrid(4, 4, 4, 1)
+	grid.SetMaterial(1, 0, 0, 9)
+	grid.StampGrid(stampSource(), StampOptions{Mode: STAMP_ONLY_EMPTY})
+
+	if grid.GetMaterial(1, 0, 0) != 9 || grid.GetMaterial(2, 0, 0) != 2 {
+		t.Fatalf("Only empty replaced a voxel\n")
+	}
+
+	grid.StampGrid(stampSource(), StampOptions{})
+	if grid.GetMaterial(1, 0, 0) != 2 {
+		t.Fatalf("Overwrite did not replace a voxel\n")
+	}
+
+	// sources without materials work too and anything outside is dropped
+	var source Voxels = NewTestVoxels(2, 2, 2, 1)
+	source.Set(0, 0, 0, true)
+	source.Set(1, 1, 1, true)
+	grid.Stamp(source, StampOptions{Offset: Vector3i{X: 2, Y: 0, Z: 0}, Mode: STAMP_SUBTRACT})
+	grid.Stamp(source, StampOptions{Offset: Vector3i{X: 3, Y: 3, Z: 3}})
+
+	if grid.GetVoxel(2, 0, 0) || !grid.GetVoxel(1, 0, 0) || !grid.GetVoxel(3, 3, 3) {
+		t.Fatalf("Incorrect stamp\n")
+	}
+}
+
+func checkStamp(t *testing.T, grid *VoxelGrid, expected map[Vector3i]Material) {
+	t.Helper()
+	for y := int32(0); y < grid.NumVoxelsY; y++ {
+		for z := int32(0); z < grid.NumVoxelsZ; z++ {
+			for x := int32(0); x < grid.NumVoxelsX; x++ {
+				m, ok := expected[Vector3i{X: x, Y: y, Z: z}]
+				if grid.GetVoxel(x, y, z) != ok || grid.GetMaterial(x, y, z) != m {
+					t.Fatalf("Incorrect voxel at %d, %d, %d: %t %d\n", x, y, z, grid.GetVoxel(x, y, z), grid.GetMaterial(x, y, z))
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package voxel
+
+import (
+	"math"
+	"runtime"
+	"slices"
+	"sync"
+)
+
+// ChunkFn fills a new chunk of a StreamingWorld, generating it or loading it
+// from somewhere. origin is the chunk's minimum corner in world voxels. it is
+// called on background goroutines so it shouldn't touch anything shared
+// without locking
+type ChunkFn func(chunk *VoxelGrid, origin Vector3i)
+
+// StreamingWorld is an endless world made of chunks that are filled in around
+// a position, normally the camera, as it moves. each chunk is a column
+// ChunkSize voxels square going from 0 up to Height. chunks are made on
+// background goroutines and the ones furthest from being used are dropped
+// once there are more than MaxChunks, so memory stays bounded however far
+// you go.
+//
+// like VoxelGrid any number of goroutines can read the world at once, but
+// Update changes which chunks are loaded so it must be called while nothing
+// is reading, normally between frames
+type StreamingWorld struct {
+	ChunkSize int32
+	Height    int32
+	VoxelSize float32
+
+	// chunks are loaded within Radius chunks of the position given to Update
+	Radius int32
+
+	// the most chunks kept, chunks within Radius are never dropped
+	MaxChunks int
+
+	// rays stop where they reach a chunk that isn't loaded yet, reporting it
+	// so it can be drawn as fog, otherwise they carry on through it as if it
+	// were empty
+	Fog bool
+
+	fill    ChunkFn
+	chunks  map[Vector3i]*streamingChunk
+	pending map[Vector3i]uint64 // when each chunk being made was asked for
+	offsets []Vector3i          // the chunks within Radius, nearest first
+	frame   uint64
+
+	requests chan Vector3i
+	done     chan *streamingChunk
+	quit     chan struct{}
+	workers  sync.WaitGroup
+}
+
+type streamingChunk struct {
+	key    Vector3i
+	grid   *VoxelGrid // full res
+	lowest *VoxelGrid // lowest res, where rays start
+	used   uint64     // the last Update that wanted this chunk
+}
+
+// NewStreamingWorld starts a goroutine per cpu to fill chunks with fill
+func NewStreamingWorld(chunkSize, height int32, voxelSize float32, radius int32, fill ChunkFn) *StreamingWorld {
+	world := &StreamingWorld{
+		ChunkSize: chunkSize,
+		Height:    height,
+		VoxelSize: voxelSize,
+		Radius:    radius,
+		fill:      fill,
+		chunks:    map[Vector3i]*streamingChunk{},
+		pending:   map[Vector3i]uint64{},
+		quit:      make(chan struct{}),
+	}
+
+	for dz := -radius; dz <= radius; dz++ {
+		for dx := -radius; dx <= radius; dx++ {
+			if dx*dx+dz*dz <= radius*radius {
+				world.offsets = append(world.offsets, Vector3i{X: dx, Z: dz})
+			}
+		}
+	}
+	slices.SortStableFunc(world.offsets, func(a, b Vector3i) int {
+		return int(a.X*a.X+a.Z*a.Z) - int(b.X*b.X+b.Z*b.Z)
+	})
+
+	// leave room to turn around without everything having to be made again
+	world.MaxChunks = 2 * len(world.offsets)
+
+	numWorkers := runtime.NumCPU()
+	world.requests = make(chan Vector3i, numWorkers)
+	world.done = make(chan *streamingChunk, numWorkers)
+
+	world.workers.Add(numWorkers)
+	for i := 0; i < numWorkers; i++ {
+		go world.worker()
+	}
+
+	return world
+}
+
+func (world *StreamingWorld) worker() {
+	defer world.workers.Done()
+
+	for {
+		var key Vector3i
+		select {
+		case key = <-world.requests:
+		case <-world.quit:
+			return
+		}
+
+		chunk := &streamingChunk{key: key, grid: NewVoxelGrid(world.ChunkSize, world.Height, world.ChunkSize, world.VoxelSize)}
+		world.fill(chunk.grid, world.chunkOrigin(key))
+
+		chunk.lowest = chunk.grid
+		for chunk.lowest.NumVoxelsY > 2 {
+			chunk.lowest = chunk.lowest.Compress()
+		}
+
+		select {
+		case world.done <- chunk:
+		case <-world.quit:
+			return
+		}
+	}
+}
+
+// Close stops the background goroutines, chunks being made are thrown away
+func (world *StreamingWorld) Close() {
+	close(world.quit)
+	world.workers.Wait()
+}
+
+func (world *StreamingWorld) chunkOrigin(key Vector3i) Vector3i {
+	return Vector3i{X: key.X * world.ChunkSize, Z: key.Z * world.ChunkSize}
+}
+
+// ChunkKey returns the chunk holding voxel x, z
+func (world *StreamingWorld) ChunkKey(x, z int32) Vector3i {
+	return Vector3i{X: floorDiv(x, world.ChunkSize), Z: floorDiv(z, world.ChunkSize)}
+}
+
+// Update takes the chunks that have been made since the last call, asks for
+// the ones within Radius of pos that are missing, nearest first, and drops
+// the least recently wanted chunks if there are too many
+func (world *StreamingWorld) Update(pos Vector3f) {
+	world.frame++
+
+	for collecting := true; collecting; {
+		select {
+		case chunk := <-world.done:
+			chunk.used = world.pending[chunk.key]
+			delete(world.pending, chunk.key)
+			world.chunks[chunk.key] = chunk
+		default:
+			collecting = false
+		}
+	}
+
+	voxelPos := pos.DivScalar(world.VoxelSize).Floor().ToVector3i()
+	center := world.ChunkKey(voxelPos.X, voxelPos.Z)
+
+	requesting := true
+	for _, offset := range world.offsets {
+		key := Vector3i{X: center.X + offset.X, Z: center.Z + offset.Z}
+		if chunk := world.chunks[key]; chunk != nil {
+			chunk.used = world.frame
+			continue
+		}
+
+		if _, ok := world.pending[key]; !requesting || ok {
+			continue
+		}
+
+		// the workers are busy, try again next time
+		select {
+		case world.requests <- key:
+			world.pending[key] = world.frame
+		default:
+			requesting = false
+		}
+	}
+
+	world.evict()
+}
+
+func (world *StreamingWorld) evict() {
+	if len(world.chunks) <= world.MaxChunks {
+		return
+	}
+
+	chunks := make([]*streamingChunk, 0, len(world.chunks))
+	for _, chunk := range world.chunks {
+		if chunk.used != world.frame {
+			chunks = append(chunks, chunk)
+		}
+	}
+	slices.SortFunc(chunks, func(a, b *streamingChunk) int {
+		if a.used < b.used {
+			return -1
+		} else if a.used > b.used {
+			return 1
+		}
+		return 0
+	})
+
+	for _, chunk := range chunks[:min(len(chunks), len(world.chunks)-world.MaxChunks)] {
+		delete(world.chunks, chunk.key)
+	}
+}
+
+// NumChunks returns how many chunks are loaded
+func (world *StreamingWorld) NumChunks() int {
+	return len(world.chunks)
+}
+
+// Loading returns how many chunks have been asked for and not yet taken by
+// Update
+func (world *StreamingWorld) Loading() int {
+	return len(world.pending)
+}
+
+// Chunk returns the full res grid for the chunk with key, or nil if it isn't
+// loaded. its voxels are relative to the chunk's origin
+func (world *StreamingWorld) Chunk(key Vector3i) *VoxelGrid {
+	if chunk := world.chunks[key]; chunk != nil {
+		return chunk.grid
+	}
+	return nil
+}
+
+// IsLoaded reports whether the chunk holding voxel x, z is loaded
+func (world *StreamingWorld) IsLoaded(x, z int32) bool {
+	return world.chunks[world.ChunkKey(x, z)] != nil
+}
+
+// GetVoxel returns the voxel at x, y, z in world voxels, anything that isn't
+// loaded is empty
+func (world *StreamingWorld) GetVoxel(x, y, z int32) bool {
+	chunk := world.chunks[world.ChunkKey(x, z)]
+	if chunk == nil {
+		return false
+	}
+	origin := world.chunkOrigin(chunk.key)
+	return chunk.grid.GetVoxel(x-origin.X, y, z-origin.Z)
+}
+
+// GetMaterial returns the material at x, y, z in world voxels
+func (world *StreamingWorld) GetMaterial(x, y, z int32) Material {
+	chunk := world.chunks[world.ChunkKey(x, z)]
+	if chunk == nil {
+		return 0
+	}
+	origin := world.chunkOrigin(chunk.key)
+	return chunk.grid.GetMaterial(x-origin.X, y, z-origin.Z)
+}
+
+// Raycast returns the same as VoxelGrid.RaycastRecursive with voxel positions
+// in world voxels. it steps from chunk to chunk and runs the recursive DDA in
+// each loaded one. rays give up Radius+1 chunks from where they started, or
+// with Fog set at the first chunk that isn't loaded, in which case the Status
+// is RAYCAST_UNLOADED and HitPos is where the ray reached it
+func (world *StreamingWorld) Raycast(rayPos Vector3f, rayDir Vector3f) RaycastHit {
+	chunkWidth := float32(world.ChunkSize) * world.VoxelSize
+	inf := float32(math.Inf(1))
+
+	// only the part of the ray between the bottom and top of the world can hit
+	tMin, tMax := float32(0), inf
+	top := float32(world.Height) * world.VoxelSize
+	if rayDir.Y != 0 {
+		t0, t1 := -rayPos.Y/rayDir.Y, (top-rayPos.Y)/rayDir.Y
+		tMin, tMax = max(tMin, min(t0, t1)), max(t0, t1)
+	} else if rayPos.Y < 0 || rayPos.Y >= top {
+		tMin = inf
+	}
+
+	if tMin >= tMax {
+		return RaycastHit{Status: RAYCAST_MISS, HitPos: rayPos, MapPos: rayPos.DivScalar(world.VoxelSize).Floor().ToVector3i()}
+	}
+
+	// walk the chunks the ray crosses in x and z
+	start := rayPos.Plus(rayDir.MulScalar(tMin))
+	key := Vector3i{X: int32(math.Floor(float64(start.X / chunkWidth))), Z: int32(math.Floor(float64(start.Z / chunkWidth)))}
+	first := key
+
+	// ray distance to the next chunk boundary in x and z and between them
+	next := func(pos, dir float32, cell int32) (float32, float32) {
+		if dir > 0 {
+			return (float32(cell+1)*chunkWidth - pos) / dir, chunkWidth / dir
+		} else if dir < 0 {
+			return (float32(cell)*chunkWidth - pos) / dir, -chunkWidth / dir
+		}
+		return inf, inf
+	}
+	nextX, deltaX := next(rayPos.X, rayDir.X, key.X)
+	nextZ, deltaZ := next(rayPos.Z, rayDir.Z, key.Z)
+	step := rayDir.Sign().ToVector3i()
+
+	t := tMin
+	numSteps := int32(0)
+	for t < tMax && max(abs(key.X-first.X), abs(key.Z-first.Z)) <= world.Radius+1 {
+		entry := rayPos.Plus(rayDir.MulScalar(t))
+		chunk := world.chunks[key]
+		if chunk == nil && world.Fog {
+			return RaycastHit{Status: RAYCAST_UNLOADED, T: t, HitPos: entry, MapPos: entry.DivScalar(world.VoxelSize).Floor().ToVector3i(), NumSteps: numSteps}
+		}
+
+		if chunk != nil {
+			origin := world.chunkOrigin(key)
+			offset := origin.ToVector3f().MulScalar(world.VoxelSize)
+			hit := chunk.lowest.RaycastRecursive(entry.Sub(offset), rayDir)
+			numSteps += hit.NumSteps
+			if hit.Hit() {
+				hit.T += t
+				hit.HitPos = hit.HitPos.Plus(offset)
+				hit.MapPos.X, hit.MapPos.Z = hit.MapPos.X+origin.X, hit.MapPos.Z+origin.Z
+				hit.NumSteps = numSteps
+				return hit
+			}
+		}
+
+		if nextX < nextZ {
+			t = nextX
+			nextX += deltaX
+			key.X += step.X
+		} else {
+			t = nextZ
+			nextZ += deltaZ
+			key.Z += step.Z
+		}
+	}
+
+	t = min(t, tMax)
+	hitPos := rayPos.Plus(rayDir.MulScalar(t))
+	return RaycastHit{Status: RAYCAST_OUT_OF_BOUNDS, T: t, HitPos: hitPos, MapPos: hitPos.DivScalar(world.VoxelSize).Floor().ToVector3i(), NumSteps: numSteps}
+}
+
+func abs(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
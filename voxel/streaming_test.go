@@ -0,0 +1,174 @@
+package voxel
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// streamingSolid is a bumpy floor with the odd pillar, the same everywhere
+// so chunks can be checked against one big grid
+func streamingSolid(x, y, z int32) bool {
+	h := uint32(x)*73856093 ^ uint32(z)*19349663
+	if h%23 == 0 {
+		return y < 20
+	}
+	return y < 4+int32(h%5)
+}
+
+func fillStreaming(chunk *VoxelGrid, origin Vector3i) {
+	for y := int32(0); y < chunk.NumVoxelsY; y++ {
+		for z := int32(0); z < chunk.NumVoxelsZ; z++ {
+			for x := int32(0); x < chunk.NumVoxelsX; x++ {
+				if streamingSolid(origin.X+x, y, origin.Z+z) {
+					chunk.SetMaterial(x, y, z, Material(1+(origin.X+x)%3))
+				}
+			}
+		}
+	}
+}
+
+// waitForChunks updates the world until everything around pos is loaded
+func waitForChunks(t *testing.T, world *StreamingWorld, pos Vector3f) {
+	deadline := time.Now().Add(10 * time.Second)
+	for world.Update(pos); world.Loading() > 0; world.Update(pos) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Chunks didn't load: %d\n", world.Loading())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	world.Update(pos)
+}
+
+func TestStreamingLoad(t *testing.T) {
+	world := NewStreamingWorld(16, 32, 1, 2, fillStreaming)
+	defer world.Close()
+
+	pos := Vector3f{X: 56, Y: 24, Z: -40}
+	waitForChunks(t, world, pos)
+
+	// every chunk within the radius, in a circle around the camera chunk
+	if world.NumChunks() != 13 {
+		t.Fatalf("Incorrect number of chunks: %d\n", world.NumChunks())
+	}
+	for _, key := range []Vector3i{{X: 3, Z: -3}, {X: 1, Z: -3}, {X: 3, Z: -1}, {X: 4, Z: -2}} {
+		if world.Chunk(key) == nil {
+			t.Fatalf("Missing chunk: %v\n", key)
+		}
+	}
+	if world.Chunk(Vector3i{X: 1, Z: -1}) != nil {
+		t.Fatalf("Unexpected chunk\n")
+	}
+
+	for z := int32(-80); z < 0; z++ {
+		for x := int32(16); x < 96; x++ {
+			for y := int32(0); y < 32; y++ {
+				expected := world.IsLoaded(x, z) && streamingSolid(x, y, z)
+				if world.GetVoxel(x, y, z) != expected {
+					t.Fatalf("Incorrect voxel %d %d %d\n", x, y, z)
+				}
+				if expected && world.GetMaterial(x, y, z) != Material(1+x%3) {
+					t.Fatalf("Incorrect material %d %d %d\n", x, y, z)
+				}
+			}
+		}
+	}
+}
+
+func TestStreamingRaycast(t *testing.T) {
+	world := NewStreamingWorld(16, 32, 1, 2, fillStreaming)
+	defer world.Close()
+
+	pos := Vector3f{X: 56.5, Y: 24.5, Z: 56.5}
+	waitForChunks(t, world, pos)
+
+	// one grid holding the same voxels as the loaded chunks
+	origin := Vector3i{X: 16, Z: 16}
+	grid := NewVoxelGrid(80, 32, 80, 1)
+	for z := int32(0); z < grid.NumVoxelsZ; z++ {
+		for x := int32(0); x < grid.NumVoxelsX; x++ {
+			for y := int32(0); y < grid.NumVoxelsY; y++ {
+				if world.GetVoxel(x+origin.X, y, z+origin.Z) {
+					grid.SetVoxel(x, y, z, true)
+				}
+			}
+		}
+	}
+	lowest := grid
+	for lowest.NumVoxelsY > 2 {
+		lowest = lowest.Compress()
+	}
+
+	r := rand.New(rand.NewSource(1))
+	hits := 0
+	for i := 0; i < 2000; i++ {
+		rayDir := Vector3f{X: r.Float32()*2 - 1, Y: r.Float32()*2 - 1, Z: r.Float32()*2 - 1}.Normalize()
+
+		hit := world.Raycast(pos, rayDir)
+		expected := lowest.RaycastRecursive(pos.Sub(origin.ToVector3f()), rayDir)
+		expected.MapPos.X, expected.MapPos.Z = expected.MapPos.X+origin.X, expected.MapPos.Z+origin.Z
+
+		if hit.Status == RAYCAST_UNLOADED || hit.Hit() != expected.Hit() || (hit.Hit() && (hit.Face != expected.Face || !hit.MapPos.Equals(expected.MapPos))) {
+			t.Fatalf("Incorrect hit %v: %+v, expected %+v\n", rayDir, hit, expected)
+		}
+		if hit.Hit() {
+			hits++
+		}
+	}
+	if hits < 500 {
+		t.Fatalf("Too few hits: %d\n", hits)
+	}
+
+	// from above the world, looking down into it
+	hit := world.Raycast(Vector3f{X: 60.5, Y: 100, Z: 60.5}, Vector3f{Y: -1})
+	mapPos := hit.MapPos
+	if hit.Face != FACE_POS_Y || mapPos.X != 60 || mapPos.Z != 60 || !world.GetVoxel(60, mapPos.Y, 60) || world.GetVoxel(60, mapPos.Y+1, 60) {
+		t.Fatalf("Incorrect hit from above: %+v\n", hit)
+	}
+	if hit.T != 100-hit.HitPos.Y {
+		t.Fatalf("Incorrect t from above: %+v\n", hit)
+	}
+
+	// out past the loaded chunks rays either go on through nothing or stop
+	// in the fog
+	rayDir := Vector3f{X: 1, Y: 0.01, Z: 0}.Normalize()
+	if hit := world.Raycast(pos, rayDir); hit.Hit() || hit.Status == RAYCAST_UNLOADED {
+		t.Fatalf("Unexpected hit: %+v\n", hit)
+	}
+
+	world.Fog = true
+	hit = world.Raycast(pos, rayDir)
+	if hit.Status != RAYCAST_UNLOADED || hit.HitPos.X < 96 || hit.HitPos.X > 96.01 {
+		t.Fatalf("Expected fog: %+v\n", hit)
+	}
+}
+
+func TestStreamingEvict(t *testing.T) {
+	world := NewStreamingWorld(8, 8, 1, 3, fillStreaming)
+	defer world.Close()
+	world.MaxChunks = 40
+
+	// travel a long way, the chunks left behind go
+	for i := 0; i < 30; i++ {
+		pos := Vector3f{X: float32(i) * 20, Y: 4, Z: float32(i) * -7}
+		waitForChunks(t, world, pos)
+
+		if world.NumChunks() > world.MaxChunks {
+			t.Fatalf("Too many chunks: %d\n", world.NumChunks())
+		}
+
+		// the ones around us stay
+		center := pos.ToVector3i()
+		for dz := int32(-1); dz <= 1; dz++ {
+			for dx := int32(-1); dx <= 1; dx++ {
+				if !world.IsLoaded(center.X+dx*8, center.Z+dz*8) {
+					t.Fatalf("Missing chunk near %v\n", pos)
+				}
+			}
+		}
+	}
+
+	if world.IsLoaded(0, 0) {
+		t.Fatalf("The first chunk wasn't dropped\n")
+	}
+}
@@ -198,6 +198,14 @@ func (v1 Vector3f) Min(v2 Vector3f) Vector3f {
 	}
 }
 
+func (v1 Vector3f) Max(v2 Vector3f) Vector3f {
+	return Vector3f{
+		max(v1.X, v2.X),
+		max(v1.Y, v2.Y),
+		max(v1.Z, v2.Z),
+	}
+}
+
 func (v1 Vector3f) LessThanEqual(v2 Vector3f) Vector3f {
 	x, y, z := float32(0), float32(0), float32(0)
 	if v1.X <= v2.X {
@@ -0,0 +1,696 @@
+package voxel
+
+// MagicaVoxel .vox files are a "VOX " magic and int32 version followed by a
+// MAIN chunk whose children hold everything else. every chunk is
+//
+//	id       [4]byte
+//	content  int32    size of the chunk's own data
+//	children int32    size of the chunks nested inside it
+//
+// models are a SIZE chunk followed by an XYZI chunk of x, y, z, color index
+// bytes. nTRN, nGRP and nSHP chunks make a scene graph of transforms, groups
+// and shapes that place the models, LAYR chunks name layers that transforms
+// belong to, RGBA holds the palette and MATL the material of each palette
+// entry. see https://github.com/ephtracy/voxel-model for the full format
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image/color"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const VOX_MAGIC = "VOX "
+
+// VoxModel is one model from a .vox file, before the scene graph has moved it
+// into place. Index is into the file's Palette and is never 0
+type VoxModel struct {
+	Size   Vector3i
+	Voxels []VoxVoxel
+}
+
+type VoxVoxel struct {
+	X, Y, Z, Index uint8
+}
+
+// VoxMaterial holds the MATL properties of a palette entry. Type is one of
+// _diffuse, _metal, _glass, _emit and so on, Properties has every property as
+// it was written, such as _rough, _metal, _ior or _emit
+type VoxMaterial struct {
+	Type       string
+	Properties map[string]string
+}
+
+// Float returns a property as a number, or def if it is missing or isn't one
+func (m VoxMaterial) Float(name string, def float32) float32 {
+	f, err := strconv.ParseFloat(m.Properties[name], 32)
+	if err != nil {
+		return def
+	}
+	return float32(f)
+}
+
+type VoxLayer struct {
+	Name   string
+	Hidden bool
+}
+
+// VoxInstance is a model placed by the scene graph. voxel v of the model
+// ends up at Rotation * (v - Size / 2) + Translation, in the file's z up space
+type VoxInstance struct {
+	Model       int
+	Name        string // of the nearest transform above the shape
+	Layer       int32
+	Hidden      bool // the instance, one of its parents or its layer is hidden
+	Rotation    [3][3]int32
+	Translation Vector3i
+}
+
+// VoxFile is everything we use from a .vox file. files without a scene graph
+// get an instance of each model at the origin
+type VoxFile struct {
+	Version   int32
+	Models    []VoxModel
+	Instances []VoxInstance
+	Palette   []color.RGBA  // 256 colors, indexed by VoxVoxel.Index
+	Materials []VoxMaterial // 256 materials indexed like Palette
+	Layers    []VoxLayer    // indexed by VoxInstance.Layer
+}
+
+// ReadVox reads a MagicaVoxel .vox file and flattens its scene graph into
+// instances, chunks we don't use are skipped
+func ReadVox(r io.Reader) (*VoxFile, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	in := &voxReader{data: data}
+	if magic := in.bytes(4); string(magic) != VOX_MAGIC {
+		return nil, fmt.Errorf("not a vox file")
+	}
+
+	vox := &VoxFile{
+		Version:   in.int32(),
+		Palette:   defaultVoxPalette(),
+		Materials: make([]VoxMaterial, 256),
+	}
+
+	if id := string(in.bytes(4)); id != "MAIN" {
+		return nil, fmt.Errorf("expected MAIN chunk, got %q", id)
+	}
+	in.bytes(int(in.int32())) // MAIN has no content of its own
+	in.int32()                // and its children are the rest of the file
+
+	nodes := map[int32]voxNode{}
+	var size *Vector3i
+
+	for in.err == nil && in.pos < len(in.data) {
+		id := string(in.bytes(4))
+		content, children := in.int32(), in.int32()
+		chunk := &voxReader{data: in.bytes(int(content))}
+		in.bytes(int(children))
+		if in.err != nil {
+			return nil, fmt.Errorf("%s chunk: %w", id, in.err)
+		}
+
+		switch id {
+		case "SIZE":
+			size = &Vector3i{X: chunk.int32(), Y: chunk.int32(), Z: chunk.int32()}
+
+		case "XYZI":
+			if size == nil {
+				return nil, fmt.Errorf("XYZI chunk without SIZE")
+			}
+			// the count has to agree with the data before anything is allocated
+			numVoxels := chunk.int32()
+			if room := len(chunk.data)/4 - 1; chunk.err != nil || int(numVoxels) != room {
+				return nil, fmt.Errorf("XYZI chunk has room for %d voxels, not %d", max(room, 0), numVoxels)
+			}
+			model := VoxModel{Size: *size, Voxels: make([]VoxVoxel, numVoxels)}
+			for i := range model.Voxels {
+				v := chunk.bytes(4)
+				model.Voxels[i] = VoxVoxel{X: v[0], Y: v[1], Z: v[2], Index: v[3]}
+			}
+			vox.Models = append(vox.Models, model)
+			size = nil
+
+		case "RGBA":
+			// entry i of the chunk is palette index i + 1
+			for i := 0; i < 255; i++ {
+				c := chunk.bytes(4)
+				if chunk.err != nil {
+					break
+				}
+				vox.Palette[i+1] = color.RGBA{R: c[0], G: c[1], B: c[2], A: c[3]}
+			}
+
+		case "MATL":
+			i := chunk.int32()
+			properties := chunk.dict()
+			if i >= 0 && int(i) < len(vox.Materials) {
+				vox.Materials[i] = VoxMaterial{Type: properties["_type"], Properties: properties}
+			}
+
+		case "LAYR":
+			i := chunk.int32()
+			properties := chunk.dict()
+			if i >= 0 && i < 1024 {
+				for int(i) >= len(vox.Layers) {
+					vox.Layers = append(vox.Layers, VoxLayer{})
+				}
+				vox.Layers[i] = VoxLayer{Name: properties["_name"], Hidden: properties["_hidden"] == "1"}
+			}
+
+		case "nTRN", "nGRP", "nSHP":
+			node := voxNode{kind: id}
+			i := chunk.int32()
+			node.attributes = chunk.dict()
+
+			switch id {
+			case "nTRN":
+				node.children = []int32{chunk.int32()}
+				chunk.int32() // reserved
+				node.layer = chunk.int32()
+				node.rotation = voxRotation(0)
+				if frames := chunk.int32(); frames > 0 {
+					frame := chunk.dict()
+					if r, err := strconv.Atoi(frame["_r"]); err == nil {
+						node.rotation = voxRotation(uint8(r))
+					}
+					if t := strings.Fields(frame["_t"]); len(t) == 3 {
+						x, _ := strconv.Atoi(t[0])
+						y, _ := strconv.Atoi(t[1])
+						z, _ := strconv.Atoi(t[2])
+						node.translation = Vector3i{X: int32(x), Y: int32(y), Z: int32(z)}
+					}
+				}
+			case "nGRP":
+				node.children = make([]int32, max(chunk.int32(), 0))
+				for c := range node.children {
+					node.children[c] = chunk.int32()
+				}
+			case "nSHP":
+				node.children = make([]int32, max(chunk.int32(), 0))
+				for c := range node.children {
+					node.children[c] = chunk.int32()
+					chunk.dict()
+				}
+			}
+			nodes[i] = node
+		}
+
+		if chunk.err != nil {
+			return nil, fmt.Errorf("%s chunk: %w", id, chunk.err)
+		}
+	}
+
+	if len(nodes) == 0 {
+		for i := range vox.Models {
+			vox.Instances = append(vox.Instances, VoxInstance{Model: i, Rotation: voxRotation(0)})
+		}
+		return vox, nil
+	}
+
+	if err := vox.place(nodes, 0, voxInstanceTransform{rotation: voxRotation(0)}, 0); err != nil {
+		return nil, err
+	}
+
+	return vox, nil
+}
+
+type voxNode struct {
+	kind        string
+	attributes  map[string]string
+	children    []int32 // models for shapes
+	layer       int32
+	rotation    [3][3]int32
+	translation Vector3i
+}
+
+type voxInstanceTransform struct {
+	rotation    [3][3]int32
+	translation Vector3i
+	name        string
+	layer       int32
+	hidden      bool
+}
+
+// place walks the scene graph from node i adding an instance for every model
+// a shape refers to
+func (vox *VoxFile) place(nodes map[int32]voxNode, i int32, parent voxInstanceTransform, depth int) error {
+	node, ok := nodes[i]
+	if !ok {
+		return fmt.Errorf("missing scene graph node %d", i)
+	}
+	if depth > 64 {
+		return fmt.Errorf("scene graph too deep at node %d", i)
+	}
+
+	parent.hidden = parent.hidden || node.attributes["_hidden"] == "1"
+
+	switch node.kind {
+	case "nTRN":
+		// the parent's transform applies after ours
+		rotation := stampTransform(parent.rotation).mul(node.rotation)
+		translation := stampTransform(parent.rotation).apply(node.translation)
+
+		transform := voxInstanceTransform{
+			rotation:    rotation,
+			translation: Vector3i{X: translation.X + parent.translation.X, Y: translation.Y + parent.translation.Y, Z: translation.Z + parent.translation.Z},
+			name:        node.attributes["_name"],
+			layer:       node.layer,
+			hidden:      parent.hidden,
+		}
+		if node.layer >= 0 && int(node.layer) < len(vox.Layers) && vox.Layers[node.layer].Hidden {
+			transform.hidden = true
+		}
+		for _, child := range node.children {
+			if err := vox.place(nodes, child, transform, depth+1); err != nil {
+				return err
+			}
+		}
+
+	case "nGRP":
+		for _, child := range node.children {
+			if err := vox.place(nodes, child, parent, depth+1); err != nil {
+				return err
+			}
+		}
+
+	case "nSHP":
+		for _, model := range node.children {
+			if model < 0 || int(model) >= len(vox.Models) {
+				return fmt.Errorf("shape %d uses missing model %d", i, model)
+			}
+			vox.Instances = append(vox.Instances, VoxInstance{
+				Model:       int(model),
+				Name:        parent.name,
+				Layer:       parent.layer,
+				Hidden:      parent.hidden,
+				Rotation:    parent.rotation,
+				Translation: parent.translation,
+			})
+		}
+	}
+
+	return nil
+}
+
+// voxRotation unpacks a rotation byte. bits 0-1 are the column of the non
+// zero entry in the first row, bits 2-3 the column in the second row, the
+// third row gets the column left over. bits 4, 5 and 6 make each row negative
+func voxRotation(r uint8) [3][3]int32 {
+	first, second := int(r&3), int(r>>2&3)
+	if first == second || first > 2 || second > 2 {
+		return identityTransform()
+	}
+
+	var m [3][3]int32
+	for row, column := range [3]int{first, second, 3 - first - second} {
+		m[row][column] = 1
+		if r&(1<<(4+row)) != 0 {
+			m[row][column] = -1
+		}
+	}
+	return m
+}
+
+// voxRotationByte packs a rotation the way voxRotation unpacks it
+func voxRotationByte(m [3][3]int32) uint8 {
+	var r uint8
+	for row := range m {
+		for column, v := range m[row] {
+			if v == 0 {
+				continue
+			}
+			if row < 2 {
+				r |= uint8(column) << (2 * row)
+			}
+			if v < 0 {
+				r |= 1 << (4 + row)
+			}
+		}
+	}
+	return r
+}
+
+// Position returns where voxel v of a model is put by the instance, in the
+// file's z up space. the middle of the model is at Translation, rounding
+// down for models an odd number of voxels across
+func (instance VoxInstance) Position(model *VoxModel, v VoxVoxel) Vector3i {
+	// twice the offset of the voxel's middle from the model's middle
+	twice := Vector3i{
+		X: 2*int32(v.X) + 1 - model.Size.X,
+		Y: 2*int32(v.Y) + 1 - model.Size.Y,
+		Z: 2*int32(v.Z) + 1 - model.Size.Z,
+	}
+	twice = stampTransform(instance.Rotation).apply(twice)
+
+	return Vector3i{
+		X: floorDiv(twice.X, 2) + instance.Translation.X,
+		Y: floorDiv(twice.Y, 2) + instance.Translation.Y,
+		Z: floorDiv(twice.Z, 2) + instance.Translation.Z,
+	}
+}
+
+// NewVoxelGridFromVox builds a grid holding every visible instance. .vox
+// files are z up so the file's x, y, z become x, z, -y, which keeps the
+// models the right way round, and the grid is just big enough with the
+// lowest corner of the models at its origin. voxels get their palette index
+// as their Material and the grid gets the file's Palette
+func NewVoxelGridFromVox(vox *VoxFile, voxelSize float32) *VoxelGrid {
+	toGrid := func(p Vector3i) Vector3i {
+		return Vector3i{X: p.X, Y: p.Z, Z: -p.Y}
+	}
+
+	first := true
+	var lo, hi Vector3i
+	vox.forEachVoxel(func(pos Vector3i, index uint8) {
+		pos = toGrid(pos)
+		if first {
+			lo, hi, first = pos, pos, false
+		}
+		lo = Vector3i{X: min(lo.X, pos.X), Y: min(lo.Y, pos.Y), Z: min(lo.Z, pos.Z)}
+		hi = Vector3i{X: max(hi.X, pos.X), Y: max(hi.Y, pos.Y), Z: max(hi.Z, pos.Z)}
+	})
+
+	grid := NewVoxelGrid(hi.X-lo.X+1, hi.Y-lo.Y+1, hi.Z-lo.Z+1, voxelSize)
+	grid.Palette = append([]color.RGBA(nil), vox.Palette...)
+
+	vox.forEachVoxel(func(pos Vector3i, index uint8) {
+		pos = toGrid(pos)
+		grid.SetMaterial(pos.X-lo.X, pos.Y-lo.Y, pos.Z-lo.Z, Material(index))
+	})
+
+	return grid
+}
+
+func (vox *VoxFile) forEachVoxel(fn func(pos Vector3i, index uint8)) {
+	for _, instance := range vox.Instances {
+		if instance.Hidden {
+			continue
+		}
+		model := &vox.Models[instance.Model]
+		for _, v := range model.Voxels {
+			if int32(v.X) >= model.Size.X || int32(v.Y) >= model.Size.Y || int32(v.Z) >= model.Size.Z || v.Index == 0 {
+				continue
+			}
+			fn(instance.Position(model, v), v.Index)
+		}
+	}
+}
+
+// VOX_MODEL_SIZE is the most voxels a .vox model can have along each axis
+const VOX_MODEL_SIZE = 256
+
+// NewVoxFileFromGrid turns a grid into models of at most VOX_MODEL_SIZE
+// voxels a side, each with an instance that puts it back in place. y up
+// becomes z up, undoing what NewVoxelGridFromVox does, so reading the file
+// back gives the same grid trimmed to the voxels that are set. materials
+// 1 to 255 become palette indices, voxels without a material or with one past
+// 255 use index 255. the grid's Palette is written where it has an entry,
+// the default palette fills in the rest
+func NewVoxFileFromGrid(grid *VoxelGrid) *VoxFile {
+	vox := &VoxFile{
+		Version:   150,
+		Palette:   defaultVoxPalette(),
+		Materials: make([]VoxMaterial, 256),
+	}
+	for i := 1; i < len(grid.Palette) && i < len(vox.Palette); i++ {
+		vox.Palette[i] = grid.Palette[i]
+	}
+	if len(grid.Palette) <= 255 {
+		vox.Palette[255] = defaultMeshColor
+	}
+
+	// grid x, y, z is x, -z, y in the file, moved along so y isn't negative
+	size := Vector3i{X: grid.NumVoxelsX, Y: grid.NumVoxelsZ, Z: grid.NumVoxelsY}
+	models := map[Vector3i]int{}
+
+	grid.ForEachVoxel(Vector3i{}, grid.Count(), func(x, y, z int32) bool {
+		pos := Vector3i{X: x, Y: grid.NumVoxelsZ - 1 - z, Z: y}
+		block := Vector3i{X: pos.X / VOX_MODEL_SIZE, Y: pos.Y / VOX_MODEL_SIZE, Z: pos.Z / VOX_MODEL_SIZE}
+
+		i, ok := models[block]
+		if !ok {
+			i = len(vox.Models)
+			models[block] = i
+
+			origin := Vector3i{X: block.X * VOX_MODEL_SIZE, Y: block.Y * VOX_MODEL_SIZE, Z: block.Z * VOX_MODEL_SIZE}
+			modelSize := Vector3i{
+				X: min(size.X-origin.X, VOX_MODEL_SIZE),
+				Y: min(size.Y-origin.Y, VOX_MODEL_SIZE),
+				Z: min(size.Z-origin.Z, VOX_MODEL_SIZE),
+			}
+			vox.Models = append(vox.Models, VoxModel{Size: modelSize})
+
+			// the middle of the model goes at the translation
+			vox.Instances = append(vox.Instances, VoxInstance{
+				Model:       i,
+				Rotation:    identityTransform(),
+				Translation: Vector3i{X: origin.X + modelSize.X/2, Y: origin.Y + modelSize.Y/2, Z: origin.Z + modelSize.Z/2},
+			})
+		}
+
+		index := uint8(255)
+		if m := grid.GetMaterial(x, y, z); m > 0 && m < 256 {
+			index = uint8(m)
+		}
+
+		vox.Models[i].Voxels = append(vox.Models[i].Voxels, VoxVoxel{
+			X:     uint8(pos.X % VOX_MODEL_SIZE),
+			Y:     uint8(pos.Y % VOX_MODEL_SIZE),
+			Z:     uint8(pos.Z % VOX_MODEL_SIZE),
+			Index: index,
+		})
+		return true
+	})
+
+	return vox
+}
+
+// Write writes the file in the .vox format. the scene graph is a transform
+// and shape for each instance, all in one group
+func (vox *VoxFile) Write(w io.Writer) error {
+	var chunks voxWriter
+
+	for _, model := range vox.Models {
+		chunks.chunk("SIZE", func(c *voxWriter) {
+			c.int32(model.Size.X, model.Size.Y, model.Size.Z)
+		})
+		chunks.chunk("XYZI", func(c *voxWriter) {
+			c.int32(int32(len(model.Voxels)))
+			for _, v := range model.Voxels {
+				c.Write([]byte{v.X, v.Y, v.Z, v.Index})
+			}
+		})
+	}
+
+	// node 0 is the root transform, 1 the group and each instance gets a
+	// transform and shape after that
+	chunks.chunk("nTRN", func(c *voxWriter) {
+		c.int32(0)
+		c.dict(nil)
+		c.int32(1, -1, -1, 1)
+		c.dict(nil)
+	})
+	chunks.chunk("nGRP", func(c *voxWriter) {
+		c.int32(1)
+		c.dict(nil)
+		c.int32(int32(len(vox.Instances)))
+		for i := range vox.Instances {
+			c.int32(int32(2 + 2*i))
+		}
+	})
+
+	for i, instance := range vox.Instances {
+		attributes := map[string]string{}
+		if instance.Name != "" {
+			attributes["_name"] = instance.Name
+		}
+		if instance.Hidden {
+			attributes["_hidden"] = "1"
+		}
+
+		frame := map[string]string{
+			"_t": fmt.Sprintf("%d %d %d", instance.Translation.X, instance.Translation.Y, instance.Translation.Z),
+		}
+		if instance.Rotation != identityTransform() {
+			frame["_r"] = strconv.Itoa(int(voxRotationByte(instance.Rotation)))
+		}
+
+		chunks.chunk("nTRN", func(c *voxWriter) {
+			c.int32(int32(2 + 2*i))
+			c.dict(attributes)
+			c.int32(int32(3+2*i), -1, instance.Layer, 1)
+			c.dict(frame)
+		})
+		chunks.chunk("nSHP", func(c *voxWriter) {
+			c.int32(int32(3+2*i), 0)
+			c.int32(1, int32(instance.Model), 0)
+		})
+	}
+
+	for i, layer := range vox.Layers {
+		attributes := map[string]string{}
+		if layer.Name != "" {
+			attributes["_name"] = layer.Name
+		}
+		if layer.Hidden {
+			attributes["_hidden"] = "1"
+		}
+		chunks.chunk("LAYR", func(c *voxWriter) {
+			c.int32(int32(i))
+			c.dict(attributes)
+			c.int32(-1)
+		})
+	}
+
+	// palette index i + 1 is entry i of the chunk
+	chunks.chunk("RGBA", func(c *voxWriter) {
+		for i := 1; i <= 256; i++ {
+			var rgba color.RGBA
+			if i < len(vox.Palette) {
+				rgba = vox.Palette[i]
+			}
+			c.Write([]byte{rgba.R, rgba.G, rgba.B, rgba.A})
+		}
+	})
+
+	for i, m := range vox.Materials {
+		if m.Properties == nil {
+			continue
+		}
+		chunks.chunk("MATL", func(c *voxWriter) {
+			c.int32(int32(i))
+			c.dict(m.Properties)
+		})
+	}
+
+	var header voxWriter
+	header.WriteString(VOX_MAGIC)
+	header.int32(vox.Version)
+	header.WriteString("MAIN")
+	header.int32(0, int32(chunks.Len()))
+
+	if _, err := w.Write(header.Bytes()); err != nil {
+		return err
+	}
+	_, err := w.Write(chunks.Bytes())
+	return err
+}
+
+// defaultVoxPalette is the palette MagicaVoxel uses for files without an
+// RGBA chunk. a 6x6x6 color cube without black followed by ramps of red,
+// green, blue and grey
+func defaultVoxPalette() []color.RGBA {
+	palette := make([]color.RGBA, 1, 256)
+
+	steps := []uint8{0xff, 0xcc, 0x99, 0x66, 0x33, 0x00}
+	for _, r := range steps {
+		for _, g := range steps {
+			for _, b := range steps {
+				if r != 0 || g != 0 || b != 0 {
+					palette = append(palette, color.RGBA{R: r, G: g, B: b, A: 255})
+				}
+			}
+		}
+	}
+
+	ramp := []uint8{0xee, 0xdd, 0xbb, 0xaa, 0x88, 0x77, 0x55, 0x44, 0x22, 0x11}
+	for _, c := range []color.RGBA{{R: 1}, {G: 1}, {B: 1}, {R: 1, G: 1, B: 1}} {
+		for _, v := range ramp {
+			palette = append(palette, color.RGBA{R: c.R * v, G: c.G * v, B: c.B * v, A: 255})
+		}
+	}
+
+	return palette
+}
+
+// voxReader reads little endian values from a chunk, once something goes
+// wrong every read after it returns zero and err says what happened
+type voxReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *voxReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || r.pos+n > len(r.data) {
+		r.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *voxReader) int32() int32 {
+	b := r.bytes(4)
+	if b == nil {
+		return 0
+	}
+	return int32(binary.LittleEndian.Uint32(b))
+}
+
+func (r *voxReader) string() string {
+	return string(r.bytes(int(r.int32())))
+}
+
+func (r *voxReader) dict() map[string]string {
+	n := r.int32()
+	dict := map[string]string{}
+	for i := int32(0); i < n && r.err == nil; i++ {
+		key := r.string()
+		dict[key] = r.string()
+	}
+	return dict
+}
+
+// voxWriter builds chunks in memory as their sizes come before them
+type voxWriter struct {
+	bytes.Buffer
+}
+
+func (w *voxWriter) chunk(id string, content func(c *voxWriter)) {
+	var c voxWriter
+	content(&c)
+
+	w.WriteString(id)
+	w.int32(int32(c.Len()), 0)
+	w.Write(c.Bytes())
+}
+
+func (w *voxWriter) int32(values ...int32) {
+	for _, v := range values {
+		w.Write(binary.LittleEndian.AppendUint32(nil, uint32(v)))
+	}
+}
+
+func (w *voxWriter) string(s string) {
+	w.int32(int32(len(s)))
+	w.WriteString(s)
+}
+
+// dict writes the keys in order so the same file always comes out the same
+func (w *voxWriter) dict(dict map[string]string) {
+	keys := make([]string, 0, len(dict))
+	for key := range dict {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	w.int32(int32(len(keys)))
+	for _, key := range keys {
+		w.string(key)
+		w.string(dict[key])
+	}
+}
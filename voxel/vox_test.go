@@ -0,0 +1,316 @@
+package voxel
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/color"
+	"math"
+	"os"
+	"testing"
+)
+
+func readVoxFile(t *testing.T, name string) *VoxFile {
+	f, err := os.Open("../assets/models/" + name)
+	if err != nil {
+		t.Fatalf("Open failed: %v\n", err)
+	}
+	defer f.Close()
+
+	vox, err := ReadVox(f)
+	if err != nil {
+		t.Fatalf("ReadVox %s failed: %v\n", name, err)
+	}
+	return vox
+}
+
+func TestReadVoxAssets(t *testing.T) {
+	for _, c := range []struct {
+		name      string
+		models    int
+		instances int
+		layers    int
+		voxels    int
+	}{
+		{"block.vox", 1, 1, 8, 3396},
+		{"casa.vox", 7, 8, 32, 35293}, // some of the models overlap
+		{"chr_knight.vox", 1, 1, 32, 398},
+		{"chr_man.vox", 1, 1, 0, 358},
+		{"monu1.vox", 1, 1, 0, 156942},
+		{"monu3.vox", 1, 1, 32, 32832},
+	} {
+		vox := readVoxFile(t, c.name)
+		if len(vox.Models) != c.models || len(vox.Instances) != c.instances || len(vox.Layers) != c.layers || len(vox.Palette) != 256 {
+			t.Fatalf("Incorrect %s: %d %d %d %d\n", c.name, len(vox.Models), len(vox.Instances), len(vox.Layers), len(vox.Palette))
+		}
+
+		grid := NewVoxelGridFromVox(vox, 0.5)
+		if n := grid.CountVoxels(Vector3i{}, grid.Count()); n != c.voxels {
+			t.Fatalf("Incorrect %s voxels: %d\n", c.name, n)
+		}
+
+		// every voxel has a color and the grid is no bigger than it needs to be
+		lo, hi := grid.Count(), Vector3i{}
+		grid.ForEachVoxel(Vector3i{}, grid.Count(), func(x, y, z int32) bool {
+			if m := grid.GetMaterial(x, y, z); m == 0 || int(m) >= len(grid.Palette) {
+				t.Fatalf("Incorrect %s material: %d\n", c.name, m)
+			}
+			lo = Vector3i{X: min(lo.X, x), Y: min(lo.Y, y), Z: min(lo.Z, z)}
+			hi = Vector3i{X: max(hi.X, x+1), Y: max(hi.Y, y+1), Z: max(hi.Z, z+1)}
+			return true
+		})
+		if !lo.Equals(Vector3i{}) || !hi.Equals(grid.Count()) {
+			t.Fatalf("Incorrect %s bounds: %+v %+v %+v\n", c.name, lo, hi, grid.Count())
+		}
+	}
+
+	casa := readVoxFile(t, "casa.vox")
+	if casa.Palette[1] != (color.RGBA{R: 75, G: 75, B: 75, A: 255}) || casa.Instances[0].Translation != (Vector3i{X: -39, Y: -41, Z: 20}) {
+		t.Fatalf("Incorrect casa: %+v %+v\n", casa.Palette[1], casa.Instances[0])
+	}
+
+	if casa.Materials[81].Type != "_glass" || casa.Materials[113].Type != "_emit" || casa.Materials[113].Float("_emit", 0) != 0.62 || casa.Materials[1].Float("_metal", -1) != -1 {
+		t.Fatalf("Incorrect casa materials: %+v %+v\n", casa.Materials[81], casa.Materials[113])
+	}
+
+	// without an RGBA chunk the default palette is used
+	if palette := defaultVoxPalette(); len(palette) != 256 || palette[1] != (color.RGBA{R: 255, G: 255, B: 255, A: 255}) || palette[255] != (color.RGBA{R: 0x11, G: 0x11, B: 0x11, A: 255}) {
+		t.Fatalf("Incorrect default palette: %d %+v\n", len(palette), palette[255])
+	}
+}
+
+// voxChunks builds .vox files for tests
+type voxChunks struct {
+	bytes.Buffer
+}
+
+func (w *voxChunks) chunk(id string, values ...any) {
+	var content bytes.Buffer
+	for _, v := range values {
+		switch v := v.(type) {
+		case map[string]string:
+			binary.Write(&content, binary.LittleEndian, int32(len(v)))
+			for key, value := range v {
+				binary.Write(&content, binary.LittleEndian, int32(len(key)))
+				content.WriteString(key)
+				binary.Write(&content, binary.LittleEndian, int32(len(value)))
+				content.WriteString(value)
+			}
+		default:
+			binary.Write(&content, binary.LittleEndian, v)
+		}
+	}
+
+	w.WriteString(id)
+	binary.Write(w, binary.LittleEndian, [2]int32{int32(content.Len()), 0})
+	w.Write(content.Bytes())
+}
+
+func (w *voxChunks) file() []byte {
+	var file bytes.Buffer
+	file.WriteString(VOX_MAGIC)
+	binary.Write(&file, binary.LittleEndian, int32(150))
+	file.WriteString("MAIN")
+	binary.Write(&file, binary.LittleEndian, [2]int32{0, int32(w.Len())})
+	file.Write(w.Bytes())
+	return file.Bytes()
+}
+
+func TestReadVoxInvalidCount(t *testing.T) {
+	// counts that don't match the voxels that follow, the big one would take
+	// gigabytes if it was trusted
+	for _, count := range []int32{-1, 1, 3, math.MaxInt32} {
+		var w voxChunks
+		w.chunk("SIZE", [3]int32{2, 2, 2})
+		w.chunk("XYZI", count, [4]uint8{0, 0, 0, 1}, [4]uint8{1, 1, 1, 2})
+
+		if _, err := ReadVox(bytes.NewReader(w.file())); err == nil {
+			t.Fatalf("Expected count error: %d\n", count)
+		}
+	}
+}
+
+func TestReadVoxSceneGraph(t *testing.T) {
+	var w voxChunks
+	w.chunk("SIZE", [3]int32{3, 2, 1})
+	w.chunk("XYZI", int32(2), [4]uint8{0, 0, 0, 1}, [4]uint8{2, 1, 0, 2})
+	w.chunk("SIZE", [3]int32{1, 1, 1})
+	w.chunk("XYZI", int32(1), [4]uint8{0, 0, 0, 3})
+	w.chunk("RGBA", make([]uint8, 1024))
+
+	// root -> group -> turned and moved -> model 0
+	//               -> hidden -> model 1
+	//               -> on a hidden layer -> model 1
+	w.chunk("nTRN", int32(0), map[string]string{}, int32(1), int32(-1), int32(-1), int32(1), map[string]string{"_t": "100 0 0"})
+	w.chunk("nGRP", int32(1), map[string]string{}, int32(3), [3]int32{2, 4, 6})
+	w.chunk("nTRN", int32(2), map[string]string{"_name": "turned"}, int32(3), int32(-1), int32(0), int32(1), map[string]string{"_t": "10 0 0", "_r": "17"})
+	w.chunk("nSHP", int32(3), map[string]string{}, int32(1), int32(0), map[string]string{})
+	w.chunk("nTRN", int32(4), map[string]string{"_hidden": "1"}, int32(5), int32(-1), int32(0), int32(1), map[string]string{})
+	w.chunk("nSHP", int32(5), map[string]string{}, int32(1), int32(1), map[string]string{})
+	w.chunk("nTRN", int32(6), map[string]string{}, int32(5), int32(-1), int32(1), int32(1), map[string]string{})
+	w.chunk("LAYR", int32(1), map[string]string{"_hidden": "1"}, int32(-1))
+
+	vox, err := ReadVox(bytes.NewReader(w.file()))
+	if err != nil {
+		t.Fatalf("ReadVox failed: %v\n", err)
+	}
+
+	if len(vox.Instances) != 3 || vox.Instances[0].Name != "turned" || vox.Instances[0].Hidden || !vox.Instances[1].Hidden || !vox.Instances[2].Hidden {
+		t.Fatalf("Incorrect instances: %+v\n", vox.Instances)
+	}
+
+	// a quarter turn about z, then moved by both transforms
+	turned := vox.Instances[0]
+	if turned.Rotation != [3][3]int32{{0, -1, 0}, {1, 0, 0}, {0, 0, 1}} || turned.Translation != (Vector3i{X: 110}) {
+		t.Fatalf("Incorrect transform: %+v\n", turned)
+	}
+
+	model := &vox.Models[0]
+	if p := turned.Position(model, model.Voxels[0]); p != (Vector3i{X: 110, Y: -1}) {
+		t.Fatalf("Incorrect position: %+v\n", p)
+	}
+	if p := turned.Position(model, model.Voxels[1]); p != (Vector3i{X: 109, Y: 1}) {
+		t.Fatalf("Incorrect position: %+v\n", p)
+	}
+
+	// z up becomes y up
+	grid := NewVoxelGridFromVox(vox, 1)
+	if !grid.Count().Equals(Vector3i{X: 2, Y: 1, Z: 3}) || grid.GetMaterial(1, 0, 2) != 1 || grid.GetMaterial(0, 0, 0) != 2 {
+		t.Fatalf("Incorrect grid: %+v\n", grid.Count())
+	}
+
+	for _, bad := range [][]byte{[]byte("VOX"), []byte("NOPE1234"), w.file()[:len(w.file())-3]} {
+		if _, err := ReadVox(bytes.NewReader(bad)); err == nil {
+			t.Fatalf("Expected error: %q\n", bad)
+		}
+	}
+}
+
+func TestVoxRotation(t *testing.T) {
+	if voxRotation(4) != identityTransform() {
+		t.Fatalf("Incorrect identity: %+v\n", voxRotation(4))
+	}
+
+	// every valid byte is a rotation or a mirror
+	for r := 0; r < 128; r++ {
+		m := stampTransform(voxRotation(uint8(r)))
+		var transpose stampTransform
+		for i := range m {
+			for j := range m[i] {
+				transpose[j][i] = m[i][j]
+			}
+		}
+		if m.mul(transpose) != identityTransform() {
+			t.Fatalf("Not orthogonal: %d %+v\n", r, m)
+		}
+
+		if voxRotation(voxRotationByte(m)) != m {
+			t.Fatalf("Incorrect rotation byte: %d %d\n", r, voxRotationByte(m))
+		}
+	}
+}
+
+func writeAndReadVox(t *testing.T, vox *VoxFile) *VoxFile {
+	var buf bytes.Buffer
+	if err := vox.Write(&buf); err != nil {
+		t.Fatalf("Write failed: %v\n", err)
+	}
+
+	read, err := ReadVox(&buf)
+	if err != nil {
+		t.Fatalf("ReadVox failed: %v\n", err)
+	}
+	return read
+}
+
+func checkSameVoxels(t *testing.T, expected, read *VoxelGrid, offset Vector3i) {
+	if n, m := expected.CountVoxels(Vector3i{}, expected.Count()), read.CountVoxels(Vector3i{}, read.Count()); n != m {
+		t.Fatalf("Incorrect voxel count: %d %d\n", n, m)
+	}
+
+	expected.ForEachVoxel(Vector3i{}, expected.Count(), func(x, y, z int32) bool {
+		rx, ry, rz := x-offset.X, y-offset.Y, z-offset.Z
+		if !read.Contains(rx, ry, rz) || !read.GetVoxel(rx, ry, rz) {
+			t.Fatalf("Missing voxel: %d %d %d\n", x, y, z)
+		}
+
+		m := expected.GetMaterial(x, y, z)
+		if m == 0 || m > 255 {
+			m = 255
+		}
+		if read.GetMaterial(rx, ry, rz) != m {
+			t.Fatalf("Incorrect material: %d %d %d %d\n", x, y, z, read.GetMaterial(rx, ry, rz))
+		}
+		return true
+	})
+}
+
+func TestWriteVox(t *testing.T) {
+	grid := NewVoxelGrid(13, 7, 9, 0.5)
+	grid.Palette = []color.RGBA{{}, {R: 255, A: 255}, {G: 255, A: 255}, {B: 255, A: 255}}
+	grid.Fill(Sphere{Center: Vector3f{X: 3, Y: 2, Z: 2}, Radius: 1.5}, FILL_UNION, 1)
+	grid.SetMaterial(0, 0, 0, 2)
+	grid.SetMaterial(12, 6, 8, 3)
+	grid.SetVoxel(12, 0, 8, true)
+	grid.SetMaterial(0, 6, 8, 300)
+
+	vox := writeAndReadVox(t, NewVoxFileFromGrid(grid))
+	if len(vox.Models) != 1 || vox.Palette[3] != grid.Palette[3] || vox.Palette[255] != defaultMeshColor {
+		t.Fatalf("Incorrect vox: %d %+v\n", len(vox.Models), vox.Palette[:4])
+	}
+
+	read := NewVoxelGridFromVox(vox, grid.VoxelSize)
+	if !read.Count().Equals(grid.Count()) {
+		t.Fatalf("Incorrect size: %+v\n", read.Count())
+	}
+	checkSameVoxels(t, grid, read, Vector3i{})
+}
+
+func TestWriteVoxLarge(t *testing.T) {
+	// too big for one model in x and z, which is y in the file
+	grid := NewVoxelGrid(300, 5, 520, 1)
+	grid.Fill(Box{Min: Vector3f{X: 250, Y: 1, Z: 2}, Max: Vector3f{X: 270, Y: 3, Z: 515}}, FILL_UNION, 7)
+	grid.SetMaterial(299, 4, 519, 5)
+
+	file := NewVoxFileFromGrid(grid)
+	if len(file.Models) != 6 {
+		t.Fatalf("Incorrect models: %d\n", len(file.Models))
+	}
+	for _, model := range file.Models {
+		if model.Size.X > VOX_MODEL_SIZE || model.Size.Y > VOX_MODEL_SIZE || model.Size.Z > VOX_MODEL_SIZE {
+			t.Fatalf("Model too big: %+v\n", model.Size)
+		}
+	}
+
+	// the read grid starts at the lowest set voxel
+	read := NewVoxelGridFromVox(writeAndReadVox(t, file), 1)
+	checkSameVoxels(t, grid, read, Vector3i{X: 250, Y: 1, Z: 2})
+}
+
+func TestWriteVoxAsset(t *testing.T) {
+	casa := readVoxFile(t, "casa.vox")
+	read := writeAndReadVox(t, casa)
+
+	if len(read.Models) != len(casa.Models) || len(read.Instances) != len(casa.Instances) || len(read.Layers) != len(casa.Layers) {
+		t.Fatalf("Incorrect vox: %d %d %d\n", len(read.Models), len(read.Instances), len(read.Layers))
+	}
+
+	for i := range casa.Instances {
+		if read.Instances[i] != casa.Instances[i] {
+			t.Fatalf("Incorrect instance: %+v %+v\n", read.Instances[i], casa.Instances[i])
+		}
+	}
+
+	for i := range casa.Palette {
+		if read.Palette[i] != casa.Palette[i] || read.Materials[i].Type != casa.Materials[i].Type || len(read.Materials[i].Properties) != len(casa.Materials[i].Properties) {
+			t.Fatalf("Incorrect palette entry: %d\n", i)
+		}
+	}
+
+	checkSameVoxels(t, NewVoxelGridFromVox(casa, 1), NewVoxelGridFromVox(read, 1), Vector3i{})
+
+	// turned instances keep their rotation
+	casa.Instances[0].Rotation = voxRotation(17)
+	if read := writeAndReadVox(t, casa); read.Instances[0].Rotation != casa.Instances[0].Rotation {
+		t.Fatalf("Incorrect rotation: %+v\n", read.Instances[0].Rotation)
+	}
+}
@@ -2,8 +2,15 @@ package voxel
 
 import (
 	"fmt"
+	"image/color"
 )
 
+// VoxelGrid isn't safe to edit while other goroutines read it. any number of
+// goroutines can read a grid at once as long as nothing is editing it, so
+// edits should either be made by the goroutine that owns the grid while no
+// one else is reading it, with an EditQueue collecting them from elsewhere,
+// or readers should be given a Snapshot which the owner can keep editing
+// around
 type VoxelGrid struct {
 	Parent     *VoxelGrid // higher res version
 	Child      *VoxelGrid // lower res version
@@ -11,38 +18,82 @@ type VoxelGrid struct {
 	NumVoxelsY int32
 	NumVoxelsZ int32
 	VoxelSize  float32
-	Voxels     []uint8
+	Palette    []color.RGBA // colors for each Material
+
+	voxels       pages[uint8]  // one byte per brick, one bit per voxel
+	materials    pages[uint32] // one entry per brick, empty until a material is set
+	palettes     pages[brickPalette]
+	freePalettes []uint32
+
+	readOnly bool // snapshots can't be edited
 }
 
 func NewVoxelGrid(nx, ny, nz int32, sz float32) *VoxelGrid {
+	// odd sizes get a brick that is only partly used on the far side and the
+	// total is padded to a whole number of uint32s so it can go straight to the gpu
+	numBricks := halfCount(nx) * halfCount(ny) * halfCount(nz)
+
 	return &VoxelGrid{
 		NumVoxelsX: nx,
 		NumVoxelsY: ny,
 		NumVoxelsZ: nz,
 		VoxelSize:  sz,
-		Voxels:     make([]uint8, nx/2*ny/2*nz/2),
+		voxels:     newPages[uint8]((numBricks + 3) / 4 * 4),
 	}
 }
 
+// Bricks returns a copy of the voxels, a byte for each 2x2x2 brick in the
+// order VoxelIndex gives them with a bit for each voxel. it is padded to a
+// whole number of uint32s so it can go straight to the gpu
+func (grid *VoxelGrid) Bricks() []uint8 {
+	return grid.voxels.slice()
+}
+
+// halfCount is how many voxels are left when n voxels are halved, rounding up
+// so odd sizes don't lose their last slice
+func halfCount(n int32) int32 {
+	return (n + 1) / 2
+}
+
+// Count returns the number of voxels in each direction
+func (grid *VoxelGrid) Count() Vector3i {
+	return Vector3i{X: grid.NumVoxelsX, Y: grid.NumVoxelsY, Z: grid.NumVoxelsZ}
+}
+
+func voxelBit(x, y, z int32) uint8 {
+	return uint8(x + (z * 2) + (y * 2 * 2))
+}
+
 func voxelBitMask(x, y, z int32) uint8 {
-	bit := uint8(x + (z * 2) + (y * 2 * 2))
-	mask := uint8(1) << bit
+	mask := uint8(1) << voxelBit(x, y, z)
 	return mask
 }
 
 func (grid *VoxelGrid) VoxelIndex(x, y, z int32) int32 {
 	vx, vy, vz := x/2, y/2, z/2
-	return vx + vz*grid.NumVoxelsX/2 + vy*grid.NumVoxelsX/2*grid.NumVoxelsZ/2
+	bx, bz := halfCount(grid.NumVoxelsX), halfCount(grid.NumVoxelsZ)
+	return vx + vz*bx + vy*bx*bz
+}
+
+// Contains returns true if x, y, z is inside the grid
+func (grid *VoxelGrid) Contains(x, y, z int32) bool {
+	return !grid.isOutside(Vector3i{X: x, Y: y, Z: z})
+}
+
+// brickPos returns the position of brick i, which is also the position of
+// the voxel it becomes in the lower res grid
+func (grid *VoxelGrid) brickPos(i int32) Vector3i {
+	bx, bz := halfCount(grid.NumVoxelsX), halfCount(grid.NumVoxelsZ)
+	return Vector3i{X: i % bx, Y: i / (bx * bz), Z: (i / bx) % bz}
 }
 
 func (grid *VoxelGrid) GetVoxel(x, y, z int32) bool {
-	i := grid.VoxelIndex(x, y, z)
-	if i < 0 || i >= int32(len(grid.Voxels)) {
+	if grid.isOutside(Vector3i{X: x, Y: y, Z: z}) {
 		fmt.Printf("GetVoxel: Invalid XYZ - %d, %d, %d\n", x, y, z)
 		return false
 	}
 
-	voxel := grid.Voxels[i]
+	voxel := grid.voxels.get(grid.VoxelIndex(x, y, z))
 
 	// no need to check individual bits if all or none set
 	if voxel == 0 || voxel == 255 {
@@ -53,51 +104,94 @@ func (grid *VoxelGrid) GetVoxel(x, y, z int32) bool {
 	return voxel&mask != 0
 }
 
+// SetVoxel sets or clears a voxel, any voxel it sets has no material
 func (grid *VoxelGrid) SetVoxel(x, y, z int32, set bool) {
-	i := grid.VoxelIndex(x, y, z)
-	if i < 0 || i >= int32(len(grid.Voxels)) {
+	if grid.isOutside(Vector3i{X: x, Y: y, Z: z}) {
 		fmt.Printf("SetVoxel: Invalid XYZ - %d, %d, %d\n", x, y, z)
 		return
 	}
 
-	voxel := &grid.Voxels[i]
-	mask := voxelBitMask(x%2, y%2, z%2)
+	grid.setVoxel(grid.VoxelIndex(x, y, z), voxelBit(x%2, y%2, z%2), set, 0)
+}
 
+func (grid *VoxelGrid) setVoxel(i int32, bit uint8, set bool, m Material) {
+	mask := uint8(1) << bit
 	if set {
-		*voxel = *voxel | mask
+		grid.setBrick(i, grid.voxels.get(i)|mask, mask, m)
 	} else {
-		*voxel = *voxel & ^mask
+		grid.setBrick(i, grid.voxels.get(i)&^mask, 0, 0)
 	}
 }
 
+// setBrick replaces all the voxels in brick i at once, those in painted are
+// given material m
+func (grid *VoxelGrid) setBrick(i int32, voxels, painted uint8, m Material) {
+	if grid.readOnly {
+		fmt.Printf("SetVoxel: Snapshots are read only\n")
+		return
+	}
+
+	prev := grid.voxels.get(i)
+	grid.voxels.set(i, voxels)
+
+	grid.updateChild(i, prev, voxels)
+
+	// no storage needed until the first material is assigned
+	if grid.materials.len() == 0 {
+		if m == 0 || painted == 0 {
+			return
+		}
+		grid.materials = newPages[uint32](grid.voxels.len())
+	}
+
+	materials := grid.brickMaterials(i)
+	for bit := uint8(0); bit < 8; bit++ {
+		if painted&(uint8(1)<<bit) != 0 {
+			materials[bit] = m
+		}
+	}
+	grid.packBrickMaterials(i, materials)
+}
+
+// updateChild keeps the lower res grid in step with brick i. each brick is a
+// single voxel in the lower res grid so it only needs updating when the brick
+// goes from empty to not or back again
+func (grid *VoxelGrid) updateChild(i int32, prev, curr uint8) {
+	if grid.Child != nil && (prev == 0) != (curr == 0) {
+		brick := grid.brickPos(i)
+		grid.Child.SetVoxel(brick.X, brick.Y, brick.Z, curr != 0)
+	}
+}
+
+// Clear empties the grid and all of its lower res levels
 func (grid *VoxelGrid) Clear() {
-	for i := 0; i < len(grid.Voxels); i++ {
-		grid.Voxels[i] = 0
+	if grid.readOnly {
+		fmt.Printf("Clear: Snapshots are read only\n")
+		return
+	}
+
+	for level := grid; level != nil; level = level.Child {
+		level.voxels.clear()
+		level.materials = pages[uint32]{}
+		level.palettes = pages[brickPalette]{}
+		level.freePalettes = nil
 	}
 }
 
 func (grid *VoxelGrid) Compress() *VoxelGrid {
 	// create the new grid which will be half the size
-	newGrid := NewVoxelGrid(grid.NumVoxelsX/2, grid.NumVoxelsY/2, grid.NumVoxelsZ/2, grid.VoxelSize*2)
+	newGrid := NewVoxelGrid(halfCount(grid.NumVoxelsX), halfCount(grid.NumVoxelsY), halfCount(grid.NumVoxelsZ), grid.VoxelSize*2)
 	newGrid.Parent = grid
+	newGrid.Palette = grid.Palette
 	grid.Child = newGrid
 
+	// each brick becomes a single voxel which is set if anything in the brick is
 	for y := int32(0); y < newGrid.NumVoxelsY; y++ {
 		for z := int32(0); z < newGrid.NumVoxelsZ; z++ {
 			for x := int32(0); x < newGrid.NumVoxelsX; x++ {
-
-				px, py, pz := x*2, y*2, z*2
-
-				s := grid.GetVoxel(px, py, pz) ||
-					grid.GetVoxel(px+1, py, pz) ||
-					grid.GetVoxel(px, py+1, pz) ||
-					grid.GetVoxel(px+1, py+1, pz) ||
-					grid.GetVoxel(px, py, pz+1) ||
-					grid.GetVoxel(px+1, py, pz+1) ||
-					grid.GetVoxel(px, py+1, pz+1) ||
-					grid.GetVoxel(px+1, py+1, pz+1)
-
-				newGrid.SetVoxel(x, y, z, s)
+				if grid.voxels.get(grid.VoxelIndex(x*2, y*2, z*2)) != 0 {
+					newGrid.SetVoxel(x, y, z, true)
+				}
 			}
 		}
 	}
@@ -11,9 +11,9 @@ func TestVoxelGetSet(t *testing.T) {
 		for z := int32(0); z < grid.NumVoxelsZ-1; z++ {
 			for x := int32(0); x < grid.NumVoxelsX-1; x++ {
 
-				prev := grid.Voxels[grid.VoxelIndex(x, y, z)]
+				prev := grid.voxels.get(grid.VoxelIndex(x, y, z))
 				grid.SetVoxel(x, y, z, true)
-				curr := grid.Voxels[grid.VoxelIndex(x, y, z)]
+				curr := grid.voxels.get(grid.VoxelIndex(x, y, z))
 
 				// every voxel set should increase the overall value
 				if curr <= prev {
@@ -27,9 +27,9 @@ func TestVoxelGetSet(t *testing.T) {
 		for z := int32(0); z < grid.NumVoxelsZ-1; z++ {
 			for x := int32(0); x < grid.NumVoxelsX-1; x++ {
 
-				prev := grid.Voxels[grid.VoxelIndex(x, y, z)]
+				prev := grid.voxels.get(grid.VoxelIndex(x, y, z))
 				grid.SetVoxel(x, y, z, false)
-				curr := grid.Voxels[grid.VoxelIndex(x, y, z)]
+				curr := grid.voxels.get(grid.VoxelIndex(x, y, z))
 
 				// every voxel cleared should decrease the overall value
 				if curr >= prev {
@@ -40,6 +40,98 @@ func TestVoxelGetSet(t *testing.T) {
 	}
 }
 
+func TestVoxelMipUpdate(t *testing.T) {
+	grid := NewVoxelGrid(16, 8, 16, 1)
+	grid.SetVoxel(3, 3, 3, true)
+
+	// build the chain then edit the high res grid
+	lowest := grid
+	for lowest.NumVoxelsY > 2 {
+		lowest = lowest.Compress()
+	}
+
+	grid.SetVoxel(12, 5, 9, true)
+	grid.SetVoxel(13, 5, 9, true)
+	grid.SetMaterial(0, 7, 15, 2)
+	grid.SetVoxel(3, 3, 3, false)
+	grid.SetVoxel(12, 5, 9, false)
+
+	// every level should match a freshly compressed chain
+	fresh := NewVoxelGrid(16, 8, 16, 1)
+	fresh.SetVoxel(13, 5, 9, true)
+	fresh.SetVoxel(0, 7, 15, true)
+
+	for level, expected := grid.Child, fresh.Compress(); level != nil; level, expected = level.Child, expected.Compress() {
+		for i := range level.voxels.len() {
+			if level.voxels.get(i) != expected.voxels.get(i) {
+				t.Fatalf("Stale level %d: %d %d %d\n", level.NumVoxelsX, i, level.voxels.get(i), expected.voxels.get(i))
+			}
+		}
+		if level.Child == nil {
+			break
+		}
+	}
+
+	// clearing the last voxel clears every level
+	grid.SetVoxel(13, 5, 9, false)
+	grid.SetVoxel(0, 7, 15, false)
+	for level := grid.Child; level != nil; level = level.Child {
+		for i := range level.voxels.len() {
+			if level.voxels.get(i) != 0 {
+				t.Fatalf("Level not cleared %d: %d\n", level.NumVoxelsX, i)
+			}
+		}
+	}
+}
+
+func TestVoxelOddSize(t *testing.T) {
+	grid := NewVoxelGrid(5, 3, 7, 1)
+
+	for y := int32(0); y < grid.NumVoxelsY; y++ {
+		for z := int32(0); z < grid.NumVoxelsZ; z++ {
+			for x := int32(0); x < grid.NumVoxelsX; x++ {
+				grid.SetVoxel(x, y, z, (x+y+z)%3 == 0)
+			}
+		}
+	}
+
+	// every voxel including the last slices keeps its own value
+	for y := int32(0); y < grid.NumVoxelsY; y++ {
+		for z := int32(0); z < grid.NumVoxelsZ; z++ {
+			for x := int32(0); x < grid.NumVoxelsX; x++ {
+				if grid.GetVoxel(x, y, z) != ((x+y+z)%3 == 0) {
+					t.Fatalf("Incorrect voxel: %d %d %d\n", x, y, z)
+				}
+			}
+		}
+	}
+
+	// storage is padded so the gpu can read it as uint32s
+	if grid.voxels.len()%4 != 0 {
+		t.Fatalf("Storage not padded: %d\n", grid.voxels.len())
+	}
+
+	// compressing rounds up so the last slice is kept
+	grid.Clear()
+	grid.SetVoxel(4, 2, 6, true)
+
+	compressed := grid.Compress()
+	if !compressed.Count().Equals(Vector3i{X: 3, Y: 2, Z: 4}) || !compressed.GetVoxel(2, 1, 3) {
+		t.Fatalf("Incorrect compression: %+v\n", compressed.Count())
+	}
+
+	compressed = compressed.Compress()
+	if !compressed.Count().Equals(Vector3i{X: 2, Y: 1, Z: 2}) || !compressed.GetVoxel(1, 0, 1) {
+		t.Fatalf("Incorrect compression: %+v\n", compressed.Count())
+	}
+
+	// the voxel in the corner can be hit through the chain
+	hit := compressed.RaycastRecursive(Vector3f{X: 4.5, Y: 2.5, Z: -2}, Vector3f{X: 0, Y: 0, Z: 1})
+	if !hit.Hit() || !hit.MapPos.Equals(Vector3i{X: 4, Y: 2, Z: 6}) || hit.Level != 0 {
+		t.Fatalf("Failed to hit: %+v\n", hit)
+	}
+}
+
 /*
 func TestVoxelCompression(t *testing.T) {
 	grid := NewVoxelGrid(16)
@@ -0,0 +1,189 @@
+package voxel
+
+import (
+	"image/color"
+	"math"
+	"sort"
+)
+
+type VoxelizeMode int
+
+const (
+	VOXELIZE_SURFACE VoxelizeMode = iota // set every voxel a triangle touches
+	VOXELIZE_SOLID                       // also fill everything inside the mesh
+)
+
+// Voxelize turns a triangle mesh into a grid just big enough to hold it, the
+// lowest corner of the mesh's Bounds is at the grid's origin. each of the
+// mesh's Materials gets a Palette entry and voxels take the Material of the
+// triangle that set them, one past the index of the mesh material.
+//
+// surface voxelization is conservative, any voxel that a triangle touches is
+// set, so nothing gets through the gaps between triangles. solid voxelization
+// fills between pairs of triangles along y, so it needs a closed mesh
+func Voxelize(mesh *TriangleMesh, voxelSize float32, mode VoxelizeMode) *VoxelGrid {
+	lo, hi := mesh.Bounds()
+
+	// a little slack so a mesh that is a whole number of voxels across
+	// doesn't get an empty layer from rounding
+	count := func(size float32) int32 {
+		return max(int32(math.Ceil(float64(size/voxelSize)-1e-4)), 1)
+	}
+	grid := NewVoxelGrid(count(hi.X-lo.X), count(hi.Y-lo.Y), count(hi.Z-lo.Z), voxelSize)
+
+	if len(mesh.Materials) > 0 {
+		grid.Palette = make([]color.RGBA, len(mesh.Materials)+1)
+		for i, m := range mesh.Materials {
+			grid.Palette[i+1] = m.Color
+		}
+	}
+
+	// work in voxel units from here on, voxel x, y, z covers x to x + 1
+	triangles := make([]Triangle, len(mesh.Triangles))
+	for i, tri := range mesh.Triangles {
+		triangles[i].Material = tri.Material
+		for c, corner := range tri.Corners {
+			triangles[i].Corners[c] = corner.Sub(lo).DivScalar(voxelSize)
+		}
+	}
+
+	if mode == VOXELIZE_SOLID {
+		grid.voxelizeSolid(triangles)
+	}
+
+	for _, tri := range triangles {
+		grid.voxelizeTriangle(tri)
+	}
+
+	return grid
+}
+
+func (grid *VoxelGrid) setVoxelized(x, y, z int32, material int) {
+	if material >= 0 {
+		grid.SetMaterial(x, y, z, Material(material+1))
+	} else {
+		grid.SetVoxel(x, y, z, true)
+	}
+}
+
+func (grid *VoxelGrid) voxelizeTriangle(tri Triangle) {
+	lo := tri.Corners[0].Min(tri.Corners[1]).Min(tri.Corners[2]).Floor()
+	hi := tri.Corners[0].Max(tri.Corners[1]).Max(tri.Corners[2]).Floor()
+
+	// a corner on a voxel boundary also touches the voxel below it
+	from := Vector3i{X: max(int32(lo.X)-1, 0), Y: max(int32(lo.Y)-1, 0), Z: max(int32(lo.Z)-1, 0)}
+	to := Vector3i{X: min(int32(hi.X), grid.NumVoxelsX-1), Y: min(int32(hi.Y), grid.NumVoxelsY-1), Z: min(int32(hi.Z), grid.NumVoxelsZ-1)}
+
+	for y := from.Y; y <= to.Y; y++ {
+		for z := from.Z; z <= to.Z; z++ {
+			for x := from.X; x <= to.X; x++ {
+				center := Vector3f{X: float32(x) + 0.5, Y: float32(y) + 0.5, Z: float32(z) + 0.5}
+				if triangleTouchesBox(tri.Corners, center, 0.5) {
+					grid.setVoxelized(x, y, z, tri.Material)
+				}
+			}
+		}
+	}
+}
+
+// triangleTouchesBox is the separating axis test from Akenine-Moller's "Fast
+// 3D Triangle-Box Overlap Testing", a triangle that only touches the box
+// counts as overlapping
+func triangleTouchesBox(corners [3]Vector3f, center Vector3f, half float32) bool {
+	v := [3]Vector3f{corners[0].Sub(center), corners[1].Sub(center), corners[2].Sub(center)}
+
+	separated := func(axis Vector3f) bool {
+		p0, p1, p2 := axis.DotProduct(v[0]), axis.DotProduct(v[1]), axis.DotProduct(v[2])
+		extent := axis.Abs()
+		r := half * (extent.X + extent.Y + extent.Z)
+		return min(p0, p1, p2) > r || max(p0, p1, p2) < -r
+	}
+
+	// the box's own axes
+	for _, axis := range []Vector3f{{X: 1}, {Y: 1}, {Z: 1}} {
+		if separated(axis) {
+			return false
+		}
+	}
+
+	// the triangle's plane
+	edges := [3]Vector3f{v[1].Sub(v[0]), v[2].Sub(v[1]), v[0].Sub(v[2])}
+	if separated(edges[0].CrossProduct(edges[1])) {
+		return false
+	}
+
+	// each box axis crossed with each triangle edge
+	for _, edge := range edges {
+		for _, axis := range []Vector3f{{X: 1}, {Y: 1}, {Z: 1}} {
+			if separated(axis.CrossProduct(edge)) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+type voxelizeHit struct {
+	y        float32
+	material int
+}
+
+// voxelizeSolid casts a ray up the middle of every column of voxels and fills
+// the column from each crossing into the mesh to the crossing back out
+func (grid *VoxelGrid) voxelizeSolid(triangles []Triangle) {
+	columns := make([][]voxelizeHit, grid.NumVoxelsX*grid.NumVoxelsZ)
+
+	for _, tri := range triangles {
+		a, b, c := tri.Corners[0], tri.Corners[1], tri.Corners[2]
+
+		// edge tells which side of a -> b the point is on when looking down y
+		edge := func(a, b Vector3f, x, z float64) float64 {
+			return float64(b.X-a.X)*(z-float64(a.Z)) - float64(b.Z-a.Z)*(x-float64(a.X))
+		}
+
+		area := edge(a, b, float64(c.X), float64(c.Z))
+		if area == 0 {
+			// edge on to the rays so they can't cross it
+			continue
+		}
+		if area < 0 {
+			b, c, area = c, b, -area
+		}
+
+		// a ray exactly on an edge belongs to only one of the two triangles
+		// sharing it, depending on which way the edge goes
+		owns := func(a, b Vector3f, w float64) bool {
+			return w > 0 || (w == 0 && (b.Z > a.Z || (b.Z == a.Z && b.X > a.X)))
+		}
+
+		lo := a.Min(b).Min(c)
+		hi := a.Max(b).Max(c)
+		for z := max(int32(math.Floor(float64(lo.Z))), 0); z < min(int32(math.Ceil(float64(hi.Z))), grid.NumVoxelsZ); z++ {
+			for x := max(int32(math.Floor(float64(lo.X))), 0); x < min(int32(math.Ceil(float64(hi.X))), grid.NumVoxelsX); x++ {
+				px, pz := float64(x)+0.5, float64(z)+0.5
+				wa, wb, wc := edge(b, c, px, pz), edge(c, a, px, pz), edge(a, b, px, pz)
+				if !owns(b, c, wa) || !owns(c, a, wb) || !owns(a, b, wc) {
+					continue
+				}
+
+				y := (wa*float64(a.Y) + wb*float64(b.Y) + wc*float64(c.Y)) / area
+				columns[x+z*grid.NumVoxelsX] = append(columns[x+z*grid.NumVoxelsX], voxelizeHit{y: float32(y), material: tri.Material})
+			}
+		}
+	}
+
+	for i, hits := range columns {
+		sort.Slice(hits, func(i, j int) bool { return hits[i].y < hits[j].y })
+
+		x, z := int32(i)%grid.NumVoxelsX, int32(i)/grid.NumVoxelsX
+		for k := 0; k+1 < len(hits); k += 2 {
+			// voxels whose middle is between the crossings
+			from := max(int32(math.Ceil(float64(hits[k].y)-0.5)), 0)
+			to := min(int32(math.Ceil(float64(hits[k+1].y)-0.5)), grid.NumVoxelsY)
+			for y := from; y < to; y++ {
+				grid.setVoxelized(x, y, z, hits[k].material)
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package voxel
+
+import (
+	"math"
+	"testing"
+)
+
+func TestVoxelizeCube(t *testing.T) {
+	mesh := cubeMesh(t)
+
+	grid := Voxelize(mesh, 1, VOXELIZE_SURFACE)
+	if !grid.Count().Equals(Vector3i{X: 4, Y: 4, Z: 4}) {
+		t.Fatalf("Incorrect size: %+v\n", grid.Count())
+	}
+
+	if n := grid.CountVoxels(Vector3i{}, grid.Count()); n != 4*4*4-2*2*2 {
+		t.Fatalf("Incorrect surface: %d\n", n)
+	}
+
+	if len(grid.Palette) != 4 || grid.Palette[3] != mesh.Materials[2].Color {
+		t.Fatalf("Incorrect palette: %+v\n", grid.Palette)
+	}
+
+	for _, c := range []struct {
+		pos      Vector3i
+		material Material
+	}{{Vector3i{X: 1, Y: 0, Z: 2}, 1}, {Vector3i{X: 2, Y: 3, Z: 1}, 2}, {Vector3i{X: 3, Y: 1, Z: 2}, 3}, {Vector3i{X: 1, Y: 2, Z: 0}, 0}} {
+		if !grid.GetVoxel(c.pos.X, c.pos.Y, c.pos.Z) || grid.GetMaterial(c.pos.X, c.pos.Y, c.pos.Z) != c.material {
+			t.Fatalf("Incorrect material: %+v %d\n", c.pos, grid.GetMaterial(c.pos.X, c.pos.Y, c.pos.Z))
+		}
+	}
+
+	grid = Voxelize(mesh, 0.5, VOXELIZE_SOLID)
+	if n := grid.CountVoxels(Vector3i{}, grid.Count()); n != 8*8*8 {
+		t.Fatalf("Incorrect solid: %d\n", n)
+	}
+
+	// the inside takes the material of the triangle below it
+	if grid.GetMaterial(3, 3, 3) != 1 {
+		t.Fatalf("Incorrect inside material: %d\n", grid.GetMaterial(3, 3, 3))
+	}
+}
+
+// octahedronMesh is the closed surface where |x| + |y| + |z| = r
+func octahedronMesh(center Vector3f, r float32) *TriangleMesh {
+	mesh := &TriangleMesh{}
+	for _, sx := range []float32{-1, 1} {
+		for _, sy := range []float32{-1, 1} {
+			for _, sz := range []float32{-1, 1} {
+				mesh.Triangles = append(mesh.Triangles, Triangle{
+					Corners: [3]Vector3f{
+						center.Plus(Vector3f{X: sx * r}),
+						center.Plus(Vector3f{Y: sy * r}),
+						center.Plus(Vector3f{Z: sz * r}),
+					},
+					Material: -1,
+				})
+			}
+		}
+	}
+	return mesh
+}
+
+func TestVoxelizeOctahedron(t *testing.T) {
+	const r, size = 5.3, 0.5
+	mesh := octahedronMesh(Vector3f{X: 10, Y: -3, Z: 7}, r)
+
+	surface := Voxelize(mesh, size, VOXELIZE_SURFACE)
+	solid := Voxelize(mesh, size, VOXELIZE_SOLID)
+
+	// the smallest and largest |x| + |y| + |z| in a voxel, measured from
+	// the middle of the octahedron in voxel units
+	rr := float64(r / size)
+	extent := func(x, y, z int32) (float64, float64) {
+		lo, hi := 0.0, 0.0
+		for _, a := range []float64{float64(x), float64(y), float64(z)} {
+			a -= rr
+			if a >= 0 || a+1 <= 0 {
+				lo += min(math.Abs(a), math.Abs(a+1))
+			}
+			hi += max(math.Abs(a), math.Abs(a+1))
+		}
+		return lo, hi
+	}
+
+	const eps = 1e-3
+	for y := int32(0); y < surface.NumVoxelsY; y++ {
+		for z := int32(0); z < surface.NumVoxelsZ; z++ {
+			for x := int32(0); x < surface.NumVoxelsX; x++ {
+				lo, hi := extent(x, y, z)
+
+				// every voxel the surface passes through, and nothing further away
+				crosses := lo < rr-eps && hi > rr+eps
+				touches := lo <= rr+eps && hi >= rr-eps
+				if set := surface.GetVoxel(x, y, z); (crosses && !set) || (set && !touches) {
+					t.Fatalf("Incorrect surface voxel: %d %d %d %v %f %f\n", x, y, z, set, lo, hi)
+				}
+
+				// the middle of the voxel decides if it is inside
+				inside := math.Abs(float64(x)+0.5-rr)+math.Abs(float64(y)+0.5-rr)+math.Abs(float64(z)+0.5-rr) < rr-eps
+				if set := solid.GetVoxel(x, y, z); (inside && !set) || (set && lo > rr+eps) {
+					t.Fatalf("Incorrect solid voxel: %d %d %d %v %f\n", x, y, z, set, lo)
+				}
+			}
+		}
+	}
+}
@@ -1,5 +1,9 @@
 package voxel
 
+import (
+	"math"
+)
+
 type Voxels interface {
 	Set(x, y, z int32, b bool)
 	Get(x, y, z int32) bool
@@ -26,7 +30,14 @@ func (voxels *TestVoxels) index(x, y, z int32) int32 {
 	return x + z*voxels.count.X + y*voxels.count.X*voxels.count.Z
 }
 
+func (voxels *TestVoxels) inside(x, y, z int32) bool {
+	return x >= 0 && y >= 0 && z >= 0 && x < voxels.count.X && y < voxels.count.Y && z < voxels.count.Z
+}
+
 func (voxels *TestVoxels) Set(x, y, z int32, b bool) {
+	if !voxels.inside(x, y, z) {
+		return
+	}
 	var v uint8
 	if b {
 		v = 1
@@ -36,6 +47,9 @@ func (voxels *TestVoxels) Set(x, y, z int32, b bool) {
 }
 
 func (voxels *TestVoxels) Get(x, y, z int32) bool {
+	if !voxels.inside(x, y, z) {
+		return false
+	}
 	i := voxels.index(x, y, z)
 	return voxels.voxels[i] != 0
 }
@@ -49,7 +63,7 @@ func (voxels *TestVoxels) Count() Vector3i {
 }
 
 func (voxels *TestVoxels) Compress() *Voxels {
-	newVoxels := NewTestVoxels(voxels.count.X/2, voxels.count.Y/2, voxels.count.Z/2, voxels.size*2)
+	newVoxels := NewTestVoxels(halfCount(voxels.count.X), halfCount(voxels.count.Y), halfCount(voxels.count.Z), voxels.size*2)
 
 	for y := int32(0); y < newVoxels.Count().Y; y++ {
 		for z := int32(0); z < newVoxels.Count().Z; z++ {
@@ -74,6 +88,13 @@ func (voxels *TestVoxels) Compress() *Voxels {
 	return &newVoxels
 }
 
+// EmptySpace can optionally be implemented by Voxels that know about large
+// empty regions. EmptyBox returns the min (inclusive) and max (exclusive)
+// of an empty box containing mapPos which Trace will cross in a single step
+type EmptySpace interface {
+	EmptyBox(mapPos Vector3i) (Vector3i, Vector3i, bool)
+}
+
 type TraceCallback func(voxels *Voxels, mapPos Vector3i)
 
 type TraceParams struct {
@@ -83,24 +104,21 @@ type TraceParams struct {
 	Callback TraceCallback
 }
 
-type TraceResult struct {
-	Hit      bool
-	OOB      bool
-	Side     int32
-	HitPos   Vector3f
-	MapPos   Vector3i
-	NumSteps int32
-}
-
 type Tracer interface {
-	Trace(TraceParams) TraceResult
+	Trace(TraceParams) RaycastHit
 }
 
 type TracerImpl struct {
 	voxels *Voxels
 }
 
-func (tracer *TracerImpl) Trace(params TraceParams) TraceResult {
+// NewTracerImpl traces voxels at their own resolution, skipping any empty
+// space they know about
+func NewTracerImpl(voxels *Voxels) *TracerImpl {
+	return &TracerImpl{voxels: voxels}
+}
+
+func (tracer *TracerImpl) Trace(params TraceParams) RaycastHit {
 	return Trace(tracer.voxels, params)
 }
 
@@ -108,26 +126,30 @@ type MipmapTracerImpl struct {
 	Voxels []*Voxels
 }
 
-func (tracer *MipmapTracerImpl) Trace(params TraceParams) TraceResult {
+func (tracer *MipmapTracerImpl) Trace(params TraceParams) RaycastHit {
 
 	resolution := len(tracer.Voxels) - 1
 	params.MaxSteps = 4
 	numSteps := int32(0)
+	t := float32(0)
 
 	for {
 		// check for hit at current resolution
 		result := Trace(tracer.Voxels[resolution], params)
 		params.RayStart = result.HitPos
 		numSteps += result.NumSteps
+		t += result.T
 
 		// hit at highest resolution / oob so stop
-		if result.OOB || (result.Hit && resolution == 0) {
+		if result.Status == RAYCAST_OUT_OF_BOUNDS || result.Status == RAYCAST_MISS || (result.Hit() && resolution == 0) {
 			result.NumSteps = numSteps
+			result.T = t
+			result.Level = int32(resolution)
 			return result
 		}
 
 		// hit at low resolution so switch to higher res and continue
-		if result.Hit && resolution > 0 {
+		if result.Hit() && resolution > 0 {
 			resolution--
 			continue
 		}
@@ -181,14 +203,21 @@ func checkVoxel(voxels *Voxels, mapPos Vector3i, rayDir Vector3f) (bool, bool) {
 	return present, false
 }
 
-func Trace(voxels *Voxels, params TraceParams) TraceResult {
-	var result TraceResult
+func Trace(voxels *Voxels, params TraceParams) RaycastHit {
+	var result RaycastHit
 
 	// convert rayPos to voxel space
 	rayPos := params.RayStart.DivScalar((*voxels).Size())
 
-	// which box of the map we're in
-	mapPos := rayPos.ToVector3i()
+	// skip to where the ray enters the grid, which box of the map that is and
+	// how far the ray has travelled to get there
+	dist, mapPos, face, ok := clipRay(rayPos, params.RayDir, (*voxels).Count())
+	if !ok {
+		result.Status = RAYCAST_MISS
+		result.HitPos = params.RayStart
+		result.MapPos = rayPos.Floor().ToVector3i()
+		return result
+	}
 
 	// length of ray from one xyz side to next
 	deltaDist := params.RayDir.Inverse().Abs()
@@ -199,10 +228,11 @@ func Trace(voxels *Voxels, params TraceParams) TraceResult {
 	// length of ray from current position to next x or y-side
 	sideDist := calcSideDist(rayPos, params.RayDir, deltaDist, mapPos)
 
-	// how far the ray has travelled
-	dist := float32(0.0)
+	// some voxels can tell us about empty space we can jump over
+	emptySpace, _ := (*voxels).(EmptySpace)
 
-	// loop until we hit something or we go oob
+	// loop until we hit something, go oob or run out of steps
+	result.Status = RAYCAST_MAX_STEPS
 	for {
 
 		// make callback if one is provided
@@ -211,28 +241,47 @@ func Trace(voxels *Voxels, params TraceParams) TraceResult {
 		}
 
 		// check current voxel
-		result.Hit, result.OOB = checkVoxel(voxels, mapPos, params.RayDir)
+		hit, oob := checkVoxel(voxels, mapPos, params.RayDir)
 		result.NumSteps++
-		if result.Hit || result.OOB {
+		if hit {
+			result.Status = RAYCAST_HIT
+			if face == FACE_NONE {
+				result.Status = RAYCAST_STARTED_INSIDE
+			}
+			break
+		} else if oob {
+			result.Status = RAYCAST_OUT_OF_BOUNDS
 			break
 		}
 
+		// skip the whole empty box in one go
+		if emptySpace != nil && !isOutside(voxels, mapPos) {
+			if boxMin, boxMax, ok := emptySpace.EmptyBox(mapPos); ok {
+				dist, mapPos, face = skipBox(rayPos, params.RayDir, step, boxMin, boxMax)
+				sideDist = calcSideDist(rayPos, params.RayDir, deltaDist, mapPos)
+				if params.MaxSteps > 0 && result.NumSteps >= params.MaxSteps {
+					break
+				}
+				continue
+			}
+		}
+
 		// jump to next map square, either in x, y or z direction
 		if sideDist.X <= sideDist.Y && sideDist.X <= sideDist.Z {
 			dist = sideDist.X
 			sideDist.X += deltaDist.X
 			mapPos.X += step.X
-			result.Side = 1 * step.X
+			face = stepFace(0, step.X)
 		} else if sideDist.Y <= sideDist.X && sideDist.Y <= sideDist.Z {
 			dist = sideDist.Y
 			sideDist.Y += deltaDist.Y
 			mapPos.Y += step.Y
-			result.Side = 2 * step.X
+			face = stepFace(1, step.Y)
 		} else {
 			dist = sideDist.Z
 			sideDist.Z += deltaDist.Z
 			mapPos.Z += step.Z
-			result.Side = 3 * step.X
+			face = stepFace(2, step.Z)
 		}
 
 		// stop if we hit max steps
@@ -242,17 +291,56 @@ func Trace(voxels *Voxels, params TraceParams) TraceResult {
 	}
 
 	// calculate the hit point
+	result.Face, result.Normal = face, face.Normal()
 	result.MapPos = mapPos
+	result.T = dist * (*voxels).Size()
 	result.HitPos = rayPos.Plus(params.RayDir.MulScalar(dist)).MulScalar((*voxels).Size())
 
 	// snap to grid to prevent rounding errors
-	if result.Side == 1 || result.Side == -1 {
-		result.HitPos = result.HitPos.RoundX()
-	} else if result.Side == 2 || result.Side == -2 {
-		result.HitPos = result.HitPos.RoundY()
-	} else if result.Side == 3 || result.Side == -3 {
-		result.HitPos = result.HitPos.RoundZ()
-	}
+	result.snap()
 
 	return result
 }
+
+func skipBox(rayPos Vector3f, rayDir Vector3f, step Vector3i, boxMin, boxMax Vector3i) (float32, Vector3i, Face) {
+	// distance along the ray to the box face we leave through on each axis
+	exit := func(pos, dir float32, step, lo, hi int32) float32 {
+		if dir == 0 {
+			return float32(math.Inf(1))
+		}
+		if step > 0 {
+			return (float32(hi) - pos) / dir
+		}
+		return (float32(lo) - pos) / dir
+	}
+
+	tx := exit(rayPos.X, rayDir.X, step.X, boxMin.X, boxMax.X)
+	ty := exit(rayPos.Y, rayDir.Y, step.Y, boxMin.Y, boxMax.Y)
+	tz := exit(rayPos.Z, rayDir.Z, step.Z, boxMin.Z, boxMax.Z)
+
+	// the voxel we end up in, kept inside the box on the axes we didn't leave through
+	pos := rayPos.Plus(rayDir.MulScalar(min(tx, ty, tz))).Floor().ToVector3i()
+	mapPos := Vector3i{
+		X: max(boxMin.X, min(boxMax.X-1, pos.X)),
+		Y: max(boxMin.Y, min(boxMax.Y-1, pos.Y)),
+		Z: max(boxMin.Z, min(boxMax.Z-1, pos.Z)),
+	}
+
+	// step out of the box through the nearest face
+	leave := func(step, lo, hi int32) int32 {
+		if step > 0 {
+			return hi
+		}
+		return lo - 1
+	}
+
+	if tx <= ty && tx <= tz {
+		mapPos.X = leave(step.X, boxMin.X, boxMax.X)
+		return tx, mapPos, stepFace(0, step.X)
+	} else if ty <= tx && ty <= tz {
+		mapPos.Y = leave(step.Y, boxMin.Y, boxMax.Y)
+		return ty, mapPos, stepFace(1, step.Y)
+	}
+	mapPos.Z = leave(step.Z, boxMin.Z, boxMax.Z)
+	return tz, mapPos, stepFace(2, step.Z)
+}
@@ -29,11 +29,11 @@ func TestTraceHit(t *testing.T) {
 
 				result := Trace(&voxels, params)
 
-				if !result.Hit {
+				if !result.Hit() {
 					t.Fatalf("Failed to hit: %d %d %d %+v\n", x, y, z, result)
 				}
 
-				if result.OOB {
+				if result.Status == RAYCAST_OUT_OF_BOUNDS {
 					t.Fatalf("Incorrect oob: %d %d %d %+v\n", x, y, z, result)
 				}
 
@@ -54,6 +54,33 @@ func TestTraceHit(t *testing.T) {
 	}
 }
 
+func TestTraceFace(t *testing.T) {
+	voxels := NewTestVoxels(16, 16, 16, 1)
+	voxels.Set(8, 8, 8, true)
+	center := Vector3f{X: 8.5, Y: 8.5, Z: 8.5}
+
+	for face := FACE_NEG_X; face <= FACE_POS_Z; face++ {
+		// come in from the side the face points to, drifting towards -x or -z
+		// so the step along the other axes isn't the same as along the face's
+		offset := Vector3f{X: 0.3}
+		if face.Axis() == 0 {
+			offset = Vector3f{Z: 0.3}
+		}
+
+		rs := center.Plus(face.Normal().MulScalar(5)).Plus(offset)
+		re := center.Sub(offset)
+		result := Trace(&voxels, TraceParams{RayStart: rs, RayDir: Direction(re, rs)})
+
+		if result.Status != RAYCAST_HIT || !result.MapPos.Equals(Vector3i{X: 8, Y: 8, Z: 8}) {
+			t.Fatalf("Failed to hit: %d %+v\n", face, result)
+		}
+
+		if result.Face != face || result.Normal != face.Normal() {
+			t.Fatalf("Incorrect face: %+v, expected %d\n", result, face)
+		}
+	}
+}
+
 func TestTraceMiss(t *testing.T) {
 	voxels := NewTestVoxels(16, 16, 16, 1)
 
@@ -72,11 +99,11 @@ func TestTraceMiss(t *testing.T) {
 
 	result := Trace(&voxels, params)
 
-	if result.Hit {
+	if result.Hit() {
 		t.Fatalf("Incorrect hit: %+v\n", result)
 	}
 
-	if !result.OOB {
+	if result.Status != RAYCAST_OUT_OF_BOUNDS {
 		t.Fatalf("Incorrect oob: %+v\n", result)
 	}
 